@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/plugin"
+)
+
+// agePluginUI for non-interactive usage of age plugins
+var agePluginUI = &plugin.ClientUI{
+	DisplayMessage: func(name, message string) error {
+		newLogger("age").Printf("age-plugin-%s: %s", name, message)
+		return nil
+	},
+	RequestValue: func(name, prompt string, _ bool) (string, error) {
+		return "", fmt.Errorf("age-plugin-%s requested input (%s) which is not supported", name, prompt)
+	},
+	Confirm: func(name, prompt, _, _ string) (bool, error) {
+		return false, fmt.Errorf("age-plugin-%s requested confirmation (%s) which is not supported", name, prompt)
+	},
+	WaitTimer: func(name string) {
+		newLogger("age").Printf("waiting for age-plugin-%s (e.g. touch of hardware token) ...", name)
+	},
+}
+
+// parseAgeRecipient of native X25519 keys or age plugins (age1<plugin>1...)
+func parseAgeRecipient(value string) (age.Recipient, error) {
+	recipient, err := age.ParseX25519Recipient(value)
+	if err == nil {
+		return recipient, nil
+	}
+
+	// plugin recipients contain the plugin name between "age1" and the separator "1"
+	if strings.HasPrefix(value, "age1") && strings.Count(value, "1") > 1 {
+		return plugin.NewRecipient(value, agePluginUI)
+	}
+	return nil, err
+}
+
+// parseAgeIdentity of native X25519 keys or age plugins (AGE-PLUGIN-...)
+func parseAgeIdentity(value string) (age.Identity, error) {
+	if strings.HasPrefix(value, "AGE-PLUGIN-") {
+		return plugin.NewIdentity(value, agePluginUI)
+	}
+	return age.ParseX25519Identity(value)
+}
+
+// parseAgeLines with one entry per line (empty lines and comments are ignored)
+func parseAgeLines[T any](reader io.Reader, parse func(string) (T, error)) ([]T, error) {
+	var entries []T
+	scanner := bufio.NewScanner(reader)
+	for line := 1; scanner.Scan(); line++ {
+		value := strings.TrimSpace(scanner.Text())
+		if value == "" || strings.HasPrefix(value, "#") {
+			continue
+		}
+
+		entry, err := parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, errors.New("no entries found")
+	}
+	return entries, nil
+}
+
+// parseAgeRecipients with one recipient per line
+func parseAgeRecipients(reader io.Reader) ([]age.Recipient, error) {
+	return parseAgeLines(reader, parseAgeRecipient)
+}
+
+// parseAgeIdentities with one identity per line
+func parseAgeIdentities(reader io.Reader) ([]age.Identity, error) {
+	return parseAgeLines(reader, parseAgeIdentity)
+}
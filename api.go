@@ -0,0 +1,185 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// handler of the health check server
+func (h *Housekeeper) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /backup", h.serveBackup)
+	mux.HandleFunc("GET /status", h.serveStatus)
+	mux.Handle("GET /metrics", &metrics)
+	mux.HandleFunc("/", h.serveHealthcheck)
+	return mux
+}
+
+// serveHealthcheck returns 200 if housekeeper is ready, all monitored containers are healthy
+// and no backup is older than the configured max age
+func (h *Housekeeper) serveHealthcheck(writer http.ResponseWriter, _ *http.Request) {
+	if !h.running.Load() {
+		writer.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	h.mutex.RLock()
+	status, healthy := h.containerHealth()
+	backupStatus, backupHealthy := h.backupHealth()
+	h.mutex.RUnlock()
+	status = append(status, backupStatus...)
+	healthy = healthy && backupHealthy
+	if !healthy {
+		writer.WriteHeader(http.StatusServiceUnavailable)
+	} else {
+		writer.WriteHeader(http.StatusOK)
+	}
+	for _, line := range status {
+		fmt.Fprintln(writer, line)
+	}
+}
+
+// containerHealth returns the health status of the monitored containers
+// and true if all of them are healthy
+func (h *Housekeeper) containerHealth() ([]string, bool) {
+	healthy := true
+	var status []string
+	for _, name := range h.config.API.HealthContainers {
+		inspect, err := h.docker.InspectContainer(name)
+		if err != nil {
+			healthy = false
+			status = append(status, fmt.Sprintf("%s: %v", name, err))
+			continue
+		}
+		if !inspect.State.healthy() {
+			healthy = false
+		}
+		status = append(status, fmt.Sprintf("%s: %s", name, inspect.State.health()))
+	}
+	return status, healthy
+}
+
+// parseMaxBackupAge as duration (e.g. 36h) or as factor of the schedule interval (e.g. 1.5x)
+func parseMaxBackupAge(value string) (time.Duration, float64, error) {
+	if value == "" {
+		return 0, 0, nil
+	}
+	if factor, ok := strings.CutSuffix(value, "x"); ok {
+		parsed, err := strconv.ParseFloat(factor, 64)
+		if err != nil || parsed <= 0 || math.IsNaN(parsed) || math.IsInf(parsed, 0) {
+			return 0, 0, fmt.Errorf("invalid max backup age %s", value)
+		}
+		return 0, parsed, nil
+	}
+	age, err := time.ParseDuration(value)
+	if err != nil || age <= 0 {
+		return 0, 0, fmt.Errorf("invalid max backup age %s", value)
+	}
+	return age, 0, nil
+}
+
+// backupHealth returns the age of the last successful backup of all scheduled jobs
+// and true if none of them is older than the configured max backup age
+func (h *Housekeeper) backupHealth() ([]string, bool) {
+	maxAge, factor, _ := parseMaxBackupAge(h.config.API.HealthBackupMaxAge)
+	if maxAge == 0 && factor == 0 {
+		return nil, true
+	}
+
+	healthy := true
+	var status []string
+	for _, job := range h.jobs {
+		if job.Cron == nil || job.CronEntry == 0 {
+			continue
+		}
+
+		// jobs without backup are checked from the start of the schedule
+		lastRun := job.loadLastRun()
+		since := lastRun
+		if since.IsZero() {
+			since = job.scheduleStart
+		}
+
+		limit := maxAge
+		if factor > 0 {
+			schedule := job.Cron.Entry(job.CronEntry).Schedule
+			next := schedule.Next(since)
+			limit = time.Duration(factor * float64(schedule.Next(next).Sub(next)))
+		}
+
+		age := time.Since(since).Round(time.Second)
+		if age > limit {
+			healthy = false
+		}
+		if lastRun.IsZero() {
+			status = append(status, fmt.Sprintf("%s: no successful backup yet, schedule started %s ago (max %s)",
+				job.title(), age, limit.Round(time.Second)))
+		} else {
+			status = append(status, fmt.Sprintf("%s: last successful backup %s ago (max %s)",
+				job.title(), age, limit.Round(time.Second)))
+		}
+	}
+	return status, healthy
+}
+
+// serveBackup runs a backup of all jobs or of the job given by the "job" query parameter
+func (h *Housekeeper) serveBackup(writer http.ResponseWriter, request *http.Request) {
+	// the lock is only held to select the jobs, a reload waits for running backups itself
+	h.mutex.RLock()
+	if !h.authorized(request) {
+		h.mutex.RUnlock()
+		http.Error(writer, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if !h.running.Load() {
+		h.mutex.RUnlock()
+		http.Error(writer, "housekeeper not ready", http.StatusServiceUnavailable)
+		return
+	}
+
+	jobs := h.jobs
+	if name := request.URL.Query().Get("job"); name != "" {
+		job, err := h.job(name)
+		if err != nil {
+			h.mutex.RUnlock()
+			http.Error(writer, err.Error(), http.StatusNotFound)
+			return
+		}
+		jobs = []*BackupService{job}
+	}
+	h.mutex.RUnlock()
+
+	newLogger("api").Print("> backup triggered over HTTP")
+	var failed []string
+	for _, job := range jobs {
+		if err := job.Backup(); errors.Is(err, errBackupRunning) {
+			failed = append(failed, fmt.Sprintf("%s skipped: %v", job.title(), err))
+		} else if err != nil {
+			job.logger().Error("backup failed", "error", err)
+			failed = append(failed, fmt.Sprintf("%s failed: %v", job.title(), err))
+		}
+	}
+	if len(failed) > 0 {
+		http.Error(writer, strings.Join(failed, "\n"), http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprintln(writer, "backup finished")
+}
+
+// authorized returns true if the request contains the token. Requests on the unix
+// socket are also authorized if no token is configured, requests over TCP never.
+func (h *Housekeeper) authorized(request *http.Request) bool {
+	if h.config.API.Token == "" {
+		addr, _ := request.Context().Value(http.LocalAddrContextKey).(net.Addr)
+		return addr == nil || addr.Network() == "unix"
+	}
+	token, ok := strings.CutPrefix(request.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(h.config.API.Token)) == 1
+}
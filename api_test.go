@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseMaxBackupAge(t *testing.T) {
+	tests := []struct {
+		value  string
+		age    time.Duration
+		factor float64
+		err    bool
+	}{
+		{"", 0, 0, false},
+		{"36h", 36 * time.Hour, 0, false},
+		{"1h30m", 90 * time.Minute, 0, false},
+		{"1.5x", 0, 1.5, false},
+		{"2x", 0, 2, false},
+		{"0h", 0, 0, true},
+		{"-1h", 0, 0, true},
+		{"36", 0, 0, true},
+		{"x", 0, 0, true},
+		{"0x", 0, 0, true},
+		{"-1x", 0, 0, true},
+		{"NaNx", 0, 0, true},
+		{"Infx", 0, 0, true},
+		{"1.5y", 0, 0, true},
+	}
+	for _, test := range tests {
+		age, factor, err := parseMaxBackupAge(test.value)
+		if (err != nil) != test.err {
+			t.Errorf("parseMaxBackupAge(%q) error = %v, expected error %v", test.value, err, test.err)
+			continue
+		}
+		if age != test.age || factor != test.factor {
+			t.Errorf("parseMaxBackupAge(%q) = %s, %v, expected %s, %v", test.value, age, factor, test.age, test.factor)
+		}
+	}
+}
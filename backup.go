@@ -2,18 +2,23 @@ package main
 
 import (
 	"archive/zip"
+	"bytes"
 	"compress/gzip"
 	"context"
+	"crypto/sha256"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
-	"log"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
-	"filippo.io/age"
 	_ "github.com/rclone/rclone/backend/all"
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/config"
@@ -25,20 +30,67 @@ import (
 
 // BackupService handles database and directory backups
 type BackupService struct {
+	// Name of the backup job (empty if no jobs are defined)
+	Name     string
 	Config   BackupConfig
 	Database DatabaseConnection
 
 	Cron      *cron.Cron
 	CronEntry cron.EntryID
 	RClone    fs.Fs
+	Mirrors   []fs.Fs
+	Notify    *NotificationService
+	Docker    *DockerClient
+
+	// incrementalState of the created backup that is stored once the backup succeeded
+	incrementalState *incrementalState
+	// runStats of the created backup
+	runStats *backupStats
+	// blackout windows of scheduled backups
+	blackout *blackout
+	// labelSchedules of discovered containers with their cron entries
+	labelSchedules map[string]cron.EntryID
+	// labelSchedulesMutex protects labelSchedules against the refresh on the cron goroutine
+	labelSchedulesMutex sync.Mutex
+	// scheduleStart is used as last backup for the health check if no backup exists
+	scheduleStart time.Time
+
+	// runLock is held while a backup is running
+	runLock sync.Mutex
+	// queued is true if a backup waits for the running backup
+	queued atomic.Bool
+	// running is true while a backup is created
+	running atomic.Bool
+
+	// lastRun of this process returned by the status endpoint
+	lastRun *BackupRunStatus
+	// warnings of the running backup for the report
+	warnings     []string
+	lastRunMutex sync.Mutex
 }
 
+// maxRetryDelay between retries of a failed scheduled backup
+const maxRetryDelay = time.Hour
+
+// errBackupRunning is returned if a backup is skipped because another backup of the job is running
+var errBackupRunning = errors.New("backup already running")
+
+var (
+	backupSkippedTotal = metrics.counter("housekeeper_backup_skipped_total",
+		"Backups skipped because another backup of the job was running")
+	backupQueuedTotal = metrics.counter("housekeeper_backup_queued_total",
+		"Backups queued until another backup of the job finished")
+)
+
 // Prepare for backup (creating directories, checking credentials, ...)
 func (s *BackupService) Prepare() error {
 	err := os.MkdirAll(s.Config.Storage, os.ModePerm)
 	if err != nil {
 		return fmt.Errorf("failed to create backup dir %s: %w", s.Config.Storage, err)
 	}
+	if history, err := s.loadHistory(); err == nil {
+		s.setHistoryMetrics(history)
+	}
 
 	if s.Config.RCloneConfig != "" {
 		err = config.SetConfigPath(s.Config.RCloneConfig)
@@ -54,121 +106,495 @@ func (s *BackupService) Prepare() error {
 			return fmt.Errorf("failed create rclone FS %s: %w", s.Config.RClonePath, err)
 		}
 	}
-	return nil
+	return s.prepareMirrors()
 }
 
 // IsBackupEnabled returns true if any backup is enabled
 func (s *BackupService) IsBackupEnabled() bool {
-	return s.Config.Database || s.Config.DataDirectories != ""
+	return s.Config.Database || s.Config.DatabaseAll || len(s.Config.DataDirectories) > 0 || s.Config.DockerDiscovery
 }
 
 // StartSchedule of backup cron
 func (s *BackupService) StartSchedule() error {
-	s.Cron = cron.New()
+	location, err := s.Config.scheduleLocation()
+	if err != nil {
+		return err
+	}
+	s.Cron = cron.New(cron.WithParser(cronParser), cron.WithLocation(location), cron.WithLogger(cronLogger{}))
 	s.Cron.Start()
+	s.scheduleStart = time.Now()
+
+	s.blackout, err = newBlackout(s.Config.Blackout, s.Config.BlackoutDefer, location, s.logger())
+	if err != nil {
+		return err
+	}
 
 	// only enable cron if any backup is enabled
 	if s.IsBackupEnabled() && s.Config.Schedule != "" {
-		var err error
-		s.CronEntry, err = s.Cron.AddFunc(s.Config.Schedule, func() {
-			err := s.Backup()
-			if err != nil {
-				log.Printf("backup failed: %v", err)
-			}
-			log.Printf("[Next Backup: %s]", s.Cron.Entry(s.CronEntry).Next)
-		})
+		s.CronEntry, err = s.Cron.AddFunc(s.Config.Schedule, s.scheduledBackup)
+		if err != nil {
+			return fmt.Errorf("failed to create %s schedule: %w", strings.ToLower(s.title()), err)
+		}
+		s.logger().Printf("[Next %s: %s]", s.title(), s.Cron.Entry(s.CronEntry).Next)
+
+		if s.Config.CatchUp {
+			s.catchUp()
+		}
+	}
+
+	// additional schedules of discovered containers
+	if s.Config.DockerDiscovery {
+		s.labelSchedulesMutex.Lock()
+		s.labelSchedules = make(map[string]cron.EntryID)
+		s.labelSchedulesMutex.Unlock()
+		s.refreshLabelSchedules()
+		_, err = s.Cron.AddFunc(labelScheduleRefresh, s.refreshLabelSchedules)
 		if err != nil {
-			return fmt.Errorf("failed to create backup schedule: %w", err)
+			return fmt.Errorf("failed to create schedule refresh: %w", err)
 		}
-		log.Printf("[Next Backup: %s]", s.Cron.Entry(s.CronEntry).Next)
 	}
 	return nil
 }
 
-// StopSchedule cron of backup
+// title of the backup job used in log messages
+func (s *BackupService) title() string {
+	if s.Name == "" {
+		return "Backup"
+	}
+	return "Backup " + s.Name
+}
+
+// logger of the backup component with the job name
+func (s *BackupService) logger() Logger {
+	if s.Name == "" {
+		return newLogger("backup")
+	}
+	return newLogger("backup", "job", s.Name)
+}
+
+// StopSchedule cron of backup and deferred backups and wait up to timeout for running
+// backups (including backups started outside the cron, e.g. over HTTP)
 func (s *BackupService) StopSchedule(timeout time.Duration) {
+	deadline := time.After(timeout)
 	if s.Cron != nil {
 		ctx := s.Cron.Stop()
 		select {
 		case <-ctx.Done():
-		case <-time.After(timeout):
+		case <-deadline:
+			return
 		}
 	}
+	select {
+	case <-s.blackout.stop():
+	case <-deadline:
+		return
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.runLock.Lock()
+		s.runLock.Unlock()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-deadline:
+	}
 }
 
-// Backup database and data directories
+// Backup database and data directories and prune old backups afterwards
 func (s *BackupService) Backup() error {
-	if !s.IsBackupEnabled() {
-		log.Print("Nothing to backup")
+	return s.backup(0)
+}
+
+// backup with the given number of retries after a failure
+func (s *BackupService) backup(retries int) error {
+	if !s.lock() {
+		return errBackupRunning
+	}
+	defer s.runLock.Unlock()
+	s.running.Store(true)
+	defer s.running.Store(false)
+	s.lastRunMutex.Lock()
+	s.warnings = nil
+	s.lastRunMutex.Unlock()
+
+	if s.Name != "" {
+		s.logger().Printf("run backup job %s", s.Name)
+	}
+	if s.IsBackupEnabled() {
+		s.Notify.Start("backup")
+	}
+	start := time.Now()
+	filename, err := s.runBackup()
+	for retry := 1; err != nil && retry <= retries; retry++ {
+		delay := s.Config.retryDelay(retry)
+		s.warn(s.title()+" failed -> retry", "error", err, "retry", retry, "retries", retries, "delay", delay)
+		time.Sleep(delay)
+		filename, err = s.runBackup()
+	}
+	if err == nil && filename == "" {
 		return nil
 	}
 
-	recipients := s.Config.ageRecipients()
-	var filename string
-	if len(recipients) > 0 {
-		filename = fmt.Sprintf("backup_%s.zip.age", time.Now().Format(time.RFC3339))
-	} else {
-		filename = fmt.Sprintf("backup_%s.zip", time.Now().Format(time.RFC3339))
+	notification := Notification{
+		Task:     "backup",
+		Job:      s.Name,
+		Error:    err,
+		Filename: filename,
+		Size:     s.backupSize(filename),
+		Duration: time.Since(start),
+	}
+	notification.NextRun = s.nextRun()
+	run := s.setLastRun(start, notification)
+	if s.Config.Report {
+		if err := s.writeReport(run); err != nil {
+			s.logger().Warn("> failed to write backup report", "error", err)
+		}
+	}
+	s.Notify.Send(notification)
+	return err
+}
+
+// lock the backup run (waits for a running backup if queuing is enabled)
+func (s *BackupService) lock() bool {
+	if s.runLock.TryLock() {
+		return true
+	}
+
+	labels := metricLabels("job", s.Name)
+	if s.Config.Overlap != "queue" || !s.queued.CompareAndSwap(false, true) {
+		s.logger().Printf("%s skipped: previous backup still running", s.title())
+		backupSkippedTotal.add(labels, 1)
+		return false
 	}
-	log.Printf("create backup %s ...", filename)
+	defer s.queued.Store(false)
+
+	s.logger().Printf("%s queued: waiting for previous backup", s.title())
+	backupQueuedTotal.add(labels, 1)
+	s.runLock.Lock()
+	return true
+}
 
-	// open file
-	file, fileClose, err := s.createFile(filename)
+// runBackup creates a backup and prunes old backups afterwards
+func (s *BackupService) runBackup() (string, error) {
+	start := time.Now()
+	s.incrementalState = nil
+	s.runStats = &backupStats{}
+	filename, err := s.createBackup()
+	if err == nil && filename != "" {
+		err = s.markSuccessful(filename)
+	}
+	if err == nil && filename != "" {
+		err = s.mirrorBackup(filename)
+	}
+	if err == nil && s.incrementalState != nil {
+		err = s.saveIncrementalState(s.incrementalState)
+	}
 	if err != nil {
-		return err
+		return filename, err
+	}
+	if filename == "" {
+		return "", nil
 	}
-	defer fileClose()
 
-	encryptedFile, encryptClose, err := s.encryptFile(file)
+	if err = s.saveLastRun(start); err != nil {
+		return filename, err
+	}
+	return filename, s.Prune()
+}
+
+// backupSize of the given backup file (-1 if unknown)
+func (s *BackupService) backupSize(filename string) int64 {
+	if filename == "" || s.Config.ResticRepository != "" {
+		return -1
+	}
+	if s.RClone == nil {
+		info, err := os.Stat(filepath.Join(s.Config.Storage, filename))
+		if err != nil {
+			return -1
+		}
+		return info.Size()
+	}
+	object, err := s.RClone.NewObject(context.Background(), filename)
 	if err != nil {
-		return err
+		return -1
+	}
+	return object.Size()
+}
+
+// closeFile created by createFile with the result of the backup
+func closeFile(fn func(err error) error, err *error) {
+	*err = fn(*err)
+}
+
+// closeWriter and store its error if no error occurred before
+func closeWriter(fn func() error, err *error) {
+	if closeErr := fn(); *err == nil && closeErr != nil {
+		*err = fmt.Errorf("failed to finish backup file: %w", closeErr)
+	}
+}
+
+// createBackup of database and data directories and return the filename
+func (s *BackupService) createBackup() (_ string, err error) {
+	if !s.IsBackupEnabled() {
+		s.logger().Print("Nothing to backup")
+		return "", nil
+	}
+
+	if err := s.checkFreeSpace(); err != nil {
+		return "", err
+	}
+
+	encryption, err := s.Config.encryption()
+	if err != nil {
+		return "", err
+	}
+
+	directories, err := s.dataDirectories()
+	if err != nil {
+		return "", err
+	}
+
+	// hooks of discovered containers (post hooks also run after failed backups)
+	defer func() {
+		if err := s.runHooks(directories, labelBackupHookPost); err != nil {
+			s.warn("> failed to run post backup hooks", "error", err)
+		}
+	}()
+	if err = s.runHooks(directories, labelBackupHookPre); err != nil {
+		return "", err
+	}
+
+	// encrypt entries individually instead of the whole file
+	var entryEncryption Encryption
+	if s.Config.EncryptionMode == "entry" {
+		entryEncryption, encryption = encryption, nil
+	}
+
+	// only changed files of data directories are stored in incremental backups
+	var incremental *incrementalBackup
+	if s.Config.Incremental && len(directories) > 0 {
+		incremental = s.startIncremental()
+	}
+
+	format := s.Config.format()
+	name := "backup_" + time.Now().Format(time.RFC3339)
+	if incremental != nil && incremental.previous != nil {
+		name += incrementalSuffix
+	}
+	filename := name + "." + format
+	if encryption != nil {
+		filename += encryption.Extension()
 	}
-	defer encryptClose()
 
-	// create zip writer (without compression)
-	zipWriter := zip.NewWriter(encryptedFile)
-	defer zipWriter.Close()
+	var archive backupWriter
+	if s.Config.ResticRepository != "" {
+		// entries are stored as snapshots tagged with the backup name
+		filename = name
+		s.logger().Printf("create backup %s in restic repository ...", filename)
+		archive, err = s.newResticBackupWriter(filename)
+		if err != nil {
+			return "", err
+		}
+	} else {
+		s.logger().Printf("create backup %s ...", filename)
+
+		// open file (removed again if the backup fails)
+		var file io.Writer
+		var fileClose func(err error) error
+		file, fileClose, err = s.createFile(filename)
+		if err != nil {
+			return "", err
+		}
+		defer closeFile(fileClose, &err)
+
+		// parity is created from the final content of the backup file
+		if s.Config.ParityShards > 0 {
+			var parityFile io.Writer
+			var parityClose func(err error) error
+			parityFile, parityClose, err = s.createFile(filename + parityExtension)
+			if err != nil {
+				return "", err
+			}
+			defer closeFile(parityClose, &err)
+
+			var parity *parityWriter
+			parity, err = newParityWriter(file, parityFile, s.Config.ParityShards)
+			if err != nil {
+				return "", err
+			}
+			defer closeWriter(parity.Close, &err)
+			file = parity
+		}
+
+		var encryptedFile io.Writer
+		var encryptClose func() error
+		encryptedFile, encryptClose, err = s.encryptFile(file, encryption)
+		if err != nil {
+			return "", err
+		}
+		defer closeWriter(encryptClose, &err)
+
+		// create zip writer (without compression) or compressed tar writer
+		archive = zipBackupWriter{zip.NewWriter(encryptedFile)}
+		if format != "zip" {
+			archive, err = newTarBackupWriter(encryptedFile, format)
+			if err != nil {
+				return "", err
+			}
+		}
+	}
+	defer archive.Close()
 
+	labels, err := s.Config.labels()
+	if err != nil {
+		return "", err
+	}
 	meta := &BackupMeta{
-		Version: 1,
-		Date:    time.Now(),
+		Version:         backupMetaVersion,
+		Date:            time.Now(),
+		Host:            s.Config.hostname(),
+		Labels:          labels,
+		Format:          format,
+		Compression:     s.compression(format),
+		entryEncryption: entryEncryption,
+		incremental:     incremental,
+	}
+	if s.Config.ResticRepository != "" {
+		meta.Format = "restic"
+	}
+	s.runStats.meta = meta
+	for _, enc := range []Encryption{encryption, entryEncryption} {
+		if enc != nil {
+			meta.Encryption = &BackupMetaEncryption{
+				Type: strings.TrimPrefix(enc.Extension(), "."),
+				Mode: s.Config.EncryptionMode,
+			}
+		}
+	}
+	if incremental != nil && incremental.previous != nil {
+		meta.Incremental = &BackupMetaIncremental{
+			Base:     incremental.previous.Base,
+			Previous: incremental.previous.Last,
+		}
 	}
 
-	if err = s.backupDatabase(zipWriter, meta); err != nil {
-		return err
+	if err = s.backupDatabase(archive, meta); err != nil {
+		return "", err
+	}
+	for _, entry := range meta.Entries {
+		s.runStats.rawSize += max(entry.Size, 0)
 	}
 
-	if err = s.backupDirectories(zipWriter, meta); err != nil {
-		return err
+	if err = s.backupDirectories(archive, meta, directories); err != nil {
+		return "", err
+	}
+
+	// snapshots are referenced in the meta file
+	if restic, ok := archive.(*resticBackupWriter); ok {
+		meta.Snapshots, err = restic.Snapshots()
+		if err != nil {
+			return "", err
+		}
 	}
 
 	// write meta file
-	writer, err := zipWriter.CreateHeader(&zip.FileHeader{
-		Name:     "backup.yml",
-		Modified: time.Now(),
-	})
+	metaFilename := "backup.yml"
+	if entryEncryption != nil {
+		metaFilename += entryEncryption.Extension()
+	}
+	// meta file is encoded first so the entry is created with known size
+	var metaData bytes.Buffer
+	metaWriter, err := encryptEntry(&metaData, entryEncryption)
 	if err != nil {
-		return fmt.Errorf("failed to create backup.yml: %w", err)
+		return "", err
+	}
+	if err = yaml.NewEncoder(metaWriter).Encode(&meta); err != nil {
+		return "", fmt.Errorf("failed to write backup.yml: %w", err)
+	}
+	if err = metaWriter.Close(); err != nil {
+		return "", fmt.Errorf("failed to write backup.yml: %w", err)
+	}
+	if err = writeSizedEntry(archive, metaFilename, metaData.Bytes()); err != nil {
+		return "", fmt.Errorf("failed to write backup.yml: %w", err)
+	}
+
+	if err = archive.Close(); err != nil {
+		return "", fmt.Errorf("failed to finish backup file: %w", err)
 	}
 
-	if err = yaml.NewEncoder(writer).Encode(&meta); err != nil {
-		return fmt.Errorf("failed to write backup.yml: %w", err)
+	if incremental != nil {
+		incremental.state.Last = filename
+		if incremental.previous == nil {
+			incremental.state.Base = filename
+		}
+		s.incrementalState = incremental.state
 	}
 
-	log.Printf("backup finished")
+	s.logger().Printf("backup finished")
+
+	return filename, nil
+}
+
+// checkFreeSpace of the local storage before a backup is created
+func (s *BackupService) checkFreeSpace() error {
+	// backups are not written to local storage if rclone is used
+	if s.Config.MinFreeSpace == "" || s.RClone != nil {
+		return nil
+	}
+
+	minFree, err := parseSize(s.Config.MinFreeSpace)
+	if err != nil {
+		return err
+	}
 
+	free, err := freeSpace(s.Config.Storage)
+	if err != nil {
+		return err
+	}
+	if free < minFree {
+		return fmt.Errorf("not enough free space in %s (%s free, %s required)",
+			s.Config.Storage, formatSize(free), formatSize(minFree))
+	}
 	return nil
 }
 
-// createFile on local file system or remote via rclone
-func (s *BackupService) createFile(filename string) (io.Writer, func(), error) {
+// freeSpace of the file system containing the given path
+func freeSpace(path string) (int64, error) {
+	var stat syscall.Statfs_t
+	err := syscall.Statfs(path, &stat)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get free space of %s: %w", path, err)
+	}
+	return int64(stat.Bavail) * int64(stat.Bsize), nil
+}
+
+// partialExtension of backup files that are written locally (renamed after success)
+const partialExtension = ".partial"
+
+// createFile on local file system or remote via rclone. The file is only kept if
+// the returned function is called without error, local files are written with
+// partialExtension until then and failed remote uploads are removed.
+func (s *BackupService) createFile(filename string) (io.Writer, func(err error) error, error) {
 	if s.RClone == nil {
-		file, err := os.Create(filepath.Join(s.Config.Storage, filename))
+		path := filepath.Join(s.Config.Storage, filename)
+		file, err := os.Create(path + partialExtension)
 		if err != nil {
 			return nil, nil, fmt.Errorf("failed to create backup file %s: %w", filename, err)
 		}
-		return file, func() {
-			file.Close()
+		return file, func(err error) error {
+			closeErr := file.Close()
+			if err == nil && closeErr != nil {
+				err = fmt.Errorf("failed to write backup file %s: %w", filename, closeErr)
+			}
+			if err == nil {
+				err = os.Rename(path+partialExtension, path)
+			}
+			if err != nil {
+				os.Remove(path + partialExtension)
+			}
+			return err
 		}, nil
 	}
 
@@ -176,93 +602,386 @@ func (s *BackupService) createFile(filename string) (io.Writer, func(), error) {
 	var wg sync.WaitGroup
 	wg.Add(1)
 
+	var putErr error
 	go func() {
-		_, err := s.RClone.Put(context.Background(), reader,
+		start := time.Now()
+		_, putErr = s.RClone.Put(context.Background(), reader,
 			object.NewStaticObjectInfo(
 				filename, time.Now(), -1, false, nil, nil))
-		if err != nil {
-			_ = reader.CloseWithError(err)
+		if isBackupFile(filename) {
+			s.runStats.upload = time.Since(start)
+		}
+		if putErr != nil {
+			_ = reader.CloseWithError(putErr)
 		} else {
 			reader.Close()
 		}
 		wg.Done()
 	}()
 
-	return writer, func() {
-		writer.Close()
+	return writer, func(err error) error {
+		// the upload is aborted if the content is incomplete
+		if err != nil {
+			_ = writer.CloseWithError(err)
+		} else {
+			writer.Close()
+		}
 		wg.Wait()
+		if err == nil && putErr != nil {
+			err = fmt.Errorf("failed to upload backup file %s: %w", filename, putErr)
+		}
+		if err != nil {
+			s.removeRemote(filename)
+		}
+		return err
 	}, nil
 }
 
-// encryptFile if configured
-func (s *BackupService) encryptFile(file io.Writer) (io.Writer, func(), error) {
-	recipients := s.Config.ageRecipients()
-	if len(recipients) > 0 {
-		encryptedFile, err := age.Encrypt(file, recipients...)
+// removeRemote file of a failed upload if it exists
+func (s *BackupService) removeRemote(filename string) {
+	ctx := context.Background()
+	remote, err := s.RClone.NewObject(ctx, filename)
+	if err != nil {
+		return
+	}
+	if err = remote.Remove(ctx); err != nil {
+		s.logger().Warn("> failed to remove incomplete backup file", "filename", filename, "error", err)
+	}
+}
+
+// encryptFile if encryption is enabled
+func (s *BackupService) encryptFile(file io.Writer, encryption Encryption) (io.Writer, func() error, error) {
+	if encryption != nil {
+		encryptedFile, err := encryption.Encrypt(file)
 		if err != nil {
-			return nil, nil, fmt.Errorf("failed age encryption: %w", err)
+			return nil, nil, err
 		}
-		return encryptedFile, func() {
-			encryptedFile.Close()
-		}, nil
+		return encryptedFile, encryptedFile.Close, nil
 	}
-	return file, func() {}, nil
+	return file, func() error { return nil }, nil
 }
 
-func (s *BackupService) backupDatabase(zipWriter *zip.Writer, meta *BackupMeta) error {
-	if !s.Config.Database || s.Database == nil {
-		return nil
+// encryptEntry content if entries are encrypted individually
+func encryptEntry(writer io.Writer, encryption Encryption) (io.WriteCloser, error) {
+	if encryption == nil {
+		return nopWriteCloser{writer}, nil
 	}
+	return encryption.Encrypt(writer)
+}
 
-	log.Printf("> dump database")
-	writer, err := zipWriter.CreateHeader(&zip.FileHeader{
-		Name:     "database.sql.gz",
-		Modified: time.Now(),
-	})
+// countingWriter counts the bytes written to the hash
+type countingWriter struct {
+	hash.Hash
+	count int64
+}
+
+// Write to hash and count bytes
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.Hash.Write(p)
+	w.count += int64(n)
+	return n, err
+}
+
+// nopWriteCloser does nothing on close
+type nopWriteCloser struct {
+	io.Writer
+}
+
+// Close does nothing
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// writeSizedEntry with the given content (streamed into the backup if supported)
+func writeSizedEntry(archive backupWriter, name string, content []byte) error {
+	var writer io.Writer
+	var err error
+	if sized, ok := archive.(sizedWriter); ok {
+		writer, err = sized.CreateSized(name, int64(len(content)))
+	} else {
+		writer, err = archive.Create(name)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(content)
+	return err
+}
+
+// writeEntry creates an entry with the content written by fn and records its size and checksum
+func writeEntry(archive backupWriter, meta *BackupMeta, filename string, fn func(writer io.Writer) error) error {
+	entryFilename := filename
+	if meta.entryEncryption != nil {
+		entryFilename += meta.entryEncryption.Extension()
+	}
+	writer, err := archive.Create(entryFilename)
 	if err != nil {
-		return fmt.Errorf("failed to create database.sql.gz: %w", err)
+		return fmt.Errorf("failed to create %s: %w", filename, err)
 	}
 
-	// backup database
-	gzipWriter := gzip.NewWriter(writer)
-	err = s.Database.Backup(gzipWriter)
-	gzipWriter.Close()
+	encryptedWriter, err := encryptEntry(writer, meta.entryEncryption)
 	if err != nil {
 		return err
 	}
-	meta.DatabaseBackup = "database.sql.gz"
 
+	// size and checksum of the unencrypted content
+	hash := &countingWriter{Hash: sha256.New()}
+	err = fn(io.MultiWriter(encryptedWriter, hash))
+	if err != nil {
+		encryptedWriter.Close()
+		return err
+	}
+	if err = encryptedWriter.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", filename, err)
+	}
+
+	meta.addEntry(filename, hash.count, hash)
 	return nil
 }
 
-func (s *BackupService) backupDirectories(zipWriter *zip.Writer, meta *BackupMeta) error {
-	if s.Config.DataDirectories == "" {
+// writeGzipEntry creates an entry with the content written by fn
+// that is compressed with gzip if the filename ends with .gz
+func writeGzipEntry(archive backupWriter, meta *BackupMeta, filename string, fn func(writer io.Writer) error) error {
+	if !strings.HasSuffix(filename, ".gz") {
+		return writeEntry(archive, meta, filename, fn)
+	}
+	return writeEntry(archive, meta, filename, func(writer io.Writer) error {
+		gzipWriter := gzip.NewWriter(writer)
+		err := fn(gzipWriter)
+		if err != nil {
+			gzipWriter.Close()
+			return err
+		}
+		return gzipWriter.Close()
+	})
+}
+
+// compression of the entries in backups of the given format
+func (s *BackupService) compression(format string) string {
+	switch {
+	case s.Config.ResticRepository != "":
+		return ""
+	case format == "tar.zst":
+		return "zstd"
+	default:
+		return "gzip"
+	}
+}
+
+// gzipFilename of an entry that is compressed individually
+// (entries of tar backups are compressed with the whole file and restic compresses itself)
+func (s *BackupService) gzipFilename(name string) string {
+	if s.Config.format() != "zip" || s.Config.ResticRepository != "" {
+		return name
+	}
+	return name + ".gz"
+}
+
+func (s *BackupService) backupDatabase(archive backupWriter, meta *BackupMeta) error {
+	if (!s.Config.Database && !s.Config.DatabaseAll) || s.Database == nil {
 		return nil
 	}
 
-	log.Printf("> backup data directories")
-	dirsSplit := strings.Split(s.Config.DataDirectories, ",")
-	meta.Directories = make([]BackupMetaDirectory, len(dirsSplit))
-	for idx, dir := range dirsSplit {
-		log.Printf("-> %s", dir)
-		dirBackupFilename := fmt.Sprintf("data_%d.tar.gz", idx)
-		writer, err := zipWriter.CreateHeader(&zip.FileHeader{
-			Name:     dirBackupFilename,
-			Modified: time.Now(),
+	meta.DatabaseMode = s.Config.DatabaseMode
+	meta.DatabaseProject, meta.DatabaseService = s.databaseProject()
+	if s.Config.DatabaseMode == "physical" {
+		return s.backupDatabasePhysical(archive, meta)
+	}
+
+	if formatter, ok := s.Database.(DatabaseFormatter); ok {
+		meta.DatabaseFormat = formatter.DumpFormat()
+		meta.DatabaseContent = formatter.DumpContent()
+		if meta.DatabaseContent != "" {
+			s.logger().Printf("> database dump is %s", meta.DatabaseContent)
+		}
+	}
+	if s.Config.DatabaseAll {
+		return s.backupAllDatabases(archive, meta)
+	}
+
+	if s.Config.DatabaseGlobals {
+		err := s.backupGlobals(archive, meta)
+		if err != nil {
+			return err
+		}
+	}
+
+	s.logger().Printf("> dump database")
+	dumpFilename := s.gzipFilename(s.Database.BackupFilename())
+	err := writeGzipEntry(archive, meta, dumpFilename, s.Database.Backup)
+	if err != nil {
+		return err
+	}
+	meta.DatabaseBackup = dumpFilename
+
+	if info, ok := s.Database.(DatabaseBackupInfo); ok {
+		meta.DatabaseInfo = info.BackupInfo()
+	}
+
+	return nil
+}
+
+func (s *BackupService) backupDatabasePhysical(archive backupWriter, meta *BackupMeta) error {
+	physical, ok := s.Database.(PhysicalDatabaseConnection)
+	if !ok {
+		return errors.New("physical backup not supported by database type")
+	}
+
+	s.logger().Printf("> physical database backup")
+	dumpFilename := s.gzipFilename("database.base.tar")
+	err := writeGzipEntry(archive, meta, dumpFilename, physical.BackupPhysical)
+	if err != nil {
+		return err
+	}
+	meta.DatabaseBackup = dumpFilename
+	return nil
+}
+
+func (s *BackupService) backupGlobals(archive backupWriter, meta *BackupMeta) error {
+	globals, ok := s.Database.(GlobalsDatabaseConnection)
+	if !ok {
+		return errors.New("backup of globals not supported by database type")
+	}
+
+	s.logger().Printf("> dump globals")
+	dumpFilename := s.gzipFilename("globals.sql")
+	err := writeGzipEntry(archive, meta, dumpFilename, globals.BackupGlobals)
+	if err != nil {
+		return err
+	}
+	meta.GlobalsBackup = dumpFilename
+	return nil
+}
+
+func (s *BackupService) backupAllDatabases(archive backupWriter, meta *BackupMeta) error {
+	multiDatabase, ok := s.Database.(MultiDatabaseConnection)
+	if !ok {
+		return errors.New("backup of all databases not supported by database type")
+	}
+
+	err := s.backupGlobals(archive, meta)
+	if err != nil {
+		return err
+	}
+
+	databases, err := multiDatabase.Databases()
+	if err != nil {
+		return err
+	}
+
+	s.logger().Printf("> dump all databases")
+	extension := path.Ext(s.Database.BackupFilename())
+	for _, database := range databases {
+		s.logger().Printf("-> %s", database)
+		dumpFilename := s.gzipFilename(fmt.Sprintf("databases/%s%s", database, extension))
+		err = writeGzipEntry(archive, meta, dumpFilename, func(writer io.Writer) error {
+			return multiDatabase.BackupDatabase(database, writer)
 		})
 		if err != nil {
-			return fmt.Errorf("failed to create data_%d.tar.gz: %w", idx, err)
+			return err
+		}
+
+		meta.Databases = append(meta.Databases, BackupMetaDatabase{
+			Name:     database,
+			Filename: dumpFilename,
+		})
+	}
+	return nil
+}
+
+func (s *BackupService) backupDirectories(archive backupWriter, meta *BackupMeta, directories []backupDirectory) error {
+	if len(directories) == 0 {
+		return nil
+	}
+
+	s.logger().Printf("> backup data directories")
+	meta.Directories = make([]BackupMetaDirectory, len(directories))
+	for idx, directory := range directories {
+		dir := directory.Path
+		s.logger().Printf("-> %s", dir)
+
+		var include tarFilter
+		if meta.incremental != nil {
+			include = meta.incremental.include(dir)
+		}
+		include = excludeFilter(directory.Exclude, include)
+		// filtered directories are not supported by restic
+		if _, ok := archive.(*resticBackupWriter); !ok {
+			include = s.runStats.countFilter(include)
+		}
+
+		// directories are stored as members of tar backups
+		if dirWriter, ok := archive.(directoryWriter); ok {
+			dirBackupFilename := fmt.Sprintf("%sdata_%d/", directory.prefix(), idx)
+			digest, err := dirWriter.AddDirectory(dirBackupFilename, dir, include)
+			if err != nil {
+				return fmt.Errorf("failed to add %s: %w", dir, err)
+			}
+			if digest != nil {
+				meta.addEntry(dirBackupFilename, digest.size, digest.hash)
+			}
+			meta.Directories[idx] = BackupMetaDirectory{
+				DirectoryPath: dir,
+				Filename:      dirBackupFilename,
+				Project:       directory.Project,
+				Service:       directory.Service,
+			}
+			if meta.incremental != nil {
+				meta.Directories[idx].Deleted = meta.incremental.deleted(dir)
+			}
+			continue
+		}
+
+		compress, err := s.compressDirectory(dir)
+		if err != nil {
+			return err
 		}
 
-		err = tarDir(writer, dir)
+		dirBackupFilename := fmt.Sprintf("%sdata_%d.tar.gz", directory.prefix(), idx)
+		writeDir := tarDir
+		if !compress {
+			s.logger().Printf("-> store %s without compression", dir)
+			dirBackupFilename = fmt.Sprintf("%sdata_%d.tar", directory.prefix(), idx)
+			writeDir = writeFilteredTar
+		}
+		err = writeEntry(archive, meta, dirBackupFilename, func(writer io.Writer) error {
+			return writeDir(writer, dir, include)
+		})
 		if err != nil {
-			return fmt.Errorf("failed to create data_%d.tar.gz: %w", idx, err)
+			return fmt.Errorf("failed to create %s: %w", dirBackupFilename, err)
 		}
 
 		meta.Directories[idx] = BackupMetaDirectory{
 			DirectoryPath: dir,
 			Filename:      dirBackupFilename,
+			Project:       directory.Project,
+			Service:       directory.Service,
+		}
+		if meta.incremental != nil {
+			meta.Directories[idx].Deleted = meta.incremental.deleted(dir)
 		}
 	}
 	return nil
 }
+
+// compressDirectory returns true if the directory backup should be compressed
+func (s *BackupService) compressDirectory(dir string) (bool, error) {
+	for _, storeDir := range s.Config.DataStore {
+		if filepath.Clean(storeDir) == filepath.Clean(dir) {
+			return false, nil
+		}
+	}
+
+	switch s.Config.DataCompression {
+	case "none":
+		return false, nil
+	case "auto":
+		compressed, err := isCompressedContent(dir)
+		if err != nil {
+			return false, err
+		}
+		return !compressed, nil
+	default:
+		return true, nil
+	}
+}
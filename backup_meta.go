@@ -1,6 +1,14 @@
 package main
 
-import "time"
+import (
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"time"
+)
+
+// backupMetaVersion of new backup files
+const backupMetaVersion = 2
 
 // BackupMeta for backup file
 type BackupMeta struct {
@@ -9,11 +17,121 @@ type BackupMeta struct {
 	// Date of backup creation
 	Date time.Time `yaml:"date"`
 
+	// Host the backup was created on
+	Host string `yaml:"host,omitempty"`
+	// Labels of the application configured with BACKUP_LABELS
+	Labels map[string]string `yaml:"labels,omitempty"`
+
+	// Format of the backup file (zip, tar.gz, tar.zst or restic)
+	Format string `yaml:"format,omitempty"`
+	// Compression of the entries (gzip, zstd or empty if compressed by restic)
+	Compression string `yaml:"compression,omitempty"`
+	// Encryption of the backup (not set for unencrypted backups)
+	Encryption *BackupMetaEncryption `yaml:"encryption,omitempty"`
+
 	// DatabaseBackup contains the name of the database dump file
 	DatabaseBackup string `yaml:"database_backup,omitempty"`
+	// DatabaseMode of the database backup (logical dump or physical base backup)
+	DatabaseMode string `yaml:"database_mode,omitempty"`
+	// DatabaseFormat of the database dumps (e.g. plain or custom for postgres)
+	DatabaseFormat string `yaml:"database_format,omitempty"`
+	// DatabaseContent is set to schema-only or data-only for partial database dumps
+	DatabaseContent string `yaml:"database_content,omitempty"`
+	// DatabaseInfo contains additional details of the database dump
+	DatabaseInfo map[string]string `yaml:"database_info,omitempty"`
+	// DatabaseProject and DatabaseService of the database container (dumps with docker exec only)
+	DatabaseProject string `yaml:"database_project,omitempty"`
+	DatabaseService string `yaml:"database_service,omitempty"`
+
+	// GlobalsBackup contains the name of the dump file of global objects (roles, tablespaces)
+	GlobalsBackup string `yaml:"globals_backup,omitempty"`
+	// Databases list all database dumps if all databases are backed up
+	Databases []BackupMetaDatabase `yaml:"databases,omitempty"`
 
 	// Directories list all directory backups stored in the backup file
 	Directories []BackupMetaDirectory `yaml:"directories,omitempty"`
+
+	// Incremental references the previous backups if only changed files of the data directories are stored
+	Incremental *BackupMetaIncremental `yaml:"incremental,omitempty"`
+
+	// Snapshots contains the restic snapshot IDs of all entries if a restic repository is used
+	Snapshots map[string]string `yaml:"snapshots,omitempty"`
+
+	// Entries contains size and SHA-256 of every entry in the backup file
+	Entries map[string]BackupMetaEntry `yaml:"entries,omitempty"`
+	// Checksums contains the SHA-256 of every entry (version 1 only, replaced by Entries)
+	Checksums map[string]string `yaml:"checksums,omitempty"`
+
+	// entryEncryption of individually encrypted entries (only used while writing)
+	entryEncryption Encryption
+	// incremental tracking of data directories (only used while writing)
+	incremental *incrementalBackup
+}
+
+type BackupMetaEntry struct {
+	// Size of the unencrypted entry (total size of all files for directory members)
+	Size int64 `yaml:"size"`
+
+	// SHA256 of the unencrypted entry (of all files and names for directory members)
+	SHA256 string `yaml:"sha256"`
+}
+
+type BackupMetaEncryption struct {
+	// Type of encryption (age or gpg)
+	Type string `yaml:"type"`
+
+	// Mode of encryption (archive or entry)
+	Mode string `yaml:"mode"`
+}
+
+// migrate meta data of older backup versions to the current version
+func (m *BackupMeta) migrate() error {
+	switch m.Version {
+	case 1:
+		// checksums without size are converted to entries with unknown size (-1)
+		if len(m.Entries) == 0 && len(m.Checksums) > 0 {
+			m.Entries = make(map[string]BackupMetaEntry, len(m.Checksums))
+			for name, checksum := range m.Checksums {
+				m.Entries[name] = BackupMetaEntry{Size: -1, SHA256: checksum}
+			}
+		}
+		m.Checksums = nil
+		m.Version = 2
+		return nil
+
+	case backupMetaVersion:
+		return nil
+
+	default:
+		return fmt.Errorf("unsupported backup version %d", m.Version)
+	}
+}
+
+// addEntry with its size and checksum
+func (m *BackupMeta) addEntry(name string, size int64, hash hash.Hash) {
+	if m.Entries == nil {
+		m.Entries = make(map[string]BackupMetaEntry)
+	}
+	m.Entries[name] = BackupMetaEntry{
+		Size:   size,
+		SHA256: hex.EncodeToString(hash.Sum(nil)),
+	}
+}
+
+type BackupMetaIncremental struct {
+	// Base is the full backup of the chain
+	Base string `yaml:"base"`
+
+	// Previous backup this backup is based on
+	Previous string `yaml:"previous"`
+}
+
+type BackupMetaDatabase struct {
+	// Name of the database
+	Name string `yaml:"name"`
+
+	// Filename of database dump
+	Filename string `yaml:"filename"`
 }
 
 type BackupMetaDirectory struct {
@@ -22,4 +140,11 @@ type BackupMetaDirectory struct {
 
 	// Filename of directory backup
 	Filename string `yaml:"filename"`
+
+	// Project and Service of discovered directories (compose labels of the container)
+	Project string `yaml:"project,omitempty"`
+	Service string `yaml:"service,omitempty"`
+
+	// Deleted files since the previous backup (incremental backups only)
+	Deleted []string `yaml:"deleted,omitempty"`
 }
@@ -0,0 +1,482 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// backupFormats supported for new backups
+var backupFormats = []string{"zip", "tar.gz", "tar.zst"}
+
+// backupWriter creates the entries of a backup file.
+// The writer of an entry is valid until the next entry is created.
+type backupWriter interface {
+	Create(name string) (io.Writer, error)
+	Close() error
+}
+
+// directoryWriter is implemented by backup writers that store directories as members.
+// The digest of the directory is returned if it can be verified after restore.
+type directoryWriter interface {
+	AddDirectory(prefix, dir string, include tarFilter) (*tarDigest, error)
+}
+
+// sizedWriter is implemented by backup writers that stream entries of known size
+// without buffering them
+type sizedWriter interface {
+	CreateSized(name string, size int64) (io.Writer, error)
+}
+
+// zipBackupWriter stores entries in an uncompressed zip file
+type zipBackupWriter struct {
+	*zip.Writer
+}
+
+// Create a stored zip entry
+func (w zipBackupWriter) Create(name string) (io.Writer, error) {
+	return w.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Modified: time.Now(),
+	})
+}
+
+// tarBackupWriter stores entries in a single compressed tar stream
+type tarBackupWriter struct {
+	tar        *tar.Writer
+	compressor io.WriteCloser
+	closed     bool
+
+	// entries of unknown size are buffered as tar requires the size in advance
+	pending     *os.File
+	pendingName string
+}
+
+// newTarBackupWriter with the compression of the given format
+func newTarBackupWriter(writer io.Writer, format string) (*tarBackupWriter, error) {
+	var compressor io.WriteCloser
+	switch format {
+	case "tar.gz":
+		compressor = gzip.NewWriter(writer)
+	case "tar.zst":
+		var err error
+		compressor, err = zstd.NewWriter(writer)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create zstd writer: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported backup format %s", format)
+	}
+
+	return &tarBackupWriter{
+		tar:        tar.NewWriter(compressor),
+		compressor: compressor,
+	}, nil
+}
+
+// Create a tar member of unknown size that is buffered in a temporary file
+func (w *tarBackupWriter) Create(name string) (io.Writer, error) {
+	if err := w.flush(); err != nil {
+		return nil, err
+	}
+
+	file, err := os.CreateTemp("", "housekeeper_entry_*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	w.pending = file
+	w.pendingName = name
+	return file, nil
+}
+
+// CreateSized tar member that is written directly into the tar stream
+func (w *tarBackupWriter) CreateSized(name string, size int64) (io.Writer, error) {
+	if err := w.flush(); err != nil {
+		return nil, err
+	}
+
+	err := w.tar.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     size,
+		Mode:     0644,
+		ModTime:  time.Now(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return w.tar, nil
+}
+
+// AddDirectory with all files accepted by include (all if nil) as members below the given prefix
+func (w *tarBackupWriter) AddDirectory(prefix, dir string, include tarFilter) (*tarDigest, error) {
+	if err := w.flush(); err != nil {
+		return nil, err
+	}
+
+	writer := &digestTarWriter{
+		Writer: w.tar,
+		digest: newTarDigest(),
+		prefix: prefix,
+	}
+	if err := addFilteredDirToTar(writer, dir, prefix, include); err != nil {
+		return nil, err
+	}
+	return writer.digest, nil
+}
+
+// flush the pending entry into the tar stream
+func (w *tarBackupWriter) flush() error {
+	if w.pending == nil {
+		return nil
+	}
+	file, name := w.pending, w.pendingName
+	w.pending = nil
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	size, err := file.Seek(0, io.SeekCurrent)
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", name, err)
+	}
+
+	err = w.tar.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     size,
+		Mode:     0644,
+		ModTime:  time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	if _, err = io.Copy(w.tar, file); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
+
+// Close the tar stream and the compression
+func (w *tarBackupWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	err := w.flush()
+	if err == nil {
+		err = w.tar.Close()
+	}
+	if closeErr := w.compressor.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// backupEntries provides access to the entries of an opened backup file
+type backupEntries interface {
+	Open(name string) (io.ReadCloser, error)
+	Size(name string) int64
+}
+
+// orderedEntries is implemented by backup entries that are read sequentially.
+// Accessing them in the order of Position avoids reading the file again.
+type orderedEntries interface {
+	Position(name string) int
+}
+
+// zipBackupEntries of a zip backup file
+type zipBackupEntries struct {
+	*zip.Reader
+}
+
+// Open entry of zip file
+func (e zipBackupEntries) Open(name string) (io.ReadCloser, error) {
+	return e.Reader.Open(name)
+}
+
+// Size of the uncompressed entry
+func (e zipBackupEntries) Size(name string) int64 {
+	for _, file := range e.File {
+		if file.Name == name {
+			return int64(file.UncompressedSize64)
+		}
+	}
+	return 0
+}
+
+// tarBackupEntries of a compressed tar backup file. Members are read from a
+// sequential stream that is continued by the next Open, so members accessed
+// in archive order are decompressed only once.
+type tarBackupEntries struct {
+	file    *os.File
+	format  string
+	members []*tar.Header
+
+	// stream that is not in use by an opened member
+	mutex  sync.Mutex
+	cursor *tarCursor
+	closed bool
+}
+
+// tarCursor is a position in the decompressed tar stream
+type tarCursor struct {
+	stream io.Closer
+	reader *tar.Reader
+	// index of the next member returned by reader
+	next int
+}
+
+// openTarBackupEntries indexes all members of the given compressed tar file
+func openTarBackupEntries(filename, format string) (*tarBackupEntries, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := &tarBackupEntries{file: file, format: format}
+	cursor, err := entries.openCursor()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	defer cursor.stream.Close()
+	for {
+		header, err := cursor.reader.Next()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to read tar file: %w", err)
+		}
+		entries.members = append(entries.members, header)
+	}
+}
+
+// openCursor at the start of the decompressed tar file
+func (e *tarBackupEntries) openCursor() (*tarCursor, error) {
+	reader, err := decompressReader(io.NewSectionReader(e.file, 0, math.MaxInt64), e.format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress tar file: %w", err)
+	}
+	return &tarCursor{stream: reader, reader: tar.NewReader(reader)}, nil
+}
+
+// acquireCursor that is positioned before the member with the given index.
+// The stream is only restarted if the member was already passed.
+func (e *tarBackupEntries) acquireCursor(index int) (*tarCursor, error) {
+	e.mutex.Lock()
+	cursor := e.cursor
+	e.cursor = nil
+	e.mutex.Unlock()
+
+	if cursor != nil && cursor.next <= index {
+		return cursor, nil
+	}
+	if cursor != nil {
+		cursor.stream.Close()
+	}
+	return e.openCursor()
+}
+
+// releaseCursor for the next Open (closed if another cursor is already available)
+func (e *tarBackupEntries) releaseCursor(cursor *tarCursor) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.cursor != nil || e.closed {
+		return cursor.stream.Close()
+	}
+	e.cursor = cursor
+	return nil
+}
+
+// seek cursor to the member with the given index
+func (c *tarCursor) seek(index int) (*tar.Header, error) {
+	for {
+		header, err := c.reader.Next()
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tar file: %w", err)
+		}
+		c.next++
+		if c.next > index {
+			return header, nil
+		}
+	}
+}
+
+// tarMemberReader reads the content of a member from the decompressed tar stream
+type tarMemberReader struct {
+	*tar.Reader
+	entries *tarBackupEntries
+	cursor  *tarCursor
+}
+
+// Close member and keep the stream for the next Open
+func (r *tarMemberReader) Close() error {
+	if r.cursor == nil {
+		return nil
+	}
+	cursor := r.cursor
+	r.cursor = nil
+	return r.entries.releaseCursor(cursor)
+}
+
+// Position of the first member with the given name or below the given prefix
+// (-1 if it does not exist)
+func (e *tarBackupEntries) Position(name string) int {
+	for i, member := range e.members {
+		if member.Name == name ||
+			(strings.HasSuffix(name, "/") && strings.HasPrefix(member.Name, name)) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Open member of tar file. Names with a trailing slash return a tar stream
+// containing all members below this prefix.
+func (e *tarBackupEntries) Open(name string) (io.ReadCloser, error) {
+	if strings.HasSuffix(name, "/") {
+		return e.openDirectory(name)
+	}
+
+	index := -1
+	for i, member := range e.members {
+		if member.Name == name && member.Typeflag == tar.TypeReg {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return nil, os.ErrNotExist
+	}
+
+	cursor, err := e.acquireCursor(index)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = cursor.seek(index); err != nil {
+		cursor.stream.Close()
+		return nil, err
+	}
+	return &tarMemberReader{Reader: cursor.reader, entries: e, cursor: cursor}, nil
+}
+
+// openDirectory as tar stream with the prefix removed from all members
+func (e *tarBackupEntries) openDirectory(prefix string) (io.ReadCloser, error) {
+	inDirectory := func(member *tar.Header) bool {
+		return member.Name == strings.TrimSuffix(prefix, "/") || strings.HasPrefix(member.Name, prefix)
+	}
+	first, last := -1, -1
+	for i, member := range e.members {
+		if inDirectory(member) {
+			if first < 0 {
+				first = i
+			}
+			last = i
+		}
+	}
+
+	reader, writer := io.Pipe()
+	if first < 0 {
+		// empty directory
+		writer.CloseWithError(tar.NewWriter(writer).Close())
+		return reader, nil
+	}
+
+	cursor, err := e.acquireCursor(first)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		tarWriter := tar.NewWriter(writer)
+		err := func() error {
+			for cursor.next <= last {
+				member, err := cursor.seek(cursor.next)
+				if err != nil {
+					return err
+				}
+				if !inDirectory(member) {
+					continue
+				}
+
+				header := *member
+				header.Name = strings.TrimPrefix(member.Name, prefix)
+				if member.Name == strings.TrimSuffix(prefix, "/") {
+					header.Name = "."
+				}
+				err = tarWriter.WriteHeader(&header)
+				if err == nil && header.Typeflag == tar.TypeReg {
+					_, err = io.Copy(tarWriter, cursor.reader)
+				}
+				if err != nil {
+					return err
+				}
+			}
+			return tarWriter.Close()
+		}()
+		if err != nil {
+			cursor.stream.Close()
+		} else {
+			err = e.releaseCursor(cursor)
+		}
+		writer.CloseWithError(err)
+	}()
+	return reader, nil
+}
+
+// Size of the member or of all members below a prefix
+func (e *tarBackupEntries) Size(name string) int64 {
+	var size int64
+	for _, member := range e.members {
+		if member.Name == name ||
+			(strings.HasSuffix(name, "/") && strings.HasPrefix(member.Name, name)) {
+			size += member.Size
+		}
+	}
+	return size
+}
+
+// Close tar file
+func (e *tarBackupEntries) Close() error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.closed = true
+	if e.cursor != nil {
+		e.cursor.stream.Close()
+		e.cursor = nil
+	}
+	return e.file.Close()
+}
+
+// decompressReader for the compression of the given tar format
+func decompressReader(reader io.Reader, format string) (io.ReadCloser, error) {
+	switch format {
+	case "tar.gz":
+		return gzip.NewReader(reader)
+	case "tar.zst":
+		decoder, err := zstd.NewReader(reader)
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	default:
+		return nil, fmt.Errorf("unsupported backup format %s", format)
+	}
+}
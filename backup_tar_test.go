@@ -0,0 +1,151 @@
+package main
+
+import (
+	"archive/tar"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTarBackupEntries(t *testing.T) {
+	dir := t.TempDir()
+	data := filepath.Join(dir, "data")
+	if err := os.MkdirAll(data, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(data, "file"), []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range []string{"tar.gz", "tar.zst"} {
+		filename := filepath.Join(dir, "backup."+format)
+		file, err := os.Create(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		writer, err := newTarBackupWriter(file, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entry, err := writer.Create("dump.sql")
+		if err == nil {
+			_, err = entry.Write([]byte("dump"))
+		}
+		if err == nil {
+			_, err = writer.AddDirectory("data_0/", data, nil)
+		}
+		if err == nil {
+			entry, err = writer.CreateSized("backup.yml", 4)
+		}
+		if err == nil {
+			_, err = entry.Write([]byte("meta"))
+		}
+		if err == nil {
+			err = writer.Close()
+		}
+		file.Close()
+		if err != nil {
+			t.Fatalf("%s: failed to write backup: %v", format, err)
+		}
+
+		entries, err := openTarBackupEntries(filename, format)
+		if err != nil {
+			t.Fatalf("%s: failed to open backup: %v", format, err)
+		}
+		for name, expected := range map[string]string{"dump.sql": "dump", "backup.yml": "meta"} {
+			reader, err := entries.Open(name)
+			if err != nil {
+				t.Fatalf("%s: failed to open %s: %v", format, name, err)
+			}
+			content, err := io.ReadAll(reader)
+			reader.Close()
+			if err != nil || string(content) != expected {
+				t.Errorf("%s: content of %s = %q (%v), expected %q", format, name, content, err, expected)
+			}
+		}
+		if _, err = entries.Open("missing"); !os.IsNotExist(err) {
+			t.Errorf("%s: open of missing entry returned %v", format, err)
+		}
+		if size := entries.Size("data_0/"); size != 7 {
+			t.Errorf("%s: size of data_0/ = %d, expected 7", format, size)
+		}
+
+		reader, err := entries.Open("data_0/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		tarReader := tar.NewReader(reader)
+		var names []string
+		for {
+			header, err := tarReader.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%s: failed to read data_0/: %v", format, err)
+			}
+			names = append(names, header.Name)
+		}
+		reader.Close()
+		if len(names) != 2 || names[0] != "." || names[1] != "file" {
+			t.Errorf("%s: members of data_0/ = %q, expected [. file]", format, names)
+		}
+		entries.Close()
+	}
+}
+
+func TestTarBackupEntriesSequential(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "backup.tar.gz")
+	file, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer, err := newTarBackupWriter(file, "tar.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{"a", "b", "c"}
+	for _, name := range names {
+		entry, err := writer.CreateSized(name, int64(len(name)))
+		if err == nil {
+			_, err = entry.Write([]byte(name))
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	entries, err := openTarBackupEntries(filename, "tar.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer entries.Close()
+
+	var cursor *tarCursor
+	for i, name := range append(names, "a", "c", "b") {
+		if i < len(names) && entries.Position(name) != i {
+			t.Errorf("position of %s = %d, expected %d", name, entries.Position(name), i)
+		}
+		reader, err := entries.Open(name)
+		if err != nil {
+			t.Fatalf("failed to open %s: %v", name, err)
+		}
+		content, err := io.ReadAll(reader)
+		if err != nil || string(content) != name {
+			t.Errorf("content of %s = %q (%v)", name, content, err)
+		}
+		reader.Close()
+		reader.Close()
+
+		// members in archive order continue the same stream
+		if i > 0 && i < len(names) && entries.cursor != cursor {
+			t.Errorf("stream restarted for %s", name)
+		}
+		cursor = entries.cursor
+	}
+}
@@ -3,25 +3,158 @@ package main
 import (
 	"archive/tar"
 	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
+	"math"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 )
 
-// tarDir creates a tar gz archive from a directory
-func tarDir(writer io.Writer, dir string) error {
+// tarFilter decides if a file (path relative to the archived directory) is added to a tar archive.
+// Directories are always added independent of the result.
+type tarFilter func(name string, info os.FileInfo) bool
+
+// tarDir creates a tar gz archive from a directory with all files accepted by include (all if nil)
+func tarDir(writer io.Writer, dir string, include tarFilter) error {
 	// create gzip compressed tar writer
 	gzipWriter := gzip.NewWriter(writer)
 	defer gzipWriter.Close()
-	tarWriter := tar.NewWriter(gzipWriter)
+
+	return writeFilteredTar(gzipWriter, dir, include)
+}
+
+// writeTar creates an uncompressed tar archive from a directory
+func writeTar(writer io.Writer, dir string) error {
+	return writeFilteredTar(writer, dir, nil)
+}
+
+// writeFilteredTar creates an uncompressed tar archive from a directory
+// with all files accepted by include (all if nil)
+func writeFilteredTar(writer io.Writer, dir string, include tarFilter) error {
+	tarWriter := tar.NewWriter(writer)
 	defer tarWriter.Close()
 
+	return addFilteredDirToTar(tarWriter, dir, "", include)
+}
+
+// tarEntryWriter receives the members of a tar archive (implemented by *tar.Writer)
+type tarEntryWriter interface {
+	io.Writer
+	WriteHeader(header *tar.Header) error
+}
+
+// tarDigest over the names and the content of all members of a directory
+type tarDigest struct {
+	hash hash.Hash
+	// size of all regular files
+	size int64
+}
+
+// newTarDigest for an empty directory
+func newTarDigest() *tarDigest {
+	return &tarDigest{hash: sha256.New()}
+}
+
+// addMember with the given name relative to the directory
+func (d *tarDigest) addMember(name string, header *tar.Header) {
+	name = strings.TrimSuffix(name, "/")
+	fmt.Fprintf(d.hash, "%s\x00%c\x00%d\x00", name, header.Typeflag, header.Size)
+}
+
+// addContent of the current member
+func (d *tarDigest) addContent(p []byte) {
+	d.hash.Write(p)
+	d.size += int64(len(p))
+}
+
+// readTarDigest of an uncompressed tar stream of a directory
+func readTarDigest(reader io.Reader) (*tarDigest, error) {
+	digest := newTarDigest()
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return digest, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		digest.addMember(header.Name, header)
+		if header.Typeflag == tar.TypeReg {
+			if _, err = io.Copy(digestWriter{digest}, tarReader); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// digestWriter adds the written data as content of the current member
+type digestWriter struct {
+	digest *tarDigest
+}
+
+// Write content to digest
+func (w digestWriter) Write(p []byte) (int, error) {
+	w.digest.addContent(p)
+	return len(p), nil
+}
+
+// digestTarWriter creates the digest of all members written below the prefix
+type digestTarWriter struct {
+	*tar.Writer
+	digest *tarDigest
+	prefix string
+}
+
+// WriteHeader of member and add its name relative to the prefix to the digest
+func (w *digestTarWriter) WriteHeader(header *tar.Header) error {
+	name := strings.TrimPrefix(header.Name, w.prefix)
+	if header.Name == strings.TrimSuffix(w.prefix, "/") {
+		name = "."
+	}
+	w.digest.addMember(name, header)
+	return w.Writer.WriteHeader(header)
+}
+
+// Write content of member and add it to the digest
+func (w *digestTarWriter) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	w.digest.addContent(p[:n])
+	return n, err
+}
+
+// addDirToTar adds all files of dir to the tar archive below the given prefix
+func addDirToTar(tarWriter *tar.Writer, dir, prefix string) error {
+	return addFilteredDirToTar(tarWriter, dir, prefix, nil)
+}
+
+// addFilteredDirToTar adds all files of dir accepted by include (all if nil)
+// to the tar archive below the given prefix
+func addFilteredDirToTar(tarWriter tarEntryWriter, dir, prefix string, include tarFilter) error {
+	logger := newLogger("backup")
 	return filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
 
+		// make file path relative
+		fileRel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return fmt.Errorf("failed to get relative path: %w", err)
+		}
+		if include != nil && fileRel != "." {
+			if !include(filepath.ToSlash(fileRel), info) && !info.IsDir() {
+				return nil
+			}
+		}
+
 		// handle symlinks
 		var symLinkTarget string
 		if info.Mode()&os.ModeSymlink != 0 {
@@ -37,12 +170,7 @@ func tarDir(writer io.Writer, dir string) error {
 			return err
 		}
 
-		// make file path relative
-		fileRel, err := filepath.Rel(dir, file)
-		if err != nil {
-			return fmt.Errorf("failed to get relative path: %w", err)
-		}
-		header.Name = filepath.ToSlash(fileRel)
+		header.Name = filepath.ToSlash(filepath.Join(prefix, fileRel))
 
 		// write tar file entry header
 		err = tarWriter.WriteHeader(header)
@@ -58,11 +186,193 @@ func tarDir(writer io.Writer, dir string) error {
 			}
 			defer f.Close()
 
-			_, err = io.Copy(tarWriter, f)
+			size, err := io.Copy(tarWriter, f)
 			if err != nil {
 				return fmt.Errorf("failed add %s to  archive: %w", file, err)
 			}
+			logger.Log(context.Background(), fileLogLevel, "-> archived file", "file", header.Name, "size", size)
+		}
+		return nil
+	})
+}
+
+// compressedExtensions of file formats that are already compressed
+var compressedExtensions = map[string]bool{
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true, ".heic": true, ".avif": true,
+	".mp4": true, ".m4v": true, ".mkv": true, ".mov": true, ".avi": true, ".webm": true,
+	".mp3": true, ".m4a": true, ".aac": true, ".ogg": true, ".opus": true, ".flac": true,
+	".zip": true, ".gz": true, ".tgz": true, ".bz2": true, ".xz": true, ".zst": true, ".7z": true, ".rar": true,
+	".docx": true, ".xlsx": true, ".pptx": true, ".odt": true, ".ods": true, ".epub": true,
+}
+
+// isCompressedContent returns true if most of the data in dir (by size)
+// is stored in already compressed file formats
+func isCompressedContent(dir string) (bool, error) {
+	var total, compressed int64
+	err := filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		total += info.Size()
+		if compressedExtensions[strings.ToLower(filepath.Ext(file))] {
+			compressed += info.Size()
 		}
 		return nil
 	})
+	if err != nil {
+		return false, fmt.Errorf("failed to check content of %s: %w", dir, err)
+	}
+	return total > 0 && compressed*2 > total, nil
+}
+
+// readTar extracts an uncompressed tar archive into a directory
+func readTar(reader io.Reader, dir string) error {
+	logger := newLogger("restore")
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		// prevent paths outside the target directory (also through symlinks of previous entries)
+		file := filepath.Join(dir, filepath.FromSlash(header.Name))
+		if !isBelow(dir, file) {
+			return fmt.Errorf("invalid path in archive: %s", header.Name)
+		}
+		if err = checkParents(dir, file); err != nil {
+			return fmt.Errorf("invalid path in archive: %s: %w", header.Name, err)
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			// existing symlinks are replaced to not create files outside the target directory
+			if info, err := os.Lstat(file); err == nil && info.Mode()&os.ModeSymlink != 0 {
+				_ = os.Remove(file)
+			}
+			err = os.MkdirAll(file, os.FileMode(header.Mode))
+			if err != nil {
+				return fmt.Errorf("failed to create %s: %w", file, err)
+			}
+
+		case tar.TypeSymlink:
+			target := header.Linkname
+			if !filepath.IsAbs(target) {
+				target = filepath.Join(filepath.Dir(file), filepath.FromSlash(target))
+			}
+			if filepath.IsAbs(header.Linkname) || !isBelow(dir, target) {
+				logger.Warn("-> skip symlink outside of the target directory", "file", header.Name, "target", header.Linkname)
+				continue
+			}
+			_ = os.Remove(file)
+			err = os.Symlink(header.Linkname, file)
+			if err != nil {
+				return fmt.Errorf("failed to create symlink %s: %w", file, err)
+			}
+
+		case tar.TypeReg:
+			err = os.MkdirAll(filepath.Dir(file), os.ModePerm)
+			if err != nil {
+				return fmt.Errorf("failed to create %s: %w", filepath.Dir(file), err)
+			}
+
+			// existing symlinks are replaced instead of writing to their target
+			if info, err := os.Lstat(file); err == nil && info.Mode()&os.ModeSymlink != 0 {
+				_ = os.Remove(file)
+			}
+			f, err := os.OpenFile(file, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.FileMode(header.Mode))
+			if err != nil {
+				return fmt.Errorf("failed to create %s: %w", file, err)
+			}
+			size, err := io.Copy(f, tarReader)
+			f.Close()
+			if err != nil {
+				return fmt.Errorf("failed to extract %s: %w", file, err)
+			}
+			logger.Log(context.Background(), fileLogLevel, "-> restored file", "file", header.Name, "size", size)
+
+		default:
+			// other types (devices, fifos) are not restored
+			continue
+		}
+
+		// restore ownership and modification time (ignore errors if not permitted)
+		_ = os.Lchown(file, header.Uid, header.Gid)
+		if header.Typeflag != tar.TypeSymlink {
+			_ = os.Chtimes(file, header.ModTime, header.ModTime)
+		}
+	}
+}
+
+// isBelow returns true if file is dir or inside of it (only by the path)
+func isBelow(dir, file string) bool {
+	dir = filepath.Clean(dir)
+	file = filepath.Clean(file)
+	return file == dir || strings.HasPrefix(file, dir+string(os.PathSeparator)) || dir == string(os.PathSeparator)
+}
+
+// checkParents of file below dir and fail if any existing parent is a symlink
+func checkParents(dir, file string) error {
+	rel, err := filepath.Rel(dir, filepath.Dir(file))
+	if err != nil || rel == "." {
+		return err
+	}
+
+	current := dir
+	for _, part := range strings.Split(rel, string(os.PathSeparator)) {
+		current = filepath.Join(current, part)
+		info, err := os.Lstat(current)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("parent %s is a symlink", current)
+		}
+	}
+	return nil
+}
+
+// formatSize in a human readable format
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+// parseSize of a human readable format (e.g. 500M, 10G) in bytes
+func parseSize(input string) (int64, error) {
+	value := strings.ToUpper(strings.TrimSpace(input))
+	value = strings.TrimSuffix(strings.TrimSuffix(value, "B"), "I")
+
+	multiplier := int64(1)
+	if len(value) > 0 {
+		if index := strings.IndexByte("KMGTPE", value[len(value)-1]); index >= 0 {
+			for i := 0; i <= index; i++ {
+				multiplier *= 1024
+			}
+			value = value[:len(value)-1]
+		}
+	}
+
+	size, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || size < 0 || math.IsNaN(size) || math.IsInf(size, 0) {
+		return 0, fmt.Errorf("invalid size %q", input)
+	}
+	return int64(size * float64(multiplier)), nil
 }
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+		err      bool
+	}{
+		{"0", 0, false},
+		{"1024", 1024, false},
+		{"100B", 100, false},
+		{"1K", 1024, false},
+		{"1kb", 1024, false},
+		{"1KiB", 1024, false},
+		{"500M", 500 << 20, false},
+		{"1.5G", 3 << 29, false},
+		{" 10 GB ", 10 << 30, false},
+		{"2T", 2 << 40, false},
+		{"1P", 1 << 50, false},
+		{"1E", 1 << 60, false},
+		{"", 0, true},
+		{"G", 0, true},
+		{"-1G", 0, true},
+		{"10X", 0, true},
+		{"NaN", 0, true},
+		{"Inf", 0, true},
+	}
+	for _, test := range tests {
+		size, err := parseSize(test.input)
+		if (err != nil) != test.err {
+			t.Errorf("parseSize(%q) error = %v, expected error %v", test.input, err, test.err)
+			continue
+		}
+		if size != test.expected {
+			t.Errorf("parseSize(%q) = %d, expected %d", test.input, size, test.expected)
+		}
+	}
+}
+
+func TestReadTarSymlinks(t *testing.T) {
+	// tar archive with the given members (content of regular files is the name)
+	archive := func(headers ...tar.Header) *bytes.Buffer {
+		var buffer bytes.Buffer
+		writer := tar.NewWriter(&buffer)
+		for _, header := range headers {
+			header.Mode = 0644
+			if header.Typeflag == tar.TypeReg {
+				header.Size = int64(len(header.Name))
+			}
+			if err := writer.WriteHeader(&header); err != nil {
+				t.Fatal(err)
+			}
+			if header.Typeflag == tar.TypeReg {
+				_, _ = writer.Write([]byte(header.Name))
+			}
+		}
+		_ = writer.Close()
+		return &buffer
+	}
+
+	tests := []struct {
+		name    string
+		headers []tar.Header
+		err     bool
+	}{
+		{"symlink inside", []tar.Header{
+			{Typeflag: tar.TypeReg, Name: "file"},
+			{Typeflag: tar.TypeSymlink, Name: "link", Linkname: "file"},
+		}, false},
+		{"absolute symlink", []tar.Header{
+			{Typeflag: tar.TypeSymlink, Name: "link", Linkname: "/etc"},
+		}, false},
+		{"escaping symlink", []tar.Header{
+			{Typeflag: tar.TypeSymlink, Name: "dir/link", Linkname: "../../outside"},
+		}, false},
+		{"file through symlink", []tar.Header{
+			{Typeflag: tar.TypeDir, Name: "dir"},
+			{Typeflag: tar.TypeSymlink, Name: "link", Linkname: "dir"},
+			{Typeflag: tar.TypeReg, Name: "link/file"},
+		}, true},
+		{"escaping path", []tar.Header{
+			{Typeflag: tar.TypeReg, Name: "../outside/file"},
+		}, true},
+	}
+	for _, test := range tests {
+		base := t.TempDir()
+		dir := filepath.Join(base, "target")
+		outside := filepath.Join(base, "outside")
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.MkdirAll(outside, 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		err := readTar(archive(test.headers...), dir)
+		if (err != nil) != test.err {
+			t.Errorf("%s: readTar() error = %v, expected error %v", test.name, err, test.err)
+		}
+		for _, header := range test.headers {
+			if header.Typeflag != tar.TypeSymlink {
+				continue
+			}
+			target, err := os.Readlink(filepath.Join(dir, header.Name))
+			if filepath.IsAbs(header.Linkname) || header.Linkname == "../../outside" {
+				if err == nil {
+					t.Errorf("%s: symlink %s -> %s created", test.name, header.Name, target)
+				}
+			} else if err != nil && !test.err {
+				t.Errorf("%s: symlink %s not created: %v", test.name, header.Name, err)
+			}
+		}
+		if entries, _ := os.ReadDir(outside); len(entries) > 0 {
+			t.Errorf("%s: files written outside of target directory", test.name)
+		}
+	}
+
+	// symlinks of previous archives are not followed
+	base := t.TempDir()
+	dir := filepath.Join(base, "target")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(base, filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(base, "file"), []byte("original"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(base, "file"), filepath.Join(dir, "file")); err != nil {
+		t.Fatal(err)
+	}
+	if err := readTar(archive(tar.Header{Typeflag: tar.TypeReg, Name: "link/file"}), dir); err == nil {
+		t.Error("readTar() followed symlink of previous archive")
+	}
+	if err := readTar(archive(tar.Header{Typeflag: tar.TypeReg, Name: "file"}), dir); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(base, "file")); string(data) != "original" {
+		t.Error("readTar() wrote to target of existing symlink")
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// blackoutWindow of the day (minutes since midnight) on the selected weekdays.
+// Windows with an end before the start continue on the next day.
+type blackoutWindow struct {
+	days  [7]bool
+	start int
+	end   int
+}
+
+// weekdayNames used in blackout windows
+var weekdayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// parseBlackoutWindows from a list of "[<day>[-<day>]] HH:MM-HH:MM" entries (e.g. "Mon-Fri 08:00-18:00")
+func parseBlackoutWindows(value string) ([]blackoutWindow, error) {
+	var windows []blackoutWindow
+	for _, entry := range splitList(value) {
+		window, err := parseBlackoutWindow(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid blackout window %s: %w", entry, err)
+		}
+		windows = append(windows, window)
+	}
+	return windows, nil
+}
+
+// parseBlackoutWindow entry
+func parseBlackoutWindow(entry string) (blackoutWindow, error) {
+	var window blackoutWindow
+
+	fields := strings.Fields(entry)
+	switch len(fields) {
+	case 1:
+		window.days = [7]bool{true, true, true, true, true, true, true}
+	case 2:
+		first, last, _ := strings.Cut(strings.ToLower(fields[0]), "-")
+		if last == "" {
+			last = first
+		}
+		start, end := indexOf(weekdayNames, first), indexOf(weekdayNames, last)
+		if start < 0 || end < 0 {
+			return window, fmt.Errorf("unknown day %s", fields[0])
+		}
+		for day := start; ; day = (day + 1) % 7 {
+			window.days[day] = true
+			if day == end {
+				break
+			}
+		}
+	default:
+		return window, fmt.Errorf("expected [days] HH:MM-HH:MM")
+	}
+
+	start, end, ok := strings.Cut(fields[len(fields)-1], "-")
+	if !ok {
+		return window, fmt.Errorf("expected time range HH:MM-HH:MM")
+	}
+	var err error
+	if window.start, err = parseClock(start); err != nil {
+		return window, err
+	}
+	if window.end, err = parseClock(end); err != nil {
+		return window, err
+	}
+	if window.start == window.end {
+		return window, fmt.Errorf("empty time range")
+	}
+	return window, nil
+}
+
+// parseClock time HH:MM as minutes since midnight
+func parseClock(value string) (int, error) {
+	clock, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %s", value)
+	}
+	return clock.Hour()*60 + clock.Minute(), nil
+}
+
+// indexOf value in list (-1 if not found)
+func indexOf(list []string, value string) int {
+	for i, entry := range list {
+		if entry == value {
+			return i
+		}
+	}
+	return -1
+}
+
+// until returns the end of the window if it contains the given time
+func (w blackoutWindow) until(t time.Time) (time.Time, bool) {
+	minutes := t.Hour()*60 + t.Minute()
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	end := midnight.Add(time.Duration(w.end) * time.Minute)
+
+	if w.start < w.end {
+		return end, w.days[t.Weekday()] && minutes >= w.start && minutes < w.end
+	}
+	// window continues on the next day
+	if w.days[t.Weekday()] && minutes >= w.start {
+		return end.AddDate(0, 0, 1), true
+	}
+	return end, w.days[(t.Weekday()+6)%7] && minutes < w.end
+}
+
+// blackout windows in which scheduled tasks are skipped or deferred
+type blackout struct {
+	windows  []blackoutWindow
+	deferRun bool
+	location *time.Location
+	logger   Logger
+
+	mutex sync.Mutex
+	// timers of deferred tasks by name (stopped together with the schedule)
+	timers  map[string]*time.Timer
+	stopped bool
+	// running deferred tasks
+	running sync.WaitGroup
+}
+
+// newBlackout for the given windows (nil if no windows are given)
+func newBlackout(value string, deferRun bool, location *time.Location, logger Logger) (*blackout, error) {
+	windows, err := parseBlackoutWindows(value)
+	if err != nil || len(windows) == 0 {
+		return nil, err
+	}
+	return &blackout{
+		windows:  windows,
+		deferRun: deferRun,
+		location: location,
+		logger:   logger,
+		timers:   make(map[string]*time.Timer),
+	}, nil
+}
+
+// until returns the end of the blackout containing the given time
+// (connected windows are merged, limited to one week for permanent blackouts)
+func (b *blackout) until(t time.Time) (time.Time, bool) {
+	end, active := t, false
+	limit := t.AddDate(0, 0, 7)
+	for changed := true; changed && end.Before(limit); {
+		changed = false
+		for _, window := range b.windows {
+			if until, ok := window.until(end); ok && until.After(end) {
+				end, active, changed = until, true, true
+			}
+		}
+	}
+	return end, active
+}
+
+// skip returns true if the task is in a blackout window.
+// The task is started at the end of the window if deferring is enabled.
+func (b *blackout) skip(name string, task func()) bool {
+	if b == nil {
+		return false
+	}
+	now := time.Now().In(b.location)
+	end, active := b.until(now)
+	if !active {
+		b.logger.Debug("no blackout window active", "task", name)
+		return false
+	}
+
+	if !b.deferRun {
+		b.logger.Printf("%s skipped (blackout window until %s)", name, end.Format(time.RFC3339))
+		return true
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.stopped {
+		return true
+	}
+	if b.timers[name] != nil {
+		b.logger.Printf("%s skipped (already deferred to %s)", name, end.Format(time.RFC3339))
+		return true
+	}
+
+	b.logger.Printf("%s deferred to %s (blackout window)", name, end.Format(time.RFC3339))
+	b.timers[name] = time.AfterFunc(end.Sub(now), func() {
+		b.mutex.Lock()
+		if b.stopped {
+			b.mutex.Unlock()
+			return
+		}
+		delete(b.timers, name)
+		b.running.Add(1)
+		b.mutex.Unlock()
+
+		defer b.running.Done()
+		task()
+	})
+	return true
+}
+
+// stop all deferred tasks that are not started yet. The returned channel is
+// closed once the already started deferred tasks are finished.
+func (b *blackout) stop() <-chan struct{} {
+	done := make(chan struct{})
+	if b == nil {
+		close(done)
+		return done
+	}
+
+	b.mutex.Lock()
+	b.stopped = true
+	for name, timer := range b.timers {
+		timer.Stop()
+		delete(b.timers, name)
+	}
+	b.mutex.Unlock()
+
+	go func() {
+		b.running.Wait()
+		close(done)
+	}()
+	return done
+}
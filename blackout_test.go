@@ -0,0 +1,101 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseBlackoutWindow(t *testing.T) {
+	all := [7]bool{true, true, true, true, true, true, true}
+	tests := []struct {
+		entry    string
+		expected blackoutWindow
+		err      bool
+	}{
+		{"08:00-18:00", blackoutWindow{days: all, start: 8 * 60, end: 18 * 60}, false},
+		{"Mon-Fri 08:00-18:00", blackoutWindow{days: [7]bool{false, true, true, true, true, true, false}, start: 8 * 60, end: 18 * 60}, false},
+		{"sat 22:30-02:00", blackoutWindow{days: [7]bool{false, false, false, false, false, false, true}, start: 22*60 + 30, end: 2 * 60}, false},
+		{"Fri-Mon 00:00-23:59", blackoutWindow{days: [7]bool{true, true, false, false, false, true, true}, start: 0, end: 23*60 + 59}, false},
+		{"08:00-08:00", blackoutWindow{}, true},
+		{"Funday 08:00-18:00", blackoutWindow{}, true},
+		{"08:00", blackoutWindow{}, true},
+		{"25:00-26:00", blackoutWindow{}, true},
+		{"Mon Tue 08:00-18:00", blackoutWindow{}, true},
+	}
+	for _, test := range tests {
+		window, err := parseBlackoutWindow(test.entry)
+		if (err != nil) != test.err {
+			t.Errorf("parseBlackoutWindow(%q) error = %v, expected error %v", test.entry, err, test.err)
+			continue
+		}
+		if !test.err && window != test.expected {
+			t.Errorf("parseBlackoutWindow(%q) = %+v, expected %+v", test.entry, window, test.expected)
+		}
+	}
+}
+
+func TestBlackoutUntil(t *testing.T) {
+	// 2024-01-01 is a Monday
+	date := func(day, hour, minute int) time.Time {
+		return time.Date(2024, 1, day, hour, minute, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		windows  string
+		now      time.Time
+		expected time.Time
+		active   bool
+	}{
+		{"08:00-18:00", date(1, 7, 59), date(1, 7, 59), false},
+		{"08:00-18:00", date(1, 8, 0), date(1, 18, 0), true},
+		{"08:00-18:00", date(1, 18, 0), date(1, 18, 0), false},
+		// window across midnight before and after midnight
+		{"22:00-02:00", date(1, 23, 0), date(2, 2, 0), true},
+		{"22:00-02:00", date(2, 1, 59), date(2, 2, 0), true},
+		{"22:00-02:00", date(2, 2, 0), date(2, 2, 0), false},
+		// the part after midnight belongs to the day of the start
+		{"Sun 22:00-02:00", date(1, 1, 0), date(1, 2, 0), true},
+		{"Sun 22:00-02:00", date(2, 1, 0), date(2, 1, 0), false},
+		{"Mon-Fri 08:00-18:00", date(6, 10, 0), date(6, 10, 0), false},
+		// connected windows are merged
+		{"08:00-12:00,12:00-14:00", date(1, 9, 0), date(1, 14, 0), true},
+		{"20:00-00:00,00:00-06:00", date(1, 21, 0), date(2, 6, 0), true},
+		// permanent blackouts end after about one week
+		{"00:00-12:00,12:00-00:00", date(1, 9, 0), date(9, 0, 0), true},
+	}
+	for _, test := range tests {
+		b, err := newBlackout(test.windows, false, time.UTC, newLogger("test"))
+		if err != nil {
+			t.Fatalf("newBlackout(%q) failed: %v", test.windows, err)
+		}
+		end, active := b.until(test.now)
+		if active != test.active || !end.Equal(test.expected) {
+			t.Errorf("until(%s) with %q = %s, %v, expected %s, %v",
+				test.now, test.windows, end, active, test.expected, test.active)
+		}
+	}
+}
+
+func TestBlackoutStopDeferred(t *testing.T) {
+	b, err := newBlackout("00:00-12:00,12:00-00:00", true, time.UTC, newLogger("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !b.skip("task", func() { t.Error("deferred task started after stop") }) {
+		t.Fatal("task not skipped in blackout window")
+	}
+	if len(b.timers) != 1 {
+		t.Fatalf("expected 1 deferred task, got %d", len(b.timers))
+	}
+
+	select {
+	case <-b.stop():
+	case <-time.After(time.Second):
+		t.Fatal("stop did not finish")
+	}
+	if len(b.timers) != 0 {
+		t.Errorf("expected no deferred tasks after stop, got %d", len(b.timers))
+	}
+	if !b.skip("task", func() { t.Error("task deferred after stop") }) || len(b.timers) != 0 {
+		t.Error("task deferred after stop")
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cast"
+)
+
+// CassandraConnection used for snapshot backups of Cassandra/ScyllaDB
+type CassandraConnection struct {
+	Config DatabaseConfig
+}
+
+// NewCassandraConnection from the given configuration
+func NewCassandraConnection(config DatabaseConfig) *CassandraConnection {
+	if config.Port == 0 {
+		config.Port = 7199
+	}
+
+	return &CassandraConnection{
+		Config: config,
+	}
+}
+
+// passwordFile for nodetool (keeps the password out of the process list).
+// An empty name is returned if no user is configured.
+func (c *CassandraConnection) passwordFile() (string, error) {
+	if c.Config.Username == "" {
+		return "", nil
+	}
+
+	passwordFile, err := os.CreateTemp("", "nodetool_*.password")
+	if err != nil {
+		return "", fmt.Errorf("failed to create nodetool password file: %w", err)
+	}
+
+	// JMX password file format: <username> <password>
+	_, err = fmt.Fprintf(passwordFile, "%s %s\n", c.Config.Username, c.Config.Password)
+	passwordFile.Close()
+	if err != nil {
+		os.Remove(passwordFile.Name())
+		return "", fmt.Errorf("failed to write nodetool password file: %w", err)
+	}
+	return passwordFile.Name(), nil
+}
+
+// command for nodetool with connection arguments
+func (c *CassandraConnection) command(passwordFile string, args ...string) *exec.Cmd {
+	cmdArgs := []string{"-h", c.Config.Host, "-p", cast.ToString(c.Config.Port)}
+	if passwordFile != "" {
+		cmdArgs = append(cmdArgs, "-u", c.Config.Username, "-pwf", passwordFile)
+	}
+
+	cmd := exec.Command("nodetool", append(cmdArgs, args...)...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	return cmd
+}
+
+// WaitForConnection for a maximum of duration
+func (c *CassandraConnection) WaitForConnection(duration time.Duration) error {
+	passwordFile, err := c.passwordFile()
+	if err != nil {
+		return err
+	}
+	if passwordFile != "" {
+		defer os.Remove(passwordFile)
+	}
+
+	// ticker to check every second for a connection
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+
+	timeoutExceeded := time.After(duration)
+	for {
+		select {
+		case <-timeoutExceeded:
+			return errors.New("timeout while trying to connect to cassandra")
+
+		case <-ticker.C:
+			cmd := c.command(passwordFile, "info")
+			cmd.Stdout = nil
+			cmd.Stderr = nil
+			if cmd.Run() == nil {
+				return nil
+			}
+		}
+	}
+}
+
+// Init is not required for cassandra
+func (c *CassandraConnection) Init() error {
+	c.Config.logger().Print("cassandra -> skip user and database creation")
+	return nil
+}
+
+// BackupFilename of the snapshot archive inside the backup
+func (c *CassandraConnection) BackupFilename() string {
+	return "snapshot.tar"
+}
+
+// Backup creates a snapshot and writes all snapshot directories to the given writer
+func (c *CassandraConnection) Backup(writer io.Writer) error {
+	tag := fmt.Sprintf("housekeeper_%d", time.Now().Unix())
+
+	passwordFile, err := c.passwordFile()
+	if err != nil {
+		return err
+	}
+	if passwordFile != "" {
+		defer os.Remove(passwordFile)
+	}
+
+	args := []string{"snapshot", "-t", tag}
+	if c.Config.Database != "" {
+		args = append(args, c.Config.Database)
+	}
+	err = c.command(passwordFile, args...).Run()
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot: %w", err)
+	}
+
+	// always remove snapshot again
+	defer func() {
+		err := c.command(passwordFile, "clearsnapshot", "-t", tag).Run()
+		if err != nil {
+			c.Config.logger().Error("failed to clear snapshot", "snapshot", tag, "error", err)
+		}
+	}()
+
+	// snapshots are located in <data>/<keyspace>/<table>/snapshots/<tag>
+	snapshotDirs, err := filepath.Glob(filepath.Join(c.Config.SnapshotDirectory, "*", "*", "snapshots", tag))
+	if err != nil {
+		return fmt.Errorf("failed to find snapshot directories: %w", err)
+	}
+	if len(snapshotDirs) == 0 {
+		return fmt.Errorf("no snapshot directories found in %s", c.Config.SnapshotDirectory)
+	}
+
+	tarWriter := tar.NewWriter(writer)
+	defer tarWriter.Close()
+
+	for _, dir := range snapshotDirs {
+		// store as <keyspace>/<table>
+		table := filepath.Dir(filepath.Dir(dir))
+		prefix, err := filepath.Rel(c.Config.SnapshotDirectory, table)
+		if err != nil {
+			return fmt.Errorf("failed to get relative path: %w", err)
+		}
+
+		err = addDirToTar(tarWriter, dir, prefix)
+		if err != nil {
+			return fmt.Errorf("failed to archive snapshot %s: %w", dir, err)
+		}
+	}
+	return nil
+}
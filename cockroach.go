@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/spf13/cast"
+)
+
+// CockroachConnection used for initialization and backup of CockroachDB clusters
+type CockroachConnection struct {
+	Config DatabaseConfig
+
+	// Hosts of all cluster nodes (host:port)
+	Hosts []string
+}
+
+// NewCockroachConnection from the given configuration
+func NewCockroachConnection(config DatabaseConfig) *CockroachConnection {
+	if config.Port == 0 {
+		config.Port = 26257
+	}
+	if config.RootUsername == "" {
+		config.RootUsername = "root"
+	}
+
+	conf := CockroachConnection{
+		Config: config,
+	}
+
+	// DB_HOST may contain a comma separated list of cluster nodes
+	for _, host := range strings.Split(config.Host, ",") {
+		host = strings.TrimSpace(host)
+		if host == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(host); err != nil {
+			host = net.JoinHostPort(host, cast.ToString(config.Port))
+		}
+		conf.Hosts = append(conf.Hosts, host)
+	}
+	return &conf
+}
+
+// connectionString for the given cluster node
+func (c *CockroachConnection) connectionString(host, database string) string {
+	// if root password is missing create connection from user credentials
+	if c.Config.RootPassword != "" {
+		return fmt.Sprintf("postgres://%s:%s@%s/%s?%s",
+			c.Config.RootUsername, c.Config.RootPassword, host, database, postgresSSLQuery(c.Config).Encode())
+	}
+	return fmt.Sprintf("postgres://%s:%s@%s/%s?%s",
+		c.Config.Username, c.Config.Password, host, database, postgresSSLQuery(c.Config).Encode())
+}
+
+// open connection to the first reachable cluster node
+func (c *CockroachConnection) open(database string) (*sql.DB, error) {
+	var errs []error
+	for _, host := range c.Hosts {
+		db, err := sql.Open("postgres", c.connectionString(host, database))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", host, err))
+			continue
+		}
+
+		err = db.Ping()
+		if err != nil {
+			db.Close()
+			errs = append(errs, fmt.Errorf("%s: %w", host, err))
+			continue
+		}
+		return db, nil
+	}
+	return nil, fmt.Errorf("no cluster node reachable: %w", errors.Join(errs...))
+}
+
+// WaitForConnection for a maximum of duration
+func (c *CockroachConnection) WaitForConnection(duration time.Duration) error {
+	// ticker to check every second for a connection
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+
+	timeoutExceeded := time.After(duration)
+	for {
+		select {
+		case <-timeoutExceeded:
+			return errors.New("timeout while trying to connect to database")
+
+		case <-ticker.C:
+			db, err := c.open("")
+			if err == nil {
+				db.Close()
+				return nil
+			}
+		}
+	}
+}
+
+// Init database if root password is given
+func (c *CockroachConnection) Init() error {
+	if c.Config.RootPassword == "" {
+		c.Config.logger().Print("no root password given -> skip user and database creation")
+		return nil
+	}
+	c.Config.logger().Printf("initialize database ...")
+
+	conn, err := c.open("")
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	db := debugDB{conn, c.Config}
+
+	_, err = db.Exec(fmt.Sprintf("CREATE USER IF NOT EXISTS %s WITH LOGIN PASSWORD %s",
+		pq.QuoteIdentifier(c.Config.Username), pq.QuoteLiteral(c.Config.Password)))
+	if err != nil {
+		return fmt.Errorf("failed to create user: %w", err)
+	}
+	c.Config.logger().Printf("> user %s ensured", c.Config.Username)
+
+	_, err = db.Exec(fmt.Sprintf("CREATE DATABASE IF NOT EXISTS %s OWNER %s",
+		pq.QuoteIdentifier(c.Config.Database), pq.QuoteIdentifier(c.Config.Username)))
+	if err != nil {
+		return fmt.Errorf("failed to create database: %w", err)
+	}
+	c.Config.logger().Printf("> database %s ensured", c.Config.Database)
+
+	// ensure user has permissions in database
+	_, err = db.Exec(fmt.Sprintf("GRANT ALL ON DATABASE %s TO %s",
+		pq.QuoteIdentifier(c.Config.Database), pq.QuoteIdentifier(c.Config.Username)))
+	if err != nil {
+		return fmt.Errorf("failed to grant database permissions: %w", err)
+	}
+
+	return nil
+}
+
+// BackupFilename of the database dump inside the backup
+func (c *CockroachConnection) BackupFilename() string {
+	return "database.sql"
+}
+
+// Backup database to the given writer.
+// A logical SQL dump is created (like the removed `cockroach dump`) inside
+// a single read only transaction to get a consistent snapshot of the cluster.
+func (c *CockroachConnection) Backup(writer io.Writer) error {
+	db, err := c.open(c.Config.Database)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	buf := bufio.NewWriter(writer)
+
+	// schema (constraints are added after the data)
+	rows, err := tx.Query("SHOW CREATE ALL TABLES")
+	if err != nil {
+		return fmt.Errorf("failed to read schema: %w", err)
+	}
+	var alterStatements []string
+	for rows.Next() {
+		var statement string
+		if err = rows.Scan(&statement); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to read schema: %w", err)
+		}
+		if strings.HasPrefix(statement, "ALTER TABLE") {
+			alterStatements = append(alterStatements, statement)
+		} else {
+			fmt.Fprintln(buf, statement)
+		}
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("failed to read schema: %w", err)
+	}
+
+	// data of tables
+	tables, err := c.tables(tx)
+	if err != nil {
+		return err
+	}
+	for _, table := range tables {
+		err = c.dumpTable(tx, buf, table)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, statement := range alterStatements {
+		fmt.Fprintln(buf, statement)
+	}
+
+	return buf.Flush()
+}
+
+// tables returns all base tables of the database
+func (c *CockroachConnection) tables(tx *sql.Tx) ([]string, error) {
+	rows, err := tx.Query(`SELECT table_schema, table_name FROM information_schema.tables
+		WHERE table_type = 'BASE TABLE' AND table_schema NOT IN ('crdb_internal', 'information_schema', 'pg_catalog', 'pg_extension')
+		ORDER BY table_schema, table_name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+	defer rows.Close()
+
+	var tables []string
+	for rows.Next() {
+		var schema, table string
+		if err = rows.Scan(&schema, &table); err != nil {
+			return nil, fmt.Errorf("failed to list tables: %w", err)
+		}
+		tables = append(tables, pq.QuoteIdentifier(schema)+"."+pq.QuoteIdentifier(table))
+	}
+	return tables, rows.Err()
+}
+
+// dumpTable writes INSERT statements for all rows of the given table
+func (c *CockroachConnection) dumpTable(tx *sql.Tx, writer io.Writer, table string) error {
+	rows, err := tx.Query("SELECT * FROM " + table)
+	if err != nil {
+		return fmt.Errorf("failed to read table %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return fmt.Errorf("failed to read columns of %s: %w", table, err)
+	}
+
+	columns := make([]string, len(columnTypes))
+	for idx, column := range columnTypes {
+		columns[idx] = pq.QuoteIdentifier(column.Name())
+	}
+	prefix := fmt.Sprintf("INSERT INTO %s (%s) VALUES (", table, strings.Join(columns, ", "))
+
+	values := make([]any, len(columnTypes))
+	pointers := make([]any, len(columnTypes))
+	for idx := range values {
+		pointers[idx] = &values[idx]
+	}
+
+	literals := make([]string, len(columnTypes))
+	for rows.Next() {
+		if err = rows.Scan(pointers...); err != nil {
+			return fmt.Errorf("failed to read table %s: %w", table, err)
+		}
+		for idx, value := range values {
+			literals[idx] = cockroachLiteral(value, columnTypes[idx].DatabaseTypeName())
+		}
+		_, err = fmt.Fprintf(writer, "%s%s);\n", prefix, strings.Join(literals, ", "))
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// cockroachLiteral converts a scanned value to a SQL literal
+func cockroachLiteral(value any, typeName string) string {
+	switch v := value.(type) {
+	case nil:
+		return "NULL"
+	case bool:
+		return strconv.FormatBool(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case time.Time:
+		return pq.QuoteLiteral(v.Format(time.RFC3339Nano))
+	case []byte:
+		if typeName == "BYTEA" || typeName == "BYTES" {
+			return fmt.Sprintf("'\\x%s'::BYTES", hex.EncodeToString(v))
+		}
+		return pq.QuoteLiteral(string(v))
+	default:
+		return pq.QuoteLiteral(fmt.Sprint(v))
+	}
+}
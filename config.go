@@ -1,99 +1,895 @@
 package main
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"log/slog"
+	"maps"
 	"os"
+	"os/exec"
+	"path/filepath"
 	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"filippo.io/age"
 	"github.com/spf13/cast"
 )
 
 type DatabaseConfig struct {
+	Type string `conf:"DB_TYPE,postgres,required"`
 	Host string `conf:"DB_HOST"`
-	Port int    `conf:"DB_PORT,5432"`
+	Port int    `conf:"DB_PORT"`
 
-	RootUsername string `conf:"DB_ROOT_USER,postgres"`
+	WaitTimeout time.Duration `conf:"DB_WAIT_TIMEOUT,1m"`
+
+	RootUsername string `conf:"DB_ROOT_USER"`
 	RootPassword string `conf:"DB_ROOT_PASSWORD"`
 
 	Username string `conf:"DB_USER_NAME"`
 	Password string `conf:"DB_USER_PASSWORD"`
 	Database string `conf:"DB_DATABASE"`
 
+	UpdatePassword bool `conf:"DB_USER_PASSWORD_UPDATE,false"`
+
+	SSLMode     string `conf:"DB_SSLMODE,disable"`
+	SSLRootCert string `conf:"DB_SSLROOTCERT"`
+	SSLCert     string `conf:"DB_SSLCERT"`
+	SSLKey      string `conf:"DB_SSLKEY"`
+
 	PgExtensions string `conf:"DB_PG_EXTENSIONS"`
+	InitSQLDir   string `conf:"INIT_SQL_DIR"`
+	Databases    string `conf:"DB_DATABASES"`
+	DumpFormat   string `conf:"DB_DUMP_FORMAT"`
+
+	DumpIncludeTables []string `conf:"DB_DUMP_INCLUDE_TABLES"`
+	DumpExcludeTables []string `conf:"DB_DUMP_EXCLUDE_TABLES"`
+
+	DumpSchemaOnly bool `conf:"BACKUP_DB_SCHEMA_ONLY,false"`
+	DumpDataOnly   bool `conf:"BACKUP_DB_DATA_ONLY,false"`
+
+	SnapshotRepository string `conf:"DB_SNAPSHOT_REPOSITORY"`
+	SnapshotDirectory  string `conf:"DB_SNAPSHOT_DIR"`
+
+	Neo4jOnlineBackup bool `conf:"DB_NEO4J_ONLINE_BACKUP,false"`
+
+	ExecContainer string `conf:"DB_EXEC_CONTAINER"`
+}
+
+// logger of the database component
+func (c DatabaseConfig) logger() Logger {
+	return newLogger("database", "type", c.Type)
+}
+
+// DatabaseUser with its own database
+type DatabaseUser struct {
+	Database string
+	Username string
+	Password string
+}
+
+// AdditionalDatabases parsed from list of database:user:password entries
+func (c *DatabaseConfig) AdditionalDatabases() ([]DatabaseUser, error) {
+	var users []DatabaseUser
+	for _, entry := range splitList(c.Databases) {
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+			return nil, fmt.Errorf("invalid database entry %s (expected database:user:password)", strings.SplitN(entry, ":", 2)[0])
+		}
+		users = append(users, DatabaseUser{
+			Database: parts[0],
+			Username: parts[1],
+			Password: parts[2],
+		})
+	}
+	return users, nil
+}
+
+// requiresCredentials returns true if the database type requires user credentials
+func (c *DatabaseConfig) requiresCredentials() bool {
+	switch c.Type {
+	case "sqlite", "elasticsearch", "etcd", "cassandra":
+		return false
+	default:
+		return true
+	}
+}
+
+// IsConfigured returns true if a database connection is configured
+func (c *DatabaseConfig) IsConfigured() bool {
+	if c.Type == "sqlite" {
+		return c.Database != ""
+	}
+	return c.Host != ""
 }
 
 type BackupConfig struct {
-	Database               bool   `conf:"BACKUP_DATABASE,false"`
-	DataDirectories        string `conf:"BACKUP_DATA_DIR"`
-	DataDirectoriesExclude string `conf:"BACKUP_DATA_EXCLUDE"`
+	Database               bool     `conf:"BACKUP_DATABASE,false"`
+	DatabaseAll            bool     `conf:"BACKUP_DATABASE_ALL,false"`
+	DatabaseGlobals        bool     `conf:"BACKUP_DATABASE_GLOBALS,false"`
+	DatabaseMode           string   `conf:"BACKUP_DATABASE_MODE,logical"`
+	WalArchive             bool     `conf:"BACKUP_WAL_ARCHIVE,false"`
+	AutoRestore            bool     `conf:"BACKUP_AUTO_RESTORE,false"`
+	DataDirectories        []string `conf:"BACKUP_DATA_DIR"`
+	DataDirectoriesExclude []string `conf:"BACKUP_DATA_EXCLUDE"`
+	DataCompression        string   `conf:"BACKUP_DATA_COMPRESSION,gzip"`
+	DataStore              []string `conf:"BACKUP_DATA_STORE"`
+
+	DockerDiscovery bool     `conf:"BACKUP_DOCKER_DISCOVERY,false"`
+	DockerRoot      string   `conf:"BACKUP_DOCKER_ROOT"`
+	RestoreRestart  []string `conf:"BACKUP_RESTORE_RESTART"`
+
+	Incremental    bool `conf:"BACKUP_INCREMENTAL,false"`
+	IncrementalMax int  `conf:"BACKUP_INCREMENTAL_MAX,6"`
+
+	Schedule   string        `conf:"BACKUP_SCHEDULE,@daily"`
+	ScheduleTZ string        `conf:"BACKUP_SCHEDULE_TZ"`
+	CatchUp    bool          `conf:"BACKUP_CATCH_UP,true"`
+	Overlap    string        `conf:"BACKUP_OVERLAP,skip"`
+	Events     string        `conf:"BACKUP_EVENTS"`
+	Retries    int           `conf:"BACKUP_RETRIES,0"`
+	RetryDelay time.Duration `conf:"BACKUP_RETRY_DELAY,1m"`
+
+	Blackout      string `conf:"BACKUP_BLACKOUT"`
+	BlackoutDefer bool   `conf:"BACKUP_BLACKOUT_DEFER,false"`
+
+	Format       string `conf:"BACKUP_FORMAT,zip,required"`
+	ParityShards int    `conf:"BACKUP_PARITY_SHARDS,0"`
+	Report       bool   `conf:"BACKUP_REPORT,false"`
+
+	Hostname string `conf:"BACKUP_HOSTNAME"`
+	Labels   string `conf:"BACKUP_LABELS"`
+
+	Storage        string `conf:"BACKUP_STORAGE,/backup,required"`
+	StorageMaxSize string `conf:"BACKUP_STORAGE_MAX_SIZE"`
+	MinFreeSpace   string `conf:"BACKUP_MIN_FREE_SPACE"`
+
+	KeepLast      int `conf:"BACKUP_KEEP_LAST,0"`
+	RetentionDays int `conf:"BACKUP_RETENTION_DAYS,0"`
+	KeepDaily     int `conf:"BACKUP_KEEP_DAILY,0"`
+	KeepWeekly    int `conf:"BACKUP_KEEP_WEEKLY,0"`
+	KeepMonthly   int `conf:"BACKUP_KEEP_MONTHLY,0"`
+	KeepYearly    int `conf:"BACKUP_KEEP_YEARLY,0"`
 
-	Schedule string `conf:"BACKUP_SCHEDULE,@daily"`
+	Encryption     string `conf:"BACKUP_ENCRYPTION"`
+	EncryptionMode string `conf:"BACKUP_ENCRYPTION_MODE,archive"`
 
-	Storage string `conf:"BACKUP_STORAGE,/backup"`
+	AgeRecipients       []age.Recipient      `conf:"BACKUP_AGE_RECIPIENTS"`
+	AgeRecipientsFile   string               `conf:"BACKUP_AGE_RECIPIENTS_FILE"`
+	AgePassword         *age.ScryptRecipient `conf:"BACKUP_AGE_PASSWORD"`
+	AgePasswordIdentity *age.ScryptIdentity  `conf:"BACKUP_AGE_PASSWORD"`
+	AgeIdentities       []age.Identity       `conf:"BACKUP_AGE_IDENTITY"`
+	AgeIdentityFile     string               `conf:"BACKUP_AGE_IDENTITY_FILE"`
 
-	AgeRecipients []*age.X25519Recipient `conf:"BACKUP_AGE_RECIPIENTS"`
-	AgePassword   *age.ScryptRecipient   `conf:"BACKUP_AGE_PASSWORD"`
+	GPGRecipientsFile string `conf:"BACKUP_GPG_RECIPIENTS_FILE"`
+	GPGKeyFile        string `conf:"BACKUP_GPG_KEY_FILE"`
+	GPGPassphrase     string `conf:"BACKUP_GPG_PASSPHRASE"`
+
+	ResticRepository string `conf:"BACKUP_RESTIC_REPOSITORY"`
 
 	RClonePath   string `conf:"BACKUP_RCLONE_PATH"`
 	RCloneConfig string `conf:"BACKUP_RCLONE_CONFIG"`
+
+	RCloneMirrors      []string `conf:"BACKUP_RCLONE_MIRRORS"`
+	RCloneMirrorPolicy string   `conf:"BACKUP_RCLONE_MIRROR_POLICY,all"`
 }
 
-func (c *BackupConfig) ageRecipients() []age.Recipient {
-	var recipients []age.Recipient
-	for _, recipient := range c.AgeRecipients {
-		recipients = append(recipients, recipient)
+// format of new backup files (tar is a short form of tar.gz)
+func (c *BackupConfig) format() string {
+	if c.Format == "tar" {
+		return "tar.gz"
 	}
+	return c.Format
+}
+
+// labels parsed from list of key=value entries
+func (c *BackupConfig) labels() (map[string]string, error) {
+	labels := make(map[string]string)
+	for _, entry := range splitList(c.Labels) {
+		key, value, ok := strings.Cut(entry, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("invalid label %s (expected key=value)", entry)
+		}
+		labels[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return labels, nil
+}
+
+// hostname stored in the backup meta
+func (c *BackupConfig) hostname() string {
+	if c.Hostname != "" {
+		return c.Hostname
+	}
+	hostname, _ := os.Hostname()
+	return hostname
+}
+
+// scheduleLocation used for the backup schedule (local timezone of the container if not set)
+func (c *BackupConfig) scheduleLocation() (*time.Location, error) {
+	if c.ScheduleTZ == "" {
+		return time.Local, nil
+	}
+	location, err := time.LoadLocation(c.ScheduleTZ)
+	if err != nil {
+		return nil, fmt.Errorf("invalid backup schedule timezone %s: %w", c.ScheduleTZ, err)
+	}
+	return location, nil
+}
+
+// retryDelay before the given retry of a failed scheduled backup (doubled for every retry)
+func (c *BackupConfig) retryDelay(retry int) time.Duration {
+	delay := c.RetryDelay
+	for i := 1; i < retry && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryDelay)
+}
+
+// keepAll returns true if no count or time based retention policy is configured
+func (c *BackupConfig) keepAll() bool {
+	return c.KeepLast == 0 && c.RetentionDays == 0 &&
+		c.KeepDaily == 0 && c.KeepWeekly == 0 && c.KeepMonthly == 0 && c.KeepYearly == 0
+}
+
+func (c *BackupConfig) ageRecipients() ([]age.Recipient, error) {
+	recipients := append([]age.Recipient{}, c.AgeRecipients...)
 	if c.AgePassword != nil {
 		recipients = append(recipients, c.AgePassword)
 	}
-	return recipients
+
+	// file is read on every backup to allow key rotation without restart
+	if c.AgeRecipientsFile != "" {
+		fileRecipients, err := readAgeRecipients(c.AgeRecipientsFile)
+		if err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, fileRecipients...)
+	}
+	return recipients, nil
+}
+
+// readAgeRecipients from a file or all files of a directory (one recipient per line, comments allowed)
+func readAgeRecipients(path string) ([]age.Recipient, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read recipients file: %w", err)
+	}
+
+	files := []string{path}
+	if info.IsDir() {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read recipients directory: %w", err)
+		}
+		files = nil
+		for _, entry := range entries {
+			// skip hidden files (e.g. ..data of kubernetes/docker mounts)
+			if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+				continue
+			}
+			files = append(files, filepath.Join(path, entry.Name()))
+		}
+	}
+
+	var recipients []age.Recipient
+	for _, filename := range files {
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read recipients file: %w", err)
+		}
+		fileRecipients, err := parseAgeRecipients(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse recipients file %s: %w", filename, err)
+		}
+		recipients = append(recipients, fileRecipients...)
+	}
+	return recipients, nil
+}
+
+type MaintenanceConfig struct {
+	VacuumSchedule string   `conf:"MAINTENANCE_VACUUM_SCHEDULE"`
+	VacuumTables   []string `conf:"MAINTENANCE_VACUUM_TABLES"`
+	VacuumVerbose  bool     `conf:"MAINTENANCE_VACUUM_VERBOSE,false"`
+
+	ReindexSchedule string   `conf:"MAINTENANCE_REINDEX_SCHEDULE"`
+	ReindexIndexes  []string `conf:"MAINTENANCE_REINDEX_INDEXES"`
+
+	VolumePruneSchedule string   `conf:"MAINTENANCE_VOLUME_PRUNE_SCHEDULE"`
+	VolumePruneLabels   []string `conf:"MAINTENANCE_VOLUME_PRUNE_LABELS"`
+	VolumePruneDryRun   bool     `conf:"MAINTENANCE_VOLUME_PRUNE_DRY_RUN,false"`
+
+	ContainerCleanupSchedule string        `conf:"MAINTENANCE_CONTAINER_CLEANUP_SCHEDULE"`
+	ContainerCleanupAge      time.Duration `conf:"MAINTENANCE_CONTAINER_CLEANUP_AGE,24h"`
+
+	LogTruncateSchedule string `conf:"MAINTENANCE_LOG_TRUNCATE_SCHEDULE"`
+	LogMaxSize          string `conf:"MAINTENANCE_LOG_MAX_SIZE,100M"`
+	LogRotate           bool   `conf:"MAINTENANCE_LOG_ROTATE,false"`
+	DockerRoot          string `conf:"MAINTENANCE_DOCKER_ROOT"`
+
+	BuildCachePruneSchedule string `conf:"MAINTENANCE_BUILD_CACHE_PRUNE_SCHEDULE"`
+	BuildCacheKeepStorage   string `conf:"MAINTENANCE_BUILD_CACHE_KEEP_STORAGE,0"`
+	BuildCachePruneAll      bool   `conf:"MAINTENANCE_BUILD_CACHE_PRUNE_ALL,false"`
+
+	Blackout      string `conf:"MAINTENANCE_BLACKOUT"`
+	BlackoutDefer bool   `conf:"MAINTENANCE_BLACKOUT_DEFER,false"`
+}
+
+type NotifyConfig struct {
+	On   string   `conf:"NOTIFY_ON,always"`
+	URLs []string `conf:"NOTIFY_URLS"`
+
+	SlackWebhook     string `conf:"NOTIFY_SLACK_WEBHOOK"`
+	SlackFailureOnly bool   `conf:"NOTIFY_SLACK_FAILURE_ONLY,false"`
+
+	DiscordWebhook string `conf:"NOTIFY_DISCORD_WEBHOOK"`
+
+	GotifyURL   string `conf:"NOTIFY_GOTIFY_URL"`
+	GotifyToken string `conf:"NOTIFY_GOTIFY_TOKEN"`
+
+	HealthchecksURL string `conf:"HEALTHCHECKS_URL"`
+}
+
+type DockerConfig struct {
+	Host string `conf:"DOCKER_HOST,unix:///var/run/docker.sock,required"`
+}
+
+type APIConfig struct {
+	Listen           string   `conf:"API_LISTEN"`
+	Token            string   `conf:"API_TOKEN"`
+	HealthContainers []string `conf:"API_HEALTH_CONTAINERS"`
+	// HealthBackupMaxAge as duration or factor of the schedule interval (e.g. 1.5x)
+	HealthBackupMaxAge string `conf:"API_HEALTH_BACKUP_MAX_AGE"`
+}
+
+func (c *BackupConfig) ageIdentities() ([]age.Identity, error) {
+	identities := append([]age.Identity{}, c.AgeIdentities...)
+	if c.AgePasswordIdentity != nil {
+		identities = append(identities, c.AgePasswordIdentity)
+	}
+
+	if c.AgeIdentityFile != "" {
+		fileIdentities, err := readAgeIdentities(c.AgeIdentityFile)
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, fileIdentities...)
+	}
+	return identities, nil
+}
+
+// readAgeIdentities from a file with one identity per line (comments allowed)
+func readAgeIdentities(filename string) ([]age.Identity, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open identity file: %w", err)
+	}
+	defer file.Close()
+
+	identities, err := parseAgeIdentities(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse identity file %s: %w", filename, err)
+	}
+	return identities, nil
 }
 
 type Config struct {
-	Database DatabaseConfig
-	Backup   BackupConfig
+	Database    DatabaseConfig
+	Backup      BackupConfig
+	Maintenance MaintenanceConfig
+	Notify      NotifyConfig
+	API         APIConfig
+	Docker      DockerConfig
+	Log         LogConfig
+
+	ShutdownTimeout time.Duration `conf:"SHUTDOWN_TIMEOUT,5m"`
+
+	JobNames []string `conf:"BACKUP_JOBS"`
+	// Jobs with their own backup config (loaded by loadJobs)
+	Jobs []BackupJob
+}
+
+// BackupJob with a name and its own backup config
+type BackupJob struct {
+	Name string
+	// Prefix of the environment variables of the job
+	Prefix string
+	Config BackupConfig
+}
+
+// externalDatabaseTools required by database types that are not part of the image
+var externalDatabaseTools = map[string]string{
+	"cassandra": "nodetool",
+	"neo4j":     "neo4j-admin",
+}
+
+// jobNameRegex of valid job names (used in environment variable names)
+var jobNameRegex = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// jobIndexRegex matches environment variables of indexed jobs (BACKUP_<n>_*)
+var jobIndexRegex = regexp.MustCompile(`^BACKUP_([0-9]+)_`)
+
+// jobPrefix of environment variables of the given job
+func jobPrefix(name string) string {
+	return "BACKUP_JOB_" + strings.ToUpper(name) + "_"
+}
+
+// jobIndexes of indexed jobs defined in the environment, the secrets directory, the config file
+// or on the command line
+func jobIndexes() []int {
+	keys := append(envKeys(), slices.Collect(maps.Keys(configFileValues))...)
+	keys = append(keys, slices.Collect(maps.Keys(secretValues))...)
+	keys = append(keys, slices.Collect(maps.Keys(configOverrides))...)
+
+	var indexes []int
+	for _, key := range keys {
+		match := jobIndexRegex.FindStringSubmatch(key)
+		if match == nil {
+			continue
+		}
+		index, _ := strconv.Atoi(match[1])
+		if !slices.Contains(indexes, index) {
+			indexes = append(indexes, index)
+		}
+	}
+	slices.Sort(indexes)
+	return indexes
+}
+
+// load global config and backup jobs and report all invalid values at once
+func (c *Config) load() error {
+	return errors.Join(loadStruct(reflect.ValueOf(c).Elem()), c.loadJobs())
+}
+
+// loadJobs from environment and config file. Every BACKUP_* variable can be set for a job
+// with BACKUP_JOB_<NAME>_* (or BACKUP_<n>_* for indexed jobs) and falls back to the global value.
+func (c *Config) loadJobs() error {
+	var errs []error
+	for _, name := range c.JobNames {
+		if !jobNameRegex.MatchString(name) {
+			errs = append(errs, fmt.Errorf("invalid backup job name %s", name))
+			continue
+		}
+		errs = append(errs, c.loadJob(name, jobPrefix(name)))
+	}
+
+	// indexed jobs are named by BACKUP_<n>_NAME or their index
+	for _, index := range jobIndexes() {
+		prefix := fmt.Sprintf("BACKUP_%d_", index)
+		name, ok := lookupConfig(prefix + "NAME")
+		if !ok {
+			name = strconv.Itoa(index)
+		}
+		if !jobNameRegex.MatchString(name) {
+			errs = append(errs, fmt.Errorf("invalid backup job name %s", name))
+			continue
+		}
+		if slices.ContainsFunc(c.Jobs, func(job BackupJob) bool { return job.Name == name }) {
+			errs = append(errs, fmt.Errorf("duplicated backup job name %s", name))
+			continue
+		}
+		errs = append(errs, c.loadJob(name, prefix))
+	}
+	return errors.Join(errs...)
+}
+
+// loadJob with the given name from the environment variables with the given prefix
+func (c *Config) loadJob(name, prefix string) error {
+	lookup := func(key string) (string, bool) {
+		if value, ok := lookupConfig(prefix + strings.TrimPrefix(key, "BACKUP_")); ok {
+			return value, true
+		}
+		return lookupConfig(key)
+	}
+
+	job := BackupJob{Name: name, Prefix: prefix}
+	if err := loadStructFrom(reflect.ValueOf(&job.Config).Elem(), lookup); err != nil {
+		return jobErrors(name, err)
+	}
+
+	// backups of jobs are separated by a sub directory if no own location is given
+	if _, ok := lookupConfig(prefix + "STORAGE"); !ok {
+		job.Config.Storage = filepath.Join(job.Config.Storage, name)
+	}
+	if _, ok := lookupConfig(prefix + "RCLONE_PATH"); !ok && job.Config.RClonePath != "" {
+		job.Config.RClonePath = jobRemotePath(job.Config.RClonePath, name)
+	}
+	if _, ok := lookupConfig(prefix + "RCLONE_MIRRORS"); !ok {
+		for i, mirror := range job.Config.RCloneMirrors {
+			job.Config.RCloneMirrors[i] = jobRemotePath(mirror, name)
+		}
+	}
+	c.Jobs = append(c.Jobs, job)
+	return nil
+}
+
+// jobRemotePath is the sub directory of the job in the rclone remote path
+func jobRemotePath(path, name string) string {
+	if strings.HasSuffix(path, ":") {
+		return path + name
+	}
+	return strings.TrimSuffix(path, "/") + "/" + name
+}
+
+// jobErrors prefixes every error joined in err with the name of the backup job
+func jobErrors(name string, err error) error {
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		return fmt.Errorf("backup job %s: %w", name, err)
+	}
+	var errs []error
+	for _, err := range joined.Unwrap() {
+		errs = append(errs, jobErrors(name, err))
+	}
+	return errors.Join(errs...)
+}
+
+// validateJobs configs and check that jobs do not share storage locations
+func (c *Config) validateJobs() error {
+	var errs []error
+	storages := make(map[string]string)
+	for _, job := range c.Jobs {
+		if err := job.Config.validate(c.Database); err != nil {
+			errs = append(errs, jobErrors(job.Name, err))
+		}
+
+		// retention of one job would remove the backups of the other
+		location := filepath.Clean(job.Config.Storage)
+		if job.Config.ResticRepository != "" {
+			location = "restic:" + job.Config.ResticRepository
+		} else if job.Config.RClonePath != "" {
+			location = "rclone:" + job.Config.RClonePath
+		}
+		if other, ok := storages[location]; ok {
+			errs = append(errs, fmt.Errorf("backup jobs %s and %s must not use the same storage", other, job.Name))
+		}
+		storages[location] = job.Name
+		for _, mirror := range job.Config.RCloneMirrors {
+			if other, ok := storages["rclone:"+mirror]; ok && other != job.Name {
+				errs = append(errs, fmt.Errorf("backup jobs %s and %s must not use the same storage", other, job.Name))
+			}
+			storages["rclone:"+mirror] = job.Name
+		}
+	}
+	return errors.Join(errs...)
 }
 
 // validate configuration
 func (c *Config) validate() error {
+	var errs []error
+	if c.Log.Format != "text" && c.Log.Format != "json" {
+		errs = append(errs, fmt.Errorf("invalid log format %s (expected text or json)", c.Log.Format))
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Log.Level)); err != nil {
+		errs = append(errs, fmt.Errorf("invalid log level %s (expected debug, info, warn or error)", c.Log.Level))
+	}
+	if c.Log.Syslog != "" {
+		if _, _, err := parseSyslogAddress(c.Log.Syslog); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if _, _, err := parseMaxBackupAge(c.API.HealthBackupMaxAge); err != nil {
+		errs = append(errs, err)
+	}
+
 	db := c.Database
-	if db.Host != "" {
+	switch db.Type {
+	case "postgres", "mysql", "mongo", "sqlite", "cockroach", "elasticsearch", "etcd", "cassandra", "neo4j":
+	default:
+		errs = append(errs, fmt.Errorf("unsupported database type %s", db.Type))
+	}
+
+	if (db.Type == "elasticsearch" || db.Type == "cassandra") && db.Host != "" && db.SnapshotDirectory == "" {
+		errs = append(errs, fmt.Errorf("%s host given but snapshot directory is missing", db.Type))
+	}
+	if tool, ok := externalDatabaseTools[db.Type]; ok && db.Host != "" {
+		if _, err := exec.LookPath(tool); err != nil {
+			errs = append(errs, fmt.Errorf("%s backup requires %s which is not part of the image (see README)", db.Type, tool))
+		}
+	}
+
+	if db.Host != "" && db.requiresCredentials() {
 		if db.Username == "" {
-			return errors.New("database host given but username is missing")
+			errs = append(errs, errors.New("database host given but username is missing"))
 		}
 		if db.Password == "" {
-			return errors.New("database host given but user password is missing")
+			errs = append(errs, errors.New("database host given but user password is missing"))
 		}
 		if db.Database == "" {
-			return errors.New("database host given but database name is missing")
+			errs = append(errs, errors.New("database host given but database name is missing"))
 		}
 	}
 
-	if c.Backup.Database && db.Host == "" {
-		return errors.New("database config missing for backup")
+	if db.Databases != "" {
+		if db.Type != "postgres" {
+			errs = append(errs, errors.New("additional databases are only supported for postgres"))
+		}
+		if _, err := db.AdditionalDatabases(); err != nil {
+			errs = append(errs, err)
+		}
 	}
 
-	if c.Backup.AgeRecipients != nil && c.Backup.AgePassword != nil {
-		return errors.New("only age recipients OR a password is supported")
+	if db.UpdatePassword && db.Type != "postgres" {
+		errs = append(errs, errors.New("password update is only supported for postgres"))
 	}
 
-	return nil
+	if db.InitSQLDir != "" && db.Type != "postgres" {
+		errs = append(errs, errors.New("init scripts are only supported for postgres"))
+	}
+
+	if db.DumpFormat != "" && db.Type != "postgres" {
+		errs = append(errs, errors.New("dump format is only supported for postgres"))
+	}
+	if (len(db.DumpIncludeTables) > 0 || len(db.DumpExcludeTables) > 0) && db.Type != "postgres" {
+		errs = append(errs, errors.New("table filters are only supported for postgres"))
+	}
+	if (db.DumpSchemaOnly || db.DumpDataOnly) && db.Type != "postgres" {
+		errs = append(errs, errors.New("schema-only and data-only dumps are only supported for postgres"))
+	}
+	if db.DumpSchemaOnly && db.DumpDataOnly {
+		errs = append(errs, errors.New("only schema-only OR data-only dumps are supported"))
+	}
+	if db.DumpFormat != "" && db.DumpFormat != "plain" && db.DumpFormat != "custom" {
+		errs = append(errs, fmt.Errorf("unsupported dump format %s", db.DumpFormat))
+	}
+
+	if len(c.Jobs) == 0 {
+		if err := c.Backup.validate(db); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := c.validateJobs(); err != nil {
+		errs = append(errs, err)
+	}
+
+	switch c.Notify.On {
+	case "always", "failure", "recovery":
+	default:
+		errs = append(errs, fmt.Errorf("unsupported notification policy %s", c.Notify.On))
+	}
+	if (c.Notify.GotifyURL == "") != (c.Notify.GotifyToken == "") {
+		errs = append(errs, errors.New("gotify notifications require server URL and application token"))
+	}
+
+	if _, err := parseBlackoutWindows(c.Maintenance.Blackout); err != nil {
+		errs = append(errs, err)
+	}
+	if c.Maintenance.ContainerCleanupAge < 0 {
+		errs = append(errs, fmt.Errorf("invalid container cleanup age %s", c.Maintenance.ContainerCleanupAge))
+	}
+	if _, err := parseSize(c.Maintenance.LogMaxSize); err != nil {
+		errs = append(errs, fmt.Errorf("invalid maximum log size: %w", err))
+	}
+	schedules := map[string]string{
+		"vacuum":            c.Maintenance.VacuumSchedule,
+		"reindex":           c.Maintenance.ReindexSchedule,
+		"volume prune":      c.Maintenance.VolumePruneSchedule,
+		"container cleanup": c.Maintenance.ContainerCleanupSchedule,
+		"log truncate":      c.Maintenance.LogTruncateSchedule,
+		"build cache prune": c.Maintenance.BuildCachePruneSchedule,
+	}
+	for _, name := range slices.Sorted(maps.Keys(schedules)) {
+		if _, err := parseSchedule(schedules[name]); err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s schedule: %w", name, err))
+		}
+	}
+
+	if c.Maintenance.VacuumSchedule != "" && (db.Type != "postgres" || !db.IsConfigured()) {
+		errs = append(errs, errors.New("vacuum requires a postgres database"))
+	}
+	if c.Maintenance.ReindexSchedule != "" && (db.Type != "postgres" || !db.IsConfigured()) {
+		errs = append(errs, errors.New("reindex requires a postgres database"))
+	}
+
+	return errors.Join(errs...)
 }
 
+// validate backup configuration for the given database
+func (c *BackupConfig) validate(db DatabaseConfig) error {
+	var errs []error
+
+	if _, err := parseSchedule(c.Schedule); err != nil {
+		errs = append(errs, fmt.Errorf("invalid backup schedule: %w", err))
+	}
+
+	if (c.Database || c.DatabaseAll) && !db.IsConfigured() {
+		errs = append(errs, errors.New("database config missing for backup"))
+	}
+
+	if c.DatabaseAll && db.Type != "postgres" {
+		errs = append(errs, errors.New("backup of all databases is only supported for postgres"))
+	}
+
+	if c.WalArchive && (db.Type != "postgres" || !db.IsConfigured()) {
+		errs = append(errs, errors.New("WAL archiving requires a postgres database"))
+	}
+
+	switch c.Encryption {
+	case "", "none":
+	case "age":
+		recipients, err := c.ageRecipients()
+		if err != nil {
+			errs = append(errs, err)
+		} else if len(recipients) == 0 {
+			errs = append(errs, errors.New("age encryption requires recipients or a password"))
+		}
+	case "gpg":
+		if c.GPGRecipientsFile == "" {
+			errs = append(errs, errors.New("gpg encryption requires a recipients file"))
+		} else if _, err := readGPGKeyRing(c.GPGRecipientsFile); err != nil {
+			errs = append(errs, err)
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unsupported encryption %s", c.Encryption))
+	}
+
+	switch c.EncryptionMode {
+	case "archive":
+	case "entry":
+		if c.Encryption == "none" {
+			errs = append(errs, errors.New("entry encryption mode requires encryption"))
+		}
+		if c.format() != "zip" {
+			errs = append(errs, errors.New("entry encryption mode requires the zip backup format"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unsupported encryption mode %s", c.EncryptionMode))
+	}
+
+	switch c.DataCompression {
+	case "gzip", "none", "auto":
+	default:
+		errs = append(errs, fmt.Errorf("unsupported data compression %s", c.DataCompression))
+	}
+
+	if !slices.Contains(backupFormats, c.format()) {
+		errs = append(errs, fmt.Errorf("unsupported backup format %s", c.Format))
+	}
+
+	if c.AgeIdentityFile != "" {
+		if _, err := readAgeIdentities(c.AgeIdentityFile); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if c.AgeRecipientsFile != "" {
+		if _, err := readAgeRecipients(c.AgeRecipientsFile); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if c.MinFreeSpace != "" {
+		if _, err := parseSize(c.MinFreeSpace); err != nil {
+			errs = append(errs, fmt.Errorf("invalid minimum free space: %w", err))
+		}
+	}
+	if c.StorageMaxSize != "" {
+		if _, err := parseSize(c.StorageMaxSize); err != nil {
+			errs = append(errs, fmt.Errorf("invalid maximum storage size: %w", err))
+		}
+	}
+
+	if c.KeepLast < 0 || c.KeepDaily < 0 || c.KeepWeekly < 0 ||
+		c.KeepMonthly < 0 || c.KeepYearly < 0 {
+		errs = append(errs, errors.New("number of backups to keep must not be negative"))
+	}
+	if c.RetentionDays < 0 {
+		errs = append(errs, errors.New("backup retention days must not be negative"))
+	}
+	if c.IncrementalMax < 0 {
+		errs = append(errs, errors.New("number of incremental backups must not be negative"))
+	}
+	if _, err := c.scheduleLocation(); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := parseBlackoutWindows(c.Blackout); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := parseEventRules(c.Events); err != nil {
+		errs = append(errs, err)
+	}
+	if c.Retries < 0 {
+		errs = append(errs, errors.New("backup retries must not be negative"))
+	}
+	if c.RetryDelay <= 0 {
+		errs = append(errs, fmt.Errorf("invalid backup retry delay %s", c.RetryDelay))
+	}
+	if c.Overlap != "skip" && c.Overlap != "queue" {
+		errs = append(errs, fmt.Errorf("invalid backup overlap mode %s", c.Overlap))
+	}
+	if _, err := c.labels(); err != nil {
+		errs = append(errs, err)
+	}
+	if c.ParityShards < 0 {
+		errs = append(errs, errors.New("number of parity shards must not be negative"))
+	}
+
+	if c.ResticRepository != "" {
+		if c.Incremental {
+			errs = append(errs, errors.New("incremental backups are not supported with restic (restic deduplicates itself)"))
+		}
+		if c.StorageMaxSize != "" {
+			errs = append(errs, errors.New("maximum storage size is not supported with restic"))
+		}
+		if c.ParityShards > 0 {
+			errs = append(errs, errors.New("parity data is not supported with restic"))
+		}
+		if len(c.RCloneMirrors) > 0 {
+			errs = append(errs, errors.New("rclone mirrors are not supported with restic"))
+		}
+	}
+	if c.RCloneMirrorPolicy != "all" && c.RCloneMirrorPolicy != "any" {
+		errs = append(errs, fmt.Errorf("invalid rclone mirror policy %s (expected all or any)", c.RCloneMirrorPolicy))
+	}
+
+	if c.AutoRestore {
+		if !db.IsConfigured() {
+			errs = append(errs, errors.New("auto restore requires a database"))
+		}
+		if db.Type != "postgres" && db.Type != "mysql" && db.Type != "mongo" {
+			errs = append(errs, errors.New("auto restore is only supported for postgres, mysql and mongo"))
+		}
+	}
+
+	if c.DatabaseGlobals && db.Type != "postgres" {
+		errs = append(errs, errors.New("backup of globals is only supported for postgres"))
+	}
+
+	switch c.DatabaseMode {
+	case "logical":
+	case "physical":
+		if db.Type != "postgres" {
+			errs = append(errs, errors.New("physical database backup is only supported for postgres"))
+		}
+		if c.DatabaseAll {
+			errs = append(errs, errors.New("physical database backup already contains all databases"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unsupported database backup mode %s", c.DatabaseMode))
+	}
+
+	if c.AgeRecipients != nil && c.AgePassword != nil {
+		errs = append(errs, errors.New("only age recipients OR a password is supported"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// splitList of comma separated values and drop empty entries
+func splitList(value string) []string {
+	var list []string
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry != "" {
+			list = append(list, entry)
+		}
+	}
+	return list
+}
+
+// parseList of config values separated by "," or new lines (e.g. of a multi line config value)
+func parseList(value string) []string {
+	return splitList(strings.ReplaceAll(value, "\n", ","))
+}
+
+// loadStruct from environment variables
 func loadStruct(st reflect.Value) error {
+	return loadStructFrom(st, lookupConfig)
+}
+
+// loadStructFrom values returned by lookup for the conf keys
+func loadStructFrom(st reflect.Value, lookup func(key string) (string, bool)) error {
+	var errs []error
 	for i := 0; i < st.NumField(); i++ {
 		field := st.Field(i)
 		fieldType := st.Type().Field(i)
 
 		// load sub structures
 		if fieldType.Type.Kind() == reflect.Struct {
-			err := loadStruct(field)
-			if err != nil {
-				return err
-			}
+			errs = append(errs, loadStructFrom(field, lookup))
 			continue
 		}
 
@@ -103,6 +899,7 @@ func loadStruct(st reflect.Value) error {
 			continue
 		}
 		splitTag := strings.Split(tag, ",")
+		key := splitTag[0]
 
 		// check if default value exists
 		var defaultValue string
@@ -111,40 +908,97 @@ func loadStruct(st reflect.Value) error {
 		}
 
 		// get value from env
-		value, valueGiven := os.LookupEnv(splitTag[0])
+		value, valueGiven := lookup(key)
+
+		// or from the file given by <key>_FILE (e.g. Docker secrets)
+		if fieldType.Type.Kind() != reflect.Slice || fieldType.Type.Elem().Kind() == reflect.String {
+			filename, fileGiven := lookup(key + "_FILE")
+			if fileGiven && valueGiven {
+				errs = append(errs, fmt.Errorf("%s and %s_FILE given", key, key))
+				continue
+			}
+			if fileGiven {
+				data, err := os.ReadFile(filename)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("failed to read %s_FILE: %w", key, err))
+					continue
+				}
+				// ignore trailing new line of secret files
+				value, valueGiven = strings.TrimRight(string(data), "\r\n"), true
+			}
+		}
+		if !valueGiven {
+			value = defaultValue
+		}
+
+		// required values must not be empty
+		if slices.Contains(splitTag[min(len(splitTag), 2):], "required") && strings.TrimSpace(value) == "" {
+			errs = append(errs, fmt.Errorf("%s is required", key))
+			continue
+		}
 
 		// set value in struct
+		if fieldType.Type == reflect.TypeOf(time.Duration(0)) {
+			var duration time.Duration
+			var err error
+			if value != "" {
+				duration, err = time.ParseDuration(value)
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("invalid duration %q given for %s", value, key))
+				continue
+			}
+			field.SetInt(int64(duration))
+			continue
+		}
+
 		switch fieldType.Type.Kind() {
 		case reflect.String:
-			if valueGiven {
-				field.SetString(value)
-			} else {
-				field.SetString(defaultValue)
-			}
+			field.SetString(value)
 		case reflect.Int:
-			if valueGiven {
-				field.SetInt(cast.ToInt64(value))
-			} else {
-				field.SetInt(cast.ToInt64(defaultValue))
+			if value == "" {
+				field.SetInt(0)
+				continue
 			}
+			number, err := cast.ToInt64E(strings.TrimSpace(value))
+			if err != nil {
+				errs = append(errs, fmt.Errorf("invalid number %q given for %s", value, key))
+				continue
+			}
+			field.SetInt(number)
 		case reflect.Bool:
-			if valueGiven {
-				field.SetBool(cast.ToBool(value))
-			} else {
-				field.SetBool(cast.ToBool(defaultValue))
+			if value == "" {
+				field.SetBool(false)
+				continue
 			}
+			boolean, err := cast.ToBoolE(strings.TrimSpace(value))
+			if err != nil {
+				errs = append(errs, fmt.Errorf("invalid boolean %q given for %s", value, key))
+				continue
+			}
+			field.SetBool(boolean)
 
 		case reflect.Slice:
-			if !valueGiven {
+			if strings.TrimSpace(value) == "" {
 				continue
 			}
 
-			if fieldType.Type.Elem() == reflect.TypeOf(new(age.X25519Recipient)) {
-				var recipients []*age.X25519Recipient
-				for _, key := range strings.Split(value, ",") {
-					recipient, err := age.ParseX25519Recipient(strings.TrimSpace(key))
+			if fieldType.Type.Elem().Kind() == reflect.String {
+				field.Set(reflect.ValueOf(parseList(value)))
+			} else if fieldType.Type.Elem() == reflect.TypeOf((*age.Identity)(nil)).Elem() {
+				identities, err := parseAgeIdentities(strings.NewReader(strings.ReplaceAll(value, ",", "\n")))
+				if err != nil {
+					errs = append(errs, fmt.Errorf("invalid identity given for %s: %w", key, err))
+					continue
+				}
+				field.Set(reflect.ValueOf(identities))
+			} else if fieldType.Type.Elem() == reflect.TypeOf((*age.Recipient)(nil)).Elem() {
+				var recipients []age.Recipient
+				for _, entry := range splitList(value) {
+					recipient, err := parseAgeRecipient(entry)
 					if err != nil {
-						return fmt.Errorf("invalid recipient given %s: %w", key, err)
+						errs = append(errs, fmt.Errorf("invalid recipient given for %s %s: %w", key, entry, err))
+						continue
 					}
 					recipients = append(recipients, recipient)
 				}
@@ -154,17 +1008,26 @@ func loadStruct(st reflect.Value) error {
 			}
 
 		case reflect.Ptr:
-			if !valueGiven {
+			if value == "" {
 				continue
 			}
 
 			if fieldType.Type.Elem() == reflect.TypeOf(age.ScryptRecipient{}) {
 				recipient, err := age.NewScryptRecipient(value)
 				if err != nil {
-					return fmt.Errorf("invalid password given: %w", err)
+					errs = append(errs, fmt.Errorf("invalid password given for %s: %w", key, err))
+					continue
 				}
 
 				field.Set(reflect.ValueOf(recipient))
+			} else if fieldType.Type.Elem() == reflect.TypeOf(age.ScryptIdentity{}) {
+				identity, err := age.NewScryptIdentity(value)
+				if err != nil {
+					// already reported for the recipient of the same password
+					continue
+				}
+
+				field.Set(reflect.ValueOf(identity))
 			} else {
 				panic("unsupported pointer type")
 			}
@@ -173,5 +1036,5 @@ func loadStruct(st reflect.Value) error {
 			panic("unsupported struct field type")
 		}
 	}
-	return nil
+	return errors.Join(errs...)
 }
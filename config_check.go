@@ -0,0 +1,334 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config"
+	"github.com/rclone/rclone/fs/config/configfile"
+	"gopkg.in/yaml.v3"
+)
+
+// secretKeyParts of conf keys whose values are redacted
+var secretKeyParts = []string{"PASSWORD", "PASSPHRASE", "TOKEN", "WEBHOOK", "NOTIFY_URLS", "HEALTHCHECKS_URL", "AGE_IDENTITY"}
+
+// secretKey returns true if the value of the conf key contains a secret
+// (paths of secret files given by *_FILE are not secret)
+func secretKey(key string) bool {
+	if strings.HasSuffix(key, "_FILE") {
+		return false
+	}
+	for _, part := range secretKeyParts {
+		if strings.Contains(key, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// locationKeys of conf keys with URLs or rclone paths that may contain credentials
+var locationKeys = []string{"BACKUP_RESTIC_REPOSITORY", "BACKUP_RCLONE_PATH", "BACKUP_RCLONE_MIRRORS"}
+
+var (
+	// credentialsRegex matches the password of user:password@ in URLs
+	credentialsRegex = regexp.MustCompile(`(://[^/@:\s]*:)[^/@\s]+@`)
+	// secretParamRegex matches secret query parameters of URLs and parameters of rclone connection strings
+	secretParamRegex = regexp.MustCompile(`(?i)([?&,:][a-z0-9_-]*(?:pass|secret|token|key|sig)[a-z0-9_-]*=)([^&,:]*)`)
+)
+
+// redactLocation replaces passwords and secret parameters of URLs and rclone paths with ***
+func redactLocation(value string) string {
+	value = credentialsRegex.ReplaceAllString(value, "${1}***@")
+	return secretParamRegex.ReplaceAllString(value, "${1}***")
+}
+
+// redactDatabases replaces the passwords of database:user:password entries with ***
+func redactDatabases(value string) string {
+	entries := splitList(value)
+	for i, entry := range entries {
+		if parts := strings.SplitN(entry, ":", 3); len(parts) == 3 {
+			entries[i] = parts[0] + ":" + parts[1] + ":***"
+		}
+	}
+	return strings.Join(entries, ",")
+}
+
+// redactValue of the conf key with secrets in composite values (e.g. credentials in URLs)
+func redactValue(key string, value any) any {
+	switch {
+	case key == "DB_DATABASES":
+		return redactDatabases(value.(string))
+	case slices.Contains(locationKeys, key):
+		switch value := value.(type) {
+		case string:
+			return redactLocation(value)
+		case []string:
+			for i := range value {
+				value[i] = redactLocation(value[i])
+			}
+			return value
+		}
+	}
+	return value
+}
+
+// walkConfig calls fn with the conf key and the value of every field of the struct
+// (secret values are redacted, duplicated keys are only reported once)
+func walkConfig(st reflect.Value, fn func(key string, value any)) {
+	seen := make(map[string]bool)
+	var walk func(st reflect.Value)
+	walk = func(st reflect.Value) {
+		for i := 0; i < st.NumField(); i++ {
+			field := st.Field(i)
+			fieldType := st.Type().Field(i)
+
+			if fieldType.Type.Kind() == reflect.Struct {
+				walk(field)
+				continue
+			}
+			tag, ok := fieldType.Tag.Lookup("conf")
+			if !ok {
+				continue
+			}
+			key := strings.Split(tag, ",")[0]
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			if !field.IsZero() && secretKey(key) && field.Kind() != reflect.Bool {
+				fn(key, "***")
+			} else {
+				fn(key, redactValue(key, configValue(field)))
+			}
+		}
+	}
+	walk(st)
+}
+
+// configValue of a config field (lists as []string, durations and keys as string)
+func configValue(field reflect.Value) any {
+	switch {
+	case field.Kind() == reflect.Ptr:
+		if field.IsNil() {
+			return ""
+		}
+		return "***"
+	case field.Kind() == reflect.Slice:
+		values := make([]string, 0, field.Len())
+		for i := 0; i < field.Len(); i++ {
+			values = append(values, fmt.Sprint(field.Index(i).Interface()))
+		}
+		return values
+	case field.Type() == reflect.TypeOf(time.Duration(0)):
+		return field.Interface().(time.Duration).String()
+	default:
+		return field.Interface()
+	}
+}
+
+// checkedEnvPrefixes of environment variables that are checked for unknown keys
+var checkedEnvPrefixes = []string{"HOUSEKEEPER_", "BACKUP_", "DB_"}
+
+// configKeys of all fields of the struct and their *_FILE variants
+func configKeys(st reflect.Value) []string {
+	var keys []string
+	walkConfig(st, func(key string, _ any) {
+		keys = append(keys, key, key+"_FILE")
+	})
+	return keys
+}
+
+// jobKeyPrefix of the backup job the conf key belongs to (empty for global keys)
+func (c *Config) jobKeyPrefix(key string) string {
+	var prefix string
+	for _, name := range c.JobNames {
+		if strings.HasPrefix(key, jobPrefix(name)) && len(jobPrefix(name)) > len(prefix) {
+			prefix = jobPrefix(name)
+		}
+	}
+	if prefix == "" {
+		prefix = jobIndexRegex.FindString(key)
+	}
+	return prefix
+}
+
+// warnUnknownEnv logs a warning for every environment variable starting with
+// HOUSEKEEPER_, BACKUP_ or DB_ that is not a known conf key (e.g. BACKUP_SHEDULE)
+func (c *Config) warnUnknownEnv() {
+	known := append(configKeys(reflect.ValueOf(&Config{}).Elem()), "HOUSEKEEPER_ENV_PREFIX", "CONFIG_FILE", "SECRETS_DIR")
+	var jobKeys []string
+	for _, key := range configKeys(reflect.ValueOf(&BackupConfig{}).Elem()) {
+		jobKeys = append(jobKeys, strings.TrimPrefix(key, "BACKUP_"))
+	}
+
+	logger := newLogger("config")
+	for _, key := range envKeys() {
+		if !slices.ContainsFunc(checkedEnvPrefixes, func(prefix string) bool { return strings.HasPrefix(key, prefix) }) ||
+			slices.Contains(known, key) {
+			continue
+		}
+
+		prefix, candidates := c.jobKeyPrefix(key), known
+		if prefix != "" {
+			// indexed jobs are named by BACKUP_<n>_NAME
+			candidates = jobKeys
+			if !strings.HasPrefix(prefix, "BACKUP_JOB_") {
+				candidates = append(slices.Clone(jobKeys), "NAME")
+			}
+			if slices.Contains(candidates, strings.TrimPrefix(key, prefix)) {
+				continue
+			}
+		}
+
+		name := envPrefix() + key
+		if match := closestKey(strings.TrimPrefix(key, prefix), candidates); match != "" {
+			logger.Warn("unknown environment variable", "name", name, "suggestion", envPrefix()+prefix+match)
+		} else if prefix == "" && strings.HasPrefix(key, "BACKUP_JOB_") {
+			logger.Warn("unknown environment variable (job not listed in BACKUP_JOBS?)", "name", name)
+		} else {
+			logger.Warn("unknown environment variable", "name", name)
+		}
+	}
+}
+
+// closestKey of the candidates with at most 2 edits to the key (empty if there is none)
+func closestKey(key string, candidates []string) string {
+	var closest string
+	best := 3
+	for _, candidate := range candidates {
+		if distance := editDistance(key, candidate); distance < best {
+			closest, best = candidate, distance
+		}
+	}
+	return closest
+}
+
+// editDistance (Levenshtein) between a and b
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+// walkEffectiveConfig calls fn with the conf key and value of the global config and all backup jobs
+func (h *Housekeeper) walkEffectiveConfig(fn func(key string, value any)) {
+	walkConfig(reflect.ValueOf(&h.config).Elem(), fn)
+	for _, job := range h.config.Jobs {
+		if job.Prefix != jobPrefix(job.Name) {
+			fn(job.Prefix+"NAME", job.Name)
+		}
+		walkConfig(reflect.ValueOf(&job.Config).Elem(), func(key string, value any) {
+			fn(job.Prefix+strings.TrimPrefix(key, "BACKUP_"), value)
+		})
+	}
+}
+
+// PrintConfig writes the effective config with redacted secrets as YAML to stdout
+func (h *Housekeeper) PrintConfig() error {
+	document := &yaml.Node{Kind: yaml.MappingNode}
+	var err error
+	h.walkEffectiveConfig(func(key string, value any) {
+		var node yaml.Node
+		if encodeErr := node.Encode(value); encodeErr != nil {
+			err = errors.Join(err, fmt.Errorf("failed to encode %s: %w", key, encodeErr))
+			return
+		}
+		document.Content = append(document.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, &node)
+	})
+	if err != nil {
+		return err
+	}
+
+	encoder := yaml.NewEncoder(os.Stdout)
+	encoder.SetIndent(2)
+	if err = encoder.Encode(document); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+	return encoder.Close()
+}
+
+// CheckConfig prints the effective config and checks the database connection and rclone remotes
+func (h *Housekeeper) CheckConfig() error {
+	fmt.Println("Effective config:")
+	h.walkEffectiveConfig(func(key string, value any) {
+		if list, ok := value.([]string); ok {
+			value = strings.Join(list, ",")
+		}
+		fmt.Printf("  %s=%v\n", key, value)
+	})
+
+	var failed bool
+	check := func(name string, err error) {
+		if err != nil {
+			newLogger("config").Error("> "+name+" failed", "error", err)
+			failed = true
+		} else {
+			newLogger("config").Printf("> %s ok", name)
+		}
+	}
+
+	if h.config.Database.IsConfigured() {
+		check("database connection", h.db.WaitForConnection(h.config.Database.WaitTimeout))
+	}
+	for _, job := range h.jobs {
+		if job.Config.RClonePath != "" {
+			check(fmt.Sprintf("rclone remote %s", job.Config.RClonePath), job.checkRemote(job.Config.RClonePath))
+		}
+		for _, mirror := range job.Config.RCloneMirrors {
+			check(fmt.Sprintf("rclone mirror %s", mirror), job.checkRemote(mirror))
+		}
+	}
+
+	if failed {
+		return errors.New("config check failed")
+	}
+	newLogger("config").Print("config check finished")
+	return nil
+}
+
+// checkRemote is accessible (a missing directory is created with the first backup)
+func (s *BackupService) checkRemote(path string) error {
+	if s.Config.RCloneConfig != "" {
+		err := config.SetConfigPath(s.Config.RCloneConfig)
+		if err != nil {
+			return fmt.Errorf("failed to load rclone config %s: %w", s.Config.RCloneConfig, err)
+		}
+		configfile.Install()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	remote, err := fs.NewFs(ctx, path)
+	if err != nil {
+		return fmt.Errorf("failed create rclone FS %s: %w", path, err)
+	}
+	_, err = remote.List(ctx, "")
+	if err != nil && !errors.Is(err, fs.ErrorDirNotFound) {
+		return fmt.Errorf("failed to list rclone remote: %w", err)
+	}
+	return nil
+}
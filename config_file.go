@@ -0,0 +1,192 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultConfigFile is loaded if it exists and CONFIG_FILE is not set
+const defaultConfigFile = "/etc/housekeeper.yml"
+
+// configFileValues of the loaded config file by conf key
+var configFileValues map[string]string
+
+// secretValues of the files in SECRETS_DIR by conf key
+var secretValues map[string]string
+
+// envPrefix of all environment variables given by HOUSEKEEPER_ENV_PREFIX
+// (e.g. APP1_ for APP1_DB_HOST)
+func envPrefix() string {
+	prefix := os.Getenv("HOUSEKEEPER_ENV_PREFIX")
+	if prefix != "" && !strings.HasSuffix(prefix, "_") {
+		prefix += "_"
+	}
+	return prefix
+}
+
+// lookupEnv variable of the conf key with the configured prefix
+func lookupEnv(key string) (string, bool) {
+	return os.LookupEnv(envPrefix() + key)
+}
+
+// envKeys of all environment variables with the configured prefix (without the prefix)
+func envKeys() []string {
+	prefix := envPrefix()
+	var keys []string
+	for _, env := range os.Environ() {
+		key, _, _ := strings.Cut(env, "=")
+		if key, ok := strings.CutPrefix(key, prefix); ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// configOverrides of conf keys given on the command line
+var configOverrides = make(map[string]string)
+
+// lookupConfig value of the conf key from the command line, the environment, the secrets directory
+// or the config file (environment variables override secrets and values of the config file)
+func lookupConfig(key string) (string, bool) {
+	if value, ok := configOverrides[key]; ok {
+		return value, true
+	}
+	if value, ok := lookupEnv(key); ok {
+		return value, true
+	}
+	if value, ok := secretValues[key]; ok {
+		return value, true
+	}
+	value, ok := configFileValues[key]
+	return value, ok
+}
+
+// useConfigValues of a config file and a secrets directory for lookupConfig
+// and return a function that restores the previous values
+func useConfigValues(fileValues, secrets map[string]string) func() {
+	previousFileValues, previousSecrets := configFileValues, secretValues
+	configFileValues, secretValues = fileValues, secrets
+	return func() {
+		configFileValues, secretValues = previousFileValues, previousSecrets
+	}
+}
+
+// loadConfigFile given by CONFIG_FILE or the default config file if it exists
+func loadConfigFile() (map[string]string, error) {
+	filename, explicit := configOverrides["CONFIG_FILE"]
+	if !explicit {
+		filename, explicit = lookupEnv("CONFIG_FILE")
+	}
+	if !explicit {
+		filename = defaultConfigFile
+	}
+	if filename == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) && !explicit {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var content map[string]any
+	if err = yaml.Unmarshal(data, &content); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", filename, err)
+	}
+
+	values := make(map[string]string)
+	flattenConfig("", content, values)
+	return values, nil
+}
+
+// loadSecretsDir given by SECRETS_DIR (command line, environment or the given config file values)
+// and map the file names to conf keys (e.g. /run/secrets/db_user_password -> DB_USER_PASSWORD)
+func loadSecretsDir(fileValues map[string]string) (map[string]string, error) {
+	dir, ok := configOverrides["SECRETS_DIR"]
+	if !ok {
+		dir, ok = lookupEnv("SECRETS_DIR")
+	}
+	if !ok {
+		dir = fileValues["SECRETS_DIR"]
+	}
+	if dir == "" {
+		return nil, nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secrets directory: %w", err)
+	}
+
+	values := make(map[string]string)
+	prefix := envPrefix()
+	for _, entry := range entries {
+		// skip hidden files (e.g. ..data of kubernetes secret volumes)
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read secret %s: %w", entry.Name(), err)
+		}
+		if info.IsDir() {
+			continue
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read secret %s: %w", entry.Name(), err)
+		}
+		key := strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(entry.Name()))
+		key = strings.TrimPrefix(key, prefix)
+		values[key] = strings.TrimRight(string(data), "\r\n")
+	}
+	return values, nil
+}
+
+// flattenConfig converts nested maps to conf keys by joining the keys with "_"
+// (e.g. backup: {schedule: x} -> BACKUP_SCHEDULE) and lists to "," separated values
+// (except a list of backup jobs that is mapped to indexed jobs)
+func flattenConfig(prefix string, content map[string]any, values map[string]string) {
+	for key, value := range content {
+		key = strings.ToUpper(strings.ReplaceAll(key, "-", "_"))
+		if prefix != "" {
+			key = prefix + "_" + key
+		}
+
+		switch value := value.(type) {
+		case map[string]any:
+			flattenConfig(key, value, values)
+		case []any:
+			// list of backup jobs -> indexed jobs (BACKUP_<n>_*)
+			if key == "BACKUP_JOBS" && len(value) > 0 {
+				if _, ok := value[0].(map[string]any); ok {
+					for index, item := range value {
+						job, _ := item.(map[string]any)
+						flattenConfig(fmt.Sprintf("BACKUP_%d", index+1), job, values)
+					}
+					continue
+				}
+			}
+
+			items := make([]string, 0, len(value))
+			for _, item := range value {
+				items = append(items, fmt.Sprint(item))
+			}
+			values[key] = strings.Join(items, ",")
+		case nil:
+			values[key] = ""
+		default:
+			values[key] = fmt.Sprint(value)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestFlattenConfig(t *testing.T) {
+	tests := []struct {
+		content  string
+		expected map[string]string
+	}{
+		{"DB_TYPE: mysql", map[string]string{"DB_TYPE": "mysql"}},
+		{"backup: {schedule: '@daily', keep_last: 7}",
+			map[string]string{"BACKUP_SCHEDULE": "@daily", "BACKUP_KEEP_LAST": "7"}},
+		{"backup:\n  data-dir: [/data/a, /data/b]\n  catch_up: false",
+			map[string]string{"BACKUP_DATA_DIR": "/data/a,/data/b", "BACKUP_CATCH_UP": "false"}},
+		{"notify: {urls: []}\napi: {token: }",
+			map[string]string{"NOTIFY_URLS": "", "API_TOKEN": ""}},
+		{"backup:\n  jobs:\n  - {name: app, schedule: '@hourly'}\n  - {name: db, data_dir: [/db]}",
+			map[string]string{"BACKUP_1_NAME": "app", "BACKUP_1_SCHEDULE": "@hourly",
+				"BACKUP_2_NAME": "db", "BACKUP_2_DATA_DIR": "/db"}},
+		{"backup: {jobs: [app, db]}", map[string]string{"BACKUP_JOBS": "app,db"}},
+	}
+	for _, test := range tests {
+		var content map[string]any
+		if err := yaml.Unmarshal([]byte(test.content), &content); err != nil {
+			t.Fatalf("failed to parse %q: %v", test.content, err)
+		}
+		values := make(map[string]string)
+		flattenConfig("", content, values)
+		if !reflect.DeepEqual(values, test.expected) {
+			t.Errorf("flattenConfig(%q) = %v, expected %v", test.content, values, test.expected)
+		}
+	}
+}
+
+func TestLoadConfigKeepsActiveValues(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "housekeeper.yml")
+	if err := os.WriteFile(filename, []byte("db: {type: unknown}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	configOverrides["CONFIG_FILE"] = filename
+	defer delete(configOverrides, "CONFIG_FILE")
+
+	active := map[string]string{"DB_TYPE": "sqlite"}
+	defer useConfigValues(active, nil)()
+
+	var housekeeper Housekeeper
+	if err := housekeeper.loadConfig(); err == nil {
+		t.Fatal("invalid config was loaded")
+	}
+	if !reflect.DeepEqual(configFileValues, active) {
+		t.Errorf("config file values = %v after failed load, expected %v", configFileValues, active)
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseList(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected []string
+	}{
+		{"", nil},
+		{" , ,", nil},
+		{"/data", []string{"/data"}},
+		{"/data/a,/data/b", []string{"/data/a", "/data/b"}},
+		{" /data/a , /data/b ,", []string{"/data/a", "/data/b"}},
+		{"/data/my files", []string{"/data/my files"}},
+		{"/data/my files,/data/other files", []string{"/data/my files", "/data/other files"}},
+		{"/data/a\n/data/b\n", []string{"/data/a", "/data/b"}},
+		{"/data/a\r\n/data/b", []string{"/data/a", "/data/b"}},
+	}
+	for _, test := range tests {
+		if list := parseList(test.value); !reflect.DeepEqual(list, test.expected) {
+			t.Errorf("parseList(%q) = %q, expected %q", test.value, list, test.expected)
+		}
+	}
+}
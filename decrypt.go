@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"filippo.io/age"
+)
+
+// DecryptOptions for a decrypt run
+type DecryptOptions struct {
+	// Job of the backup (first job if empty)
+	Job string
+	// Filename of backup to decrypt
+	Filename string
+	// Output path of decrypted zip file (stdout if empty or "-")
+	Output string
+	// IdentityFile with additional age identities
+	IdentityFile string
+}
+
+// Decrypt a backup file into a plain zip file
+func (s *BackupService) Decrypt(options DecryptOptions) error {
+	if options.Filename == "" {
+		return errors.New("no backup file given")
+	}
+
+	var identities []age.Identity
+	if options.IdentityFile != "" {
+		var err error
+		identities, err = readAgeIdentities(options.IdentityFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	reader, err := s.openDecrypted(options.Filename, identities)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	var writer io.Writer = os.Stdout
+	if options.Output != "" && options.Output != "-" {
+		file, err := os.Create(options.Output)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", options.Output, err)
+		}
+		defer file.Close()
+		writer = file
+	}
+
+	if _, err = io.Copy(writer, reader); err != nil {
+		return fmt.Errorf("failed to decrypt backup %s: %w", options.Filename, err)
+	}
+
+	if writer != os.Stdout {
+		s.logger().Printf("decrypted %s to %s", options.Filename, options.Output)
+	}
+	return nil
+}
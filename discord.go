@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// DiscordNotifier sends notifications to a Discord webhook
+type DiscordNotifier struct {
+	Webhook string
+}
+
+// discordField of an embed
+type discordField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+// discordEmbed of a message
+type discordEmbed struct {
+	Title     string         `json:"title"`
+	Color     int            `json:"color"`
+	Fields    []discordField `json:"fields"`
+	Timestamp string         `json:"timestamp"`
+}
+
+// discordMessage sent to the webhook
+type discordMessage struct {
+	Embeds []discordEmbed `json:"embeds"`
+}
+
+// Notify Discord about the task result
+func (n *DiscordNotifier) Notify(notification Notification) error {
+	embed := discordEmbed{
+		Title:     notification.Title(),
+		Color:     0x2eb886,
+		Timestamp: time.Now().Format(time.RFC3339),
+	}
+	if !notification.Success() {
+		embed.Color = 0xd00000
+	}
+	for _, field := range notification.Fields() {
+		embed.Fields = append(embed.Fields, discordField{
+			Name:   field[0],
+			Value:  field[1],
+			Inline: field[0] != "Error" && field[0] != "File",
+		})
+	}
+
+	err := postJSON(n.Webhook, discordMessage{Embeds: []discordEmbed{embed}})
+	if err != nil {
+		return fmt.Errorf("discord: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+)
+
+// labels of containers and volumes discovered for backup
+const (
+	// labelBackupPath of containers contains the paths inside the container to back up (separated by ",")
+	labelBackupPath = "housekeeper.backup.path"
+	// labelBackup of volumes set to true backs up the whole volume
+	labelBackup = "housekeeper.backup"
+	// labelBackupJob selects the backup job of the container or volume
+	labelBackupJob = "housekeeper.backup.job"
+	// labelBackupExclude of containers contains patterns of files excluded from the paths (separated by ",")
+	labelBackupExclude = "housekeeper.backup.exclude"
+	// labelBackupHookPre of containers is a command run inside the container before the backup
+	labelBackupHookPre = "housekeeper.backup.hook.pre"
+	// labelBackupHookPost of containers is a command run inside the container after the backup
+	labelBackupHookPost = "housekeeper.backup.hook.post"
+	// labelBackupSchedule of containers is an additional schedule of the backup job
+	labelBackupSchedule = "housekeeper.backup.schedule"
+)
+
+// compose labels of containers and volumes used to group discovered directories
+const (
+	labelComposeProject = "com.docker.compose.project"
+	labelComposeService = "com.docker.compose.service"
+)
+
+// backupDirectory of the data directories with the compose project of discovered directories
+type backupDirectory struct {
+	Path    string
+	Project string
+	Service string
+
+	// Exclude patterns of files relative to the directory
+	Exclude []string
+	// Container the directory was discovered from (nil if configured or a volume)
+	Container *DockerContainer
+}
+
+// prefix of the directory entries in the backup (grouped by compose project and service)
+func (d backupDirectory) prefix() string {
+	if d.Project == "" {
+		return ""
+	}
+	if d.Service == "" {
+		return path.Join("projects", d.Project) + "/"
+	}
+	return path.Join("projects", d.Project, d.Service) + "/"
+}
+
+// dataDirectories configured and discovered from Docker labels
+func (s *BackupService) dataDirectories() ([]backupDirectory, error) {
+	var directories []backupDirectory
+	for _, dir := range s.Config.DataDirectories {
+		directories = append(directories, backupDirectory{Path: dir})
+	}
+	if !s.Config.DockerDiscovery {
+		return directories, nil
+	}
+
+	s.logger().Print("> discover backup targets from Docker labels")
+	discovered, err := s.discoverDirectories()
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover backup targets: %w", err)
+	}
+	for _, dir := range discovered {
+		if !slices.ContainsFunc(directories, func(d backupDirectory) bool { return d.Path == dir.Path }) {
+			directories = append(directories, dir)
+		}
+	}
+	return directories, nil
+}
+
+// discoverDirectories of containers and volumes with backup labels of this job
+func (s *BackupService) discoverDirectories() ([]backupDirectory, error) {
+	var directories []backupDirectory
+
+	containers, err := s.Docker.Containers(true, map[string][]string{"label": {labelBackupPath}})
+	if err != nil {
+		return nil, err
+	}
+	for _, container := range containers {
+		if container.Labels[labelBackupJob] != s.Name {
+			continue
+		}
+		for _, path := range splitList(container.Labels[labelBackupPath]) {
+			source, err := container.hostPath(path)
+			if err != nil {
+				return nil, err
+			}
+			s.logger().Printf("-> discovered %s:%s", container.Name(), path)
+			directories = append(directories, backupDirectory{
+				Path:      filepath.Join(s.Config.DockerRoot, source),
+				Project:   container.Labels[labelComposeProject],
+				Service:   container.Labels[labelComposeService],
+				Exclude:   splitList(container.Labels[labelBackupExclude]),
+				Container: &container,
+			})
+		}
+	}
+
+	volumes, err := s.Docker.Volumes(map[string][]string{"label": {labelBackup + "=true"}})
+	if err != nil {
+		return nil, err
+	}
+	for _, volume := range volumes {
+		if volume.Labels[labelBackupJob] != s.Name {
+			continue
+		}
+		s.logger().Printf("-> discovered volume %s", volume.Name)
+		directories = append(directories, backupDirectory{
+			Path:    filepath.Join(s.Config.DockerRoot, volume.Mountpoint),
+			Project: volume.Labels[labelComposeProject],
+		})
+	}
+
+	// sorted by project and path, so directories of a stack are stored together
+	slices.SortFunc(directories, func(a, b backupDirectory) int {
+		return cmp.Or(cmp.Compare(a.Project, b.Project), cmp.Compare(a.Path, b.Path))
+	})
+	return slices.CompactFunc(directories, func(a, b backupDirectory) bool { return a.Path == b.Path }), nil
+}
+
+// databaseProject of the container the database dumps are created in (see DB_EXEC_CONTAINER)
+func (s *BackupService) databaseProject() (string, string) {
+	runner, ok := s.Database.(interface{ ExecContainer() string })
+	if !ok || runner.ExecContainer() == "" {
+		return "", ""
+	}
+	inspect, err := s.Docker.InspectContainer(runner.ExecContainer())
+	if err != nil {
+		s.warn("> failed to get compose project of database container", "error", err)
+		return "", ""
+	}
+	return inspect.Config.Labels[labelComposeProject], inspect.Config.Labels[labelComposeService]
+}
+
+// excludeFilter skips files matching any of the patterns before calling include (all if nil).
+// Patterns are matched against the relative path of the file and all its parent directories.
+func excludeFilter(patterns []string, include tarFilter) tarFilter {
+	if len(patterns) == 0 {
+		return include
+	}
+	return func(name string, info os.FileInfo) bool {
+		for current := name; current != "."; current = path.Dir(current) {
+			for _, pattern := range patterns {
+				if ok, _ := path.Match(pattern, current); ok {
+					return false
+				}
+				if ok, _ := path.Match(pattern, path.Base(current)); ok {
+					return false
+				}
+			}
+		}
+		return include == nil || include(name, info)
+	}
+}
+
+// runHooks of the discovered containers with the given label (each container once)
+func (s *BackupService) runHooks(directories []backupDirectory, label string) error {
+	done := make(map[string]bool)
+	for _, dir := range directories {
+		if dir.Container == nil || done[dir.Container.ID] || dir.Container.Labels[label] == "" {
+			continue
+		}
+		done[dir.Container.ID] = true
+
+		s.logger().Printf("> run %s of %s", label, dir.Container.Name())
+		err := s.Docker.Exec(dir.Container.ID, []string{"sh", "-c", dir.Container.Labels[label]}, nil, os.Stdout, os.Stderr)
+		if err != nil {
+			return fmt.Errorf("%s of %s failed: %w", label, dir.Container.Name(), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestExcludeFilter(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		name     string
+		expected bool
+	}{
+		{nil, "cache/file", true},
+		{[]string{"cache"}, "cache", false},
+		{[]string{"cache"}, "cache/file", false},
+		{[]string{"cache"}, "data/cache/file", false},
+		{[]string{"cache"}, "data/caches/file", true},
+		{[]string{"*.log"}, "app.log", false},
+		{[]string{"*.log"}, "logs/2024/app.log", false},
+		{[]string{"*.log"}, "app.log.gz", true},
+		{[]string{"data/tmp"}, "data/tmp/file", false},
+		{[]string{"data/tmp"}, "other/data/tmp/file", true},
+		{[]string{"data/*/file"}, "data/x/file", false},
+		{[]string{"tmp", "*.bak"}, "db.bak", false},
+		{[]string{"tmp", "*.bak"}, "db.sql", true},
+		{[]string{"["}, "file", true},
+	}
+	for _, test := range tests {
+		filter := excludeFilter(test.patterns, nil)
+		included := filter == nil || filter(test.name, nil)
+		if included != test.expected {
+			t.Errorf("excludeFilter(%q)(%q) = %v, expected %v", test.patterns, test.name, included, test.expected)
+		}
+	}
+
+	// include is only called for files that are not excluded
+	var called []string
+	filter := excludeFilter([]string{"tmp"}, func(name string, _ os.FileInfo) bool {
+		called = append(called, name)
+		return name != "skip"
+	})
+	if filter("tmp/file", nil) || len(called) != 0 {
+		t.Errorf("include called for excluded file")
+	}
+	if !filter("file", nil) || filter("skip", nil) || len(called) != 2 {
+		t.Errorf("result of include not returned (called with %q)", called)
+	}
+}
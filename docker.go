@@ -0,0 +1,382 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dockerAPIVersion used for requests to the Docker engine (Docker 20.10 or newer)
+const dockerAPIVersion = "v1.41"
+
+// DockerClient for the Docker engine API over the unix socket or TCP
+type DockerClient struct {
+	baseURL string
+	client  *http.Client
+}
+
+// DockerContainer returned by the container list
+type DockerContainer struct {
+	ID      string            `json:"Id"`
+	Names   []string          `json:"Names"`
+	Image   string            `json:"Image"`
+	Created int64             `json:"Created"`
+	State   string            `json:"State"`
+	Status  string            `json:"Status"`
+	Labels  map[string]string `json:"Labels"`
+	Mounts  []DockerMount     `json:"Mounts"`
+}
+
+// DockerMount of a container
+type DockerMount struct {
+	Type        string `json:"Type"`
+	Name        string `json:"Name"`
+	Source      string `json:"Source"`
+	Destination string `json:"Destination"`
+}
+
+// DockerVolume returned by the volume list
+type DockerVolume struct {
+	Name       string            `json:"Name"`
+	Mountpoint string            `json:"Mountpoint"`
+	Labels     map[string]string `json:"Labels"`
+}
+
+// NewDockerClient for the given host (unix:///path or tcp://host:port)
+func NewDockerClient(host string) (*DockerClient, error) {
+	hostURL, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid docker host %s: %w", host, err)
+	}
+
+	switch hostURL.Scheme {
+	case "unix":
+		return &DockerClient{
+			baseURL: "http://docker/" + dockerAPIVersion,
+			client: &http.Client{
+				Transport: &http.Transport{
+					DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+						var dialer net.Dialer
+						return dialer.DialContext(ctx, "unix", hostURL.Path)
+					},
+				},
+			},
+		}, nil
+	case "tcp", "http":
+		return &DockerClient{
+			baseURL: "http://" + hostURL.Host + "/" + dockerAPIVersion,
+			client:  &http.Client{},
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported docker host %s", host)
+	}
+}
+
+// Close idle connections of the client
+func (c *DockerClient) Close() {
+	c.client.CloseIdleConnections()
+}
+
+// do request to the Docker engine and return the response (body must be closed by caller)
+func (c *DockerClient) do(method, path string, query url.Values, body any) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	target := c.baseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	request, err := http.NewRequest(method, target, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	response, err := c.client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to docker: %w", err)
+	}
+	if response.StatusCode >= 400 {
+		defer response.Body.Close()
+		var apiError struct {
+			Message string `json:"message"`
+		}
+		_ = json.NewDecoder(response.Body).Decode(&apiError)
+		return nil, fmt.Errorf("docker %s %s failed: %s", method, path, strings.TrimSpace(apiError.Message))
+	}
+	return response, nil
+}
+
+// request to the Docker engine with a JSON result (ignored if nil)
+func (c *DockerClient) request(method, path string, query url.Values, body, result any) error {
+	response, err := c.do(method, path, query, body)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if result == nil {
+		_, err = io.Copy(io.Discard, response.Body)
+		return err
+	}
+	err = json.NewDecoder(response.Body).Decode(result)
+	if err != nil {
+		return fmt.Errorf("failed to decode docker response: %w", err)
+	}
+	return nil
+}
+
+// dockerFilters encodes the filters of list requests
+func dockerFilters(filters map[string][]string) url.Values {
+	query := url.Values{}
+	if len(filters) > 0 {
+		data, _ := json.Marshal(filters)
+		query.Set("filters", string(data))
+	}
+	return query
+}
+
+// Containers with the given filters (including stopped containers if all is set)
+func (c *DockerClient) Containers(all bool, filters map[string][]string) ([]DockerContainer, error) {
+	query := dockerFilters(filters)
+	if all {
+		query.Set("all", "true")
+	}
+
+	var containers []DockerContainer
+	err := c.request(http.MethodGet, "/containers/json", query, nil, &containers)
+	return containers, err
+}
+
+// Volumes with the given filters
+func (c *DockerClient) Volumes(filters map[string][]string) ([]DockerVolume, error) {
+	var result struct {
+		Volumes []DockerVolume `json:"Volumes"`
+	}
+	err := c.request(http.MethodGet, "/volumes", dockerFilters(filters), nil, &result)
+	return result.Volumes, err
+}
+
+// Name of the container without leading slash
+func (c DockerContainer) Name() string {
+	if len(c.Names) == 0 {
+		return c.ID[:min(12, len(c.ID))]
+	}
+	return strings.TrimPrefix(c.Names[0], "/")
+}
+
+// hostPath of the given path inside the container
+func (c DockerContainer) hostPath(path string) (string, error) {
+	var mount *DockerMount
+	for i, m := range c.Mounts {
+		if path != m.Destination && !strings.HasPrefix(path, strings.TrimSuffix(m.Destination, "/")+"/") {
+			continue
+		}
+		if mount == nil || len(m.Destination) > len(mount.Destination) {
+			mount = &c.Mounts[i]
+		}
+	}
+	if mount == nil {
+		return "", fmt.Errorf("path %s of container %s is not a mount", path, c.Name())
+	}
+	return mount.Source + strings.TrimPrefix(path, mount.Destination), nil
+}
+
+// Exec runs the command inside the container and writes the output to stdout and stderr
+func (c *DockerClient) Exec(container string, command, env []string, stdout, stderr io.Writer) error {
+	var created struct {
+		ID string `json:"Id"`
+	}
+	err := c.request(http.MethodPost, "/containers/"+url.PathEscape(container)+"/exec", nil, map[string]any{
+		"AttachStdout": true,
+		"AttachStderr": true,
+		"Cmd":          command,
+		"Env":          env,
+	}, &created)
+	if err != nil {
+		return err
+	}
+
+	response, err := c.do(http.MethodPost, "/exec/"+created.ID+"/start", nil, map[string]any{
+		"Detach": false,
+		"Tty":    false,
+	})
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	err = demuxDockerStream(response.Body, stdout, stderr)
+	if err != nil {
+		return fmt.Errorf("failed to read output of %s: %w", command[0], err)
+	}
+
+	var inspect struct {
+		ExitCode int `json:"ExitCode"`
+	}
+	err = c.request(http.MethodGet, "/exec/"+created.ID+"/json", nil, nil, &inspect)
+	if err != nil {
+		return err
+	}
+	if inspect.ExitCode != 0 {
+		return fmt.Errorf("%s in container %s exited with code %d", command[0], container, inspect.ExitCode)
+	}
+	return nil
+}
+
+// demuxDockerStream splits the multiplexed stdout and stderr stream of the Docker engine
+func demuxDockerStream(reader io.Reader, stdout, stderr io.Writer) error {
+	header := make([]byte, 8)
+	for {
+		_, err := io.ReadFull(reader, header)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		target := stdout
+		if header[0] == 2 {
+			target = stderr
+		}
+		if target == nil {
+			target = io.Discard
+		}
+		_, err = io.CopyN(target, reader, int64(binary.BigEndian.Uint32(header[4:])))
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// DockerEvent of the events stream
+type DockerEvent struct {
+	Type   string `json:"Type"`
+	Action string `json:"Action"`
+	Actor  struct {
+		ID         string            `json:"ID"`
+		Attributes map[string]string `json:"Attributes"`
+	} `json:"Actor"`
+}
+
+// Events streams the events matching the filters to handle until ctx is done or the stream fails
+func (c *DockerClient) Events(ctx context.Context, filters map[string][]string, handle func(DockerEvent)) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		c.baseURL+"/events?"+dockerFilters(filters).Encode(), nil)
+	if err != nil {
+		return err
+	}
+	response, err := c.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("failed to connect to docker: %w", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= 400 {
+		return fmt.Errorf("docker events failed with status %s", response.Status)
+	}
+
+	decoder := json.NewDecoder(response.Body)
+	for {
+		var event DockerEvent
+		if err := decoder.Decode(&event); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("failed to read docker events: %w", err)
+		}
+		handle(event)
+	}
+}
+
+// RemoveVolume with the given name
+func (c *DockerClient) RemoveVolume(name string) error {
+	return c.request(http.MethodDelete, "/volumes/"+url.PathEscape(name), nil, nil, nil)
+}
+
+// DockerBuildCachePrune result of a build cache prune
+type DockerBuildCachePrune struct {
+	CachesDeleted  []string `json:"CachesDeleted"`
+	SpaceReclaimed int64    `json:"SpaceReclaimed"`
+}
+
+// PruneBuildCache of the builder while keeping the given amount of storage (all cache if keepStorage is 0)
+func (c *DockerClient) PruneBuildCache(keepStorage int64, all bool) (DockerBuildCachePrune, error) {
+	query := url.Values{"all": {strconv.FormatBool(all)}}
+	if keepStorage > 0 {
+		query.Set("keep-storage", strconv.FormatInt(keepStorage, 10))
+	}
+	var result DockerBuildCachePrune
+	err := c.request(http.MethodPost, "/build/prune", query, nil, &result)
+	return result, err
+}
+
+// DockerContainerState of an inspected container
+type DockerContainerState struct {
+	Status     string    `json:"Status"`
+	FinishedAt time.Time `json:"FinishedAt"`
+	Health     *struct {
+		Status string `json:"Status"`
+	} `json:"Health"`
+}
+
+// healthy returns true if the container is running and not reported unhealthy
+// by its health check (containers without health check only have to run)
+func (s DockerContainerState) healthy() bool {
+	if s.Status != "running" {
+		return false
+	}
+	return s.Health == nil || s.Health.Status == "healthy"
+}
+
+// health status of the container (health check status or state if no health check is defined)
+func (s DockerContainerState) health() string {
+	if s.Health != nil && s.Status == "running" {
+		return s.Health.Status
+	}
+	return s.Status
+}
+
+// DockerContainerInspect with the details of a container
+type DockerContainerInspect struct {
+	Name    string               `json:"Name"`
+	State   DockerContainerState `json:"State"`
+	LogPath string               `json:"LogPath"`
+	Config  struct {
+		Labels map[string]string `json:"Labels"`
+	} `json:"Config"`
+}
+
+// InspectContainer with the given ID or name
+func (c *DockerClient) InspectContainer(id string) (DockerContainerInspect, error) {
+	var inspect DockerContainerInspect
+	err := c.request(http.MethodGet, "/containers/"+url.PathEscape(id)+"/json", nil, nil, &inspect)
+	return inspect, err
+}
+
+// RemoveContainer with the given ID or name (including anonymous volumes)
+func (c *DockerClient) RemoveContainer(id string) error {
+	return c.request(http.MethodDelete, "/containers/"+url.PathEscape(id), url.Values{"v": {"true"}}, nil, nil)
+}
+
+// RestartContainer with the given ID or name
+func (c *DockerClient) RestartContainer(id string) error {
+	return c.request(http.MethodPost, "/containers/"+url.PathEscape(id)+"/restart", nil, nil, nil)
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// labelProtect excludes containers and volumes from cleanup tasks if set to true
+const labelProtect = "housekeeper.protect"
+
+// protected returns true if the labels contain the protection label
+func protected(labels map[string]string) bool {
+	return strings.EqualFold(labels[labelProtect], "true")
+}
+
+// PruneVolumes removes volumes that are not used by any container
+func (s *MaintenanceService) PruneVolumes() error {
+	return s.run("volume prune", s.pruneVolumes)
+}
+
+// pruneVolumes removes unused volumes matching the configured labels
+func (s *MaintenanceService) pruneVolumes() error {
+	filters := map[string][]string{"dangling": {"true"}}
+	if len(s.Config.VolumePruneLabels) > 0 {
+		filters["label"] = s.Config.VolumePruneLabels
+	}
+	volumes, err := s.Docker.Volumes(filters)
+	if err != nil {
+		return err
+	}
+
+	if s.Config.VolumePruneDryRun {
+		s.logger().Printf("volume prune (dry run) ...")
+	} else {
+		s.logger().Printf("volume prune ...")
+	}
+
+	var removed int
+	for _, volume := range volumes {
+		if protected(volume.Labels) {
+			s.logger().Printf("-> %s (protected)", volume.Name)
+			continue
+		}
+		if s.Config.VolumePruneDryRun {
+			s.logger().Printf("-> %s (would be removed)", volume.Name)
+			continue
+		}
+
+		if err := s.Docker.RemoveVolume(volume.Name); err != nil {
+			return err
+		}
+		s.logger().Printf("-> %s removed", volume.Name)
+		removed++
+	}
+
+	s.logger().Printf("volume prune finished (%d removed)", removed)
+	return nil
+}
+
+// CleanupContainers removes exited containers older than the configured age
+func (s *MaintenanceService) CleanupContainers() error {
+	return s.runDetailed("container cleanup", s.cleanupContainers)
+}
+
+// cleanupContainers removes exited or dead containers that finished before the configured age
+func (s *MaintenanceService) cleanupContainers() (string, error) {
+	age := s.Config.ContainerCleanupAge
+	containers, err := s.Docker.Containers(true, map[string][]string{"status": {"exited", "dead"}})
+	if err != nil {
+		return "", err
+	}
+
+	s.logger().Printf("container cleanup ...")
+	var removed []string
+	for _, container := range containers {
+		if protected(container.Labels) {
+			continue
+		}
+
+		inspect, err := s.Docker.InspectContainer(container.ID)
+		if err != nil {
+			return strings.Join(removed, ", "), err
+		}
+		state := inspect.State
+		if time.Since(state.FinishedAt) < age {
+			continue
+		}
+
+		if err := s.Docker.RemoveContainer(container.ID); err != nil {
+			return strings.Join(removed, ", "), err
+		}
+		s.logger().Printf("-> %s removed (%s since %s)", container.Name(), state.Status, state.FinishedAt.Format(time.RFC3339))
+		removed = append(removed, container.Name())
+	}
+
+	s.logger().Printf("container cleanup finished (%d removed)", len(removed))
+	if len(removed) == 0 {
+		return "", nil
+	}
+	return "Removed " + strings.Join(removed, ", "), nil
+}
+
+// logFreedTotal counts the bytes freed by truncating container logs
+var logFreedTotal = metrics.counter("housekeeper_log_freed_bytes_total",
+	"Bytes freed by truncating container log files")
+
+// TruncateLogs of containers larger than the configured size
+func (s *MaintenanceService) TruncateLogs() error {
+	return s.runDetailed("log truncate", s.truncateLogs)
+}
+
+// truncateLogs of containers larger than the configured size (rotated to <log>.1 if enabled)
+func (s *MaintenanceService) truncateLogs() (string, error) {
+	maxSize, err := parseSize(s.Config.LogMaxSize)
+	if err != nil {
+		return "", err
+	}
+	containers, err := s.Docker.Containers(true, nil)
+	if err != nil {
+		return "", err
+	}
+
+	s.logger().Printf("log truncate ...")
+	var freed int64
+	var truncated int
+	for _, container := range containers {
+		if protected(container.Labels) {
+			continue
+		}
+		inspect, err := s.Docker.InspectContainer(container.ID)
+		if err != nil {
+			return "", err
+		}
+		// logs of other log drivers are not stored in files
+		if inspect.LogPath == "" {
+			continue
+		}
+
+		logPath := filepath.Join(s.Config.DockerRoot, inspect.LogPath)
+		info, err := os.Stat(logPath)
+		if err != nil {
+			return "", fmt.Errorf("failed to access log of %s: %w", container.Name(), err)
+		}
+		if info.Size() <= maxSize {
+			continue
+		}
+
+		// rotated logs only free the space of the previous rotated log
+		size := info.Size()
+		if s.Config.LogRotate {
+			size = 0
+			if rotated, err := os.Stat(logPath + ".1"); err == nil {
+				size = rotated.Size()
+			}
+			if err := copyFile(logPath, logPath+".1"); err != nil {
+				return "", fmt.Errorf("failed to rotate log of %s: %w", container.Name(), err)
+			}
+		}
+		// the json-file driver appends to the file, so truncating is safe while the container runs
+		if err := os.Truncate(logPath, 0); err != nil {
+			return "", fmt.Errorf("failed to truncate log of %s: %w", container.Name(), err)
+		}
+		s.logger().Printf("-> %s truncated (%s)", container.Name(), formatSize(info.Size()))
+		logFreedTotal.add("", float64(size))
+		freed += size
+		truncated++
+	}
+
+	s.logger().Printf("log truncate finished (%s freed)", formatSize(freed))
+	if truncated == 0 {
+		return "", nil
+	}
+	return fmt.Sprintf("Freed %s of %d container logs", formatSize(freed), truncated), nil
+}
+
+// buildCacheReclaimedTotal counts the bytes reclaimed by pruning the build cache
+var buildCacheReclaimedTotal = metrics.counter("housekeeper_build_cache_reclaimed_bytes_total",
+	"Bytes reclaimed by pruning the Docker build cache")
+
+// PruneBuildCache of the Docker builder down to the configured storage
+func (s *MaintenanceService) PruneBuildCache() error {
+	return s.runDetailed("build cache prune", s.pruneBuildCache)
+}
+
+// pruneBuildCache of the Docker builder while keeping the configured storage
+func (s *MaintenanceService) pruneBuildCache() (string, error) {
+	keepStorage, err := parseSize(s.Config.BuildCacheKeepStorage)
+	if err != nil {
+		return "", err
+	}
+
+	s.logger().Printf("build cache prune ...")
+	result, err := s.Docker.PruneBuildCache(keepStorage, s.Config.BuildCachePruneAll)
+	if err != nil {
+		return "", err
+	}
+	buildCacheReclaimedTotal.add("", float64(result.SpaceReclaimed))
+
+	s.logger().Printf("build cache prune finished (%d entries, %s reclaimed)",
+		len(result.CachesDeleted), formatSize(result.SpaceReclaimed))
+	if len(result.CachesDeleted) == 0 {
+		return "", nil
+	}
+	return fmt.Sprintf("Reclaimed %s of %d build cache entries",
+		formatSize(result.SpaceReclaimed), len(result.CachesDeleted)), nil
+}
+
+// copyFile from source to target (replaced if it exists)
+func copyFile(source, target string) error {
+	reader, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	writer, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(writer, reader); err != nil {
+		writer.Close()
+		return err
+	}
+	return writer.Close()
+}
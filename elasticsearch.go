@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ElasticsearchConnection used to create snapshots of an Elasticsearch cluster
+type ElasticsearchConnection struct {
+	Config DatabaseConfig
+
+	// BaseURL of the Elasticsearch REST API
+	BaseURL string
+}
+
+// NewElasticsearchConnection from the given configuration
+func NewElasticsearchConnection(config DatabaseConfig) *ElasticsearchConnection {
+	if config.Port == 0 {
+		config.Port = 9200
+	}
+	if config.SnapshotRepository == "" {
+		config.SnapshotRepository = "housekeeper"
+	}
+
+	return &ElasticsearchConnection{
+		Config:  config,
+		BaseURL: fmt.Sprintf("http://%s:%d", config.Host, config.Port),
+	}
+}
+
+// request to the Elasticsearch API, body is encoded as JSON and the
+// response is decoded into result if given
+func (c *ElasticsearchConnection) request(method, path string, body, result any) error {
+	var bodyReader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		bodyReader = bytes.NewReader(data)
+	}
+
+	request, err := http.NewRequest(method, c.BaseURL+path, bodyReader)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if c.Config.Username != "" {
+		request.SetBasicAuth(c.Config.Username, c.Config.Password)
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= 300 {
+		message, _ := io.ReadAll(response.Body)
+		return fmt.Errorf("%s %s failed with %s: %s", method, path, response.Status, message)
+	}
+
+	if result != nil {
+		return json.NewDecoder(response.Body).Decode(result)
+	}
+	return nil
+}
+
+// WaitForConnection for a maximum of duration
+func (c *ElasticsearchConnection) WaitForConnection(duration time.Duration) error {
+	// ticker to check every second for a connection
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+
+	timeoutExceeded := time.After(duration)
+	for {
+		select {
+		case <-timeoutExceeded:
+			return errors.New("timeout while trying to connect to elasticsearch")
+
+		case <-ticker.C:
+			err := c.request(http.MethodGet, "/_cluster/health", nil, nil)
+			if err == nil {
+				return nil
+			}
+		}
+	}
+}
+
+// Init registers the shared filesystem snapshot repository
+func (c *ElasticsearchConnection) Init() error {
+	c.Config.logger().Printf("register snapshot repository %s ...", c.Config.SnapshotRepository)
+
+	err := c.request(http.MethodPut, "/_snapshot/"+url.PathEscape(c.Config.SnapshotRepository), map[string]any{
+		"type": "fs",
+		"settings": map[string]any{
+			"location": c.Config.SnapshotDirectory,
+		},
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to register snapshot repository: %w", err)
+	}
+	return nil
+}
+
+// BackupFilename of the snapshot repository archive inside the backup
+func (c *ElasticsearchConnection) BackupFilename() string {
+	return "snapshot.tar"
+}
+
+// Backup creates a snapshot and writes the snapshot repository to the given writer
+func (c *ElasticsearchConnection) Backup(writer io.Writer) error {
+	snapshot := fmt.Sprintf("housekeeper_%d", time.Now().Unix())
+	snapshotPath := fmt.Sprintf("/_snapshot/%s/%s",
+		url.PathEscape(c.Config.SnapshotRepository), snapshot)
+
+	// create snapshot and wait until it is finished
+	var result struct {
+		Snapshot struct {
+			State string `json:"state"`
+		} `json:"snapshot"`
+	}
+	err := c.request(http.MethodPut, snapshotPath+"?wait_for_completion=true", nil, &result)
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot: %w", err)
+	}
+	if !strings.EqualFold(result.Snapshot.State, "SUCCESS") {
+		return fmt.Errorf("snapshot %s finished with state %s", snapshot, result.Snapshot.State)
+	}
+
+	// archive repository with the completed snapshot
+	err = writeTar(writer, c.Config.SnapshotDirectory)
+	if err != nil {
+		return fmt.Errorf("failed to archive snapshot repository: %w", err)
+	}
+
+	// remove snapshot again to keep the repository small
+	err = c.request(http.MethodDelete, snapshotPath, nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to delete snapshot: %w", err)
+	}
+	return nil
+}
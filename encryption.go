@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/plugin"
+	"github.com/ProtonMail/go-crypto/openpgp"
+)
+
+// Encryption of backup files
+type Encryption interface {
+	// Extension of encrypted backup files
+	Extension() string
+	// Encrypt everything written to the returned writer into writer
+	Encrypt(writer io.Writer) (io.WriteCloser, error)
+	// Decrypt the content of reader
+	Decrypt(reader io.Reader) (io.Reader, error)
+}
+
+// AgeEncryption of backup files with age
+type AgeEncryption struct {
+	Recipients []age.Recipient
+	Identities []age.Identity
+}
+
+// Extension of encrypted backup files
+func (e *AgeEncryption) Extension() string {
+	return ".age"
+}
+
+// Encrypt everything written to the returned writer into writer
+func (e *AgeEncryption) Encrypt(writer io.Writer) (io.WriteCloser, error) {
+	if len(e.Recipients) == 0 {
+		return nil, errors.New("no age recipient is configured")
+	}
+	encrypted, err := age.Encrypt(writer, e.Recipients...)
+	if err != nil {
+		return nil, fmt.Errorf("failed age encryption: %w", err)
+	}
+	return encrypted, nil
+}
+
+// Decrypt the content of reader
+func (e *AgeEncryption) Decrypt(reader io.Reader) (io.Reader, error) {
+	if len(e.Identities) == 0 {
+		return nil, errors.New("backup is encrypted but no age identity is configured")
+	}
+	decrypted, err := age.Decrypt(reader, e.Identities...)
+	if err != nil {
+		return nil, fmt.Errorf("failed age decryption: %w", err)
+	}
+	return decrypted, nil
+}
+
+// GPGEncryption of backup files with OpenPGP
+type GPGEncryption struct {
+	Recipients openpgp.EntityList
+	Keys       openpgp.EntityList
+}
+
+// Extension of encrypted backup files
+func (e *GPGEncryption) Extension() string {
+	return ".gpg"
+}
+
+// Encrypt everything written to the returned writer into writer
+func (e *GPGEncryption) Encrypt(writer io.Writer) (io.WriteCloser, error) {
+	if len(e.Recipients) == 0 {
+		return nil, errors.New("no gpg recipient is configured")
+	}
+	encrypted, err := openpgp.Encrypt(writer, e.Recipients, nil, &openpgp.FileHints{IsBinary: true}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed gpg encryption: %w", err)
+	}
+	return encrypted, nil
+}
+
+// Decrypt the content of reader
+func (e *GPGEncryption) Decrypt(reader io.Reader) (io.Reader, error) {
+	if len(e.Keys) == 0 {
+		return nil, errors.New("backup is encrypted but no gpg key is configured")
+	}
+	message, err := openpgp.ReadMessage(reader, e.Keys, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed gpg decryption: %w", err)
+	}
+	return message.UnverifiedBody, nil
+}
+
+// readGPGKeyRing from an armored or binary key file
+func readGPGKeyRing(filename string) (openpgp.EntityList, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read gpg key file: %w", err)
+	}
+
+	var keyRing openpgp.EntityList
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "-----BEGIN") {
+		keyRing, err = openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+	} else {
+		keyRing, err = openpgp.ReadKeyRing(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse gpg key file %s: %w", filename, err)
+	}
+	return keyRing, nil
+}
+
+// encryption used for new backups (nil if backups are not encrypted)
+func (c *BackupConfig) encryption() (Encryption, error) {
+	switch c.Encryption {
+	case "none":
+		return nil, nil
+
+	case "gpg":
+		recipients, err := readGPGKeyRing(c.GPGRecipientsFile)
+		if err != nil {
+			return nil, err
+		}
+		return &GPGEncryption{Recipients: recipients}, nil
+
+	default:
+		recipients, err := c.ageRecipients()
+		if err != nil {
+			return nil, err
+		}
+		// age encryption is enabled implicitly by configured recipients
+		if len(recipients) == 0 && c.Encryption == "" {
+			return nil, nil
+		}
+		return &AgeEncryption{Recipients: recipients}, nil
+	}
+}
+
+// canDecrypt returns true if backups can be decrypted without user interaction
+// (age plugins may wait for a hardware token)
+func (c *BackupConfig) canDecrypt() bool {
+	encryption, err := c.encryption()
+	if err != nil {
+		return false
+	}
+	switch encryption.(type) {
+	case nil:
+		return true
+	case *GPGEncryption:
+		return c.GPGKeyFile != ""
+	default:
+		identities, err := c.ageIdentities()
+		if err != nil || len(identities) == 0 {
+			return false
+		}
+		for _, identity := range identities {
+			if _, ok := identity.(*plugin.Identity); ok {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// decryption for the given backup file (nil if the file is not encrypted)
+func (c *BackupConfig) decryption(filename string, ageIdentities []age.Identity) (Encryption, error) {
+	switch {
+	case strings.HasSuffix(filename, ".age"):
+		identities, err := c.ageIdentities()
+		if err != nil {
+			return nil, err
+		}
+		return &AgeEncryption{Identities: append(identities, ageIdentities...)}, nil
+
+	case strings.HasSuffix(filename, ".gpg"):
+		encryption := new(GPGEncryption)
+		if c.GPGKeyFile == "" {
+			return encryption, nil
+		}
+
+		keys, err := readGPGKeyRing(c.GPGKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		if c.GPGPassphrase != "" {
+			for _, key := range keys {
+				if err = key.DecryptPrivateKeys([]byte(c.GPGPassphrase)); err != nil {
+					return nil, fmt.Errorf("failed to unlock gpg key: %w", err)
+				}
+			}
+		}
+		encryption.Keys = keys
+		return encryption, nil
+
+	default:
+		return nil, nil
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cast"
+)
+
+// EtcdConnection used for snapshot backups of etcd
+type EtcdConnection struct {
+	Config DatabaseConfig
+
+	// Endpoints of etcd cluster (host:port)
+	Endpoints []string
+
+	// info of the last snapshot
+	info map[string]string
+}
+
+// NewEtcdConnection from the given configuration
+func NewEtcdConnection(config DatabaseConfig) *EtcdConnection {
+	if config.Port == 0 {
+		config.Port = 2379
+	}
+
+	conf := EtcdConnection{
+		Config: config,
+	}
+
+	// DB_HOST may contain a comma separated list of cluster members
+	for _, host := range strings.Split(config.Host, ",") {
+		host = strings.TrimSpace(host)
+		if host == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(host); err != nil {
+			host = net.JoinHostPort(host, cast.ToString(config.Port))
+		}
+		conf.Endpoints = append(conf.Endpoints, host)
+	}
+	return &conf
+}
+
+// command for etcdctl with connection arguments for all endpoints
+func (c *EtcdConnection) command(args ...string) *exec.Cmd {
+	return c.endpointCommand(strings.Join(c.Endpoints, ","), args...)
+}
+
+// endpointCommand for etcdctl connected to the given endpoints
+func (c *EtcdConnection) endpointCommand(endpoints string, args ...string) *exec.Cmd {
+	cmdArgs := []string{"--endpoints", endpoints}
+	cmd := exec.Command("etcdctl", append(cmdArgs, args...)...)
+
+	// pass credentials via env to keep them out of the process list
+	env := os.Environ()
+	if c.Config.Username != "" {
+		env = append(env, "ETCDCTL_USER="+c.Config.Username+":"+c.Config.Password)
+	}
+	cmd.Env = env
+	cmd.Stderr = os.Stderr
+	return cmd
+}
+
+// WaitForConnection for a maximum of duration
+func (c *EtcdConnection) WaitForConnection(duration time.Duration) error {
+	// ticker to check every second for a connection
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+
+	timeoutExceeded := time.After(duration)
+	for {
+		select {
+		case <-timeoutExceeded:
+			return errors.New("timeout while trying to connect to etcd")
+
+		case <-ticker.C:
+			cmd := c.command("endpoint", "health")
+			cmd.Stderr = nil
+			if cmd.Run() == nil {
+				return nil
+			}
+		}
+	}
+}
+
+// Init is not required for etcd
+func (c *EtcdConnection) Init() error {
+	c.Config.logger().Print("etcd -> skip user and database creation")
+	return nil
+}
+
+// BackupFilename of the snapshot inside the backup
+func (c *EtcdConnection) BackupFilename() string {
+	return "snapshot.db"
+}
+
+// Backup etcd snapshot to the given writer
+func (c *EtcdConnection) Backup(writer io.Writer) error {
+	dir, err := os.MkdirTemp("", "etcd_backup_")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	snapshotFile := filepath.Join(dir, "snapshot.db")
+	err = c.saveSnapshot(snapshotFile)
+	if err != nil {
+		return fmt.Errorf("failed to save etcd snapshot: %w", err)
+	}
+
+	// read snapshot details for backup meta data
+	var status struct {
+		Hash      uint32 `json:"hash"`
+		Revision  int64  `json:"revision"`
+		TotalKey  int    `json:"totalKey"`
+		TotalSize int64  `json:"totalSize"`
+	}
+	cmd := c.command("snapshot", "status", snapshotFile, "--write-out", "json")
+	output, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("failed to get etcd snapshot status: %w", err)
+	}
+	if err = json.Unmarshal(output, &status); err != nil {
+		return fmt.Errorf("failed to parse etcd snapshot status: %w", err)
+	}
+	c.info = map[string]string{
+		"hash":       cast.ToString(status.Hash),
+		"revision":   cast.ToString(status.Revision),
+		"total_keys": cast.ToString(status.TotalKey),
+		"total_size": cast.ToString(status.TotalSize),
+	}
+
+	file, err := os.Open(snapshotFile)
+	if err != nil {
+		return fmt.Errorf("failed to open etcd snapshot: %w", err)
+	}
+	defer file.Close()
+
+	_, err = io.Copy(writer, file)
+	return err
+}
+
+// saveSnapshot to file from the first endpoint that succeeds
+// (snapshot save only accepts a single endpoint)
+func (c *EtcdConnection) saveSnapshot(file string) error {
+	err := errors.New("no etcd endpoint configured")
+	for _, endpoint := range c.Endpoints {
+		cmd := c.endpointCommand(endpoint, "snapshot", "save", file)
+		cmd.Stdout = os.Stderr
+		if err = cmd.Run(); err == nil {
+			return nil
+		}
+		c.Config.logger().Warn("etcd -> failed to save snapshot", "endpoint", endpoint, "error", err)
+		_ = os.Remove(file)
+	}
+	return err
+}
+
+// BackupInfo of the last snapshot
+func (c *EtcdConnection) BackupInfo() map[string]string {
+	return c.info
+}
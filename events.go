@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// eventRetryDelay before reconnecting to the Docker events stream
+const eventRetryDelay = 10 * time.Second
+
+// eventRule triggers a backup on a Docker event (e.g. "stop:app")
+type eventRule struct {
+	// Action of the event (e.g. stop, die, pull)
+	Action string
+	// Name of the container or image ("*" for all)
+	Name string
+}
+
+// parseEventRules from a list of "<action>:<container or image>" entries
+func parseEventRules(value string) ([]eventRule, error) {
+	var rules []eventRule
+	for _, entry := range splitList(value) {
+		action, name, ok := strings.Cut(entry, ":")
+		if !ok || action == "" || name == "" {
+			return nil, fmt.Errorf("invalid backup event rule %s (expected <action>:<name>)", entry)
+		}
+		rules = append(rules, eventRule{Action: action, Name: name})
+	}
+	return rules, nil
+}
+
+// matches returns true if the rule matches the event of a container or image
+func (r eventRule) matches(event DockerEvent) bool {
+	if event.Action != r.Action {
+		return false
+	}
+	if r.Name == "*" {
+		return true
+	}
+	name := event.Actor.Attributes["name"]
+	return name == r.Name || event.Actor.ID == r.Name ||
+		(event.Type == "image" && strings.TrimSuffix(event.Actor.ID, ":latest") == r.Name)
+}
+
+// EventListener starts backups of jobs on matching Docker events
+type EventListener struct {
+	Docker *DockerClient
+	Jobs   []*BackupService
+
+	cancel context.CancelFunc
+}
+
+// logger of the events component
+func (l *EventListener) logger() Logger {
+	return newLogger("events")
+}
+
+// Start listening on the Docker events stream
+func (l *EventListener) Start() error {
+	actions := make(map[string]bool)
+	for _, job := range l.Jobs {
+		rules, err := parseEventRules(job.Config.Events)
+		if err != nil {
+			return err
+		}
+		for _, rule := range rules {
+			actions[rule.Action] = true
+		}
+	}
+	if len(actions) == 0 {
+		return nil
+	}
+
+	filters := map[string][]string{"type": {"container", "image"}}
+	for action := range actions {
+		filters["event"] = append(filters["event"], action)
+	}
+
+	var ctx context.Context
+	ctx, l.cancel = context.WithCancel(context.Background())
+	go func() {
+		for ctx.Err() == nil {
+			err := l.Docker.Events(ctx, filters, l.handle)
+			if err != nil {
+				l.logger().Warn("docker events failed -> retry", "error", err, "delay", eventRetryDelay)
+			}
+			select {
+			case <-ctx.Done():
+			case <-time.After(eventRetryDelay):
+			}
+		}
+	}()
+	l.logger().Print("[Listen for docker events]")
+	return nil
+}
+
+// handle event by starting the backup of all jobs with a matching rule
+func (l *EventListener) handle(event DockerEvent) {
+	for _, job := range l.Jobs {
+		rules, _ := parseEventRules(job.Config.Events)
+		for _, rule := range rules {
+			if !rule.matches(event) {
+				continue
+			}
+			l.logger().Printf("> %s triggered by %s event of %s %s",
+				strings.ToLower(job.title()), event.Action, event.Type, rule.Name)
+			go func() {
+				if err := job.Backup(); err != nil {
+					job.logger().Error("backup failed", "error", err)
+				}
+			}()
+			break
+		}
+	}
+}
+
+// Stop listening on the Docker events stream
+func (l *EventListener) Stop() {
+	if l.cancel != nil {
+		l.cancel()
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+)
+
+// toolRunner runs client tools of a database connection locally or
+// with docker exec inside the database container (DB_EXEC_CONTAINER)
+type toolRunner struct {
+	docker    *DockerClient
+	container string
+}
+
+// SetExecContainer runs client tools inside the given container
+func (r *toolRunner) SetExecContainer(docker *DockerClient, container string) {
+	r.docker, r.container = docker, container
+}
+
+// ExecContainer the client tools are run in (empty if run locally)
+func (r *toolRunner) ExecContainer() string {
+	return r.container
+}
+
+// remote returns true if client tools are run inside another container
+func (r *toolRunner) remote() bool {
+	return r.container != ""
+}
+
+// run the command locally or inside the container (stdin is not supported in containers)
+func (r *toolRunner) run(cmd *exec.Cmd) error {
+	if !r.remote() {
+		return cmd.Run()
+	}
+
+	// only variables set for the command are passed to the container
+	var env []string
+	environ := os.Environ()
+	for _, entry := range cmd.Env {
+		if !slices.Contains(environ, entry) {
+			env = append(env, entry)
+		}
+	}
+
+	command := append([]string{filepath.Base(cmd.Args[0])}, cmd.Args[1:]...)
+	return r.docker.Exec(r.container, command, env, cmd.Stdout, cmd.Stderr)
+}
@@ -6,11 +6,17 @@ toolchain go1.23.2
 
 require (
 	filippo.io/age v1.2.0
+	github.com/ProtonMail/go-crypto v1.1.2
+	github.com/containrrr/shoutrrr v0.8.0
 	github.com/go-errors/errors v1.5.1
+	github.com/go-sql-driver/mysql v1.8.1
+	github.com/klauspost/compress v1.17.11
+	github.com/klauspost/reedsolomon v1.10.0
 	github.com/lib/pq v1.10.9
 	github.com/rclone/rclone v1.68.1
 	github.com/robfig/cron/v3 v3.0.1
 	github.com/spf13/cast v1.7.0
+	go.mongodb.org/mongo-driver/v2 v2.0.0
 	gopkg.in/yaml.v3 v3.0.1
 )
 
@@ -76,7 +82,6 @@ require (
 	github.com/jlaffaye/ftp v0.2.0 // indirect
 	github.com/jtolio/noiseconn v0.0.0-20231127013910-f6d9ecbf1de7 // indirect
 	github.com/jzelinskie/whirlpool v0.0.0-20201016144138-0675e54bb004 // indirect
-	github.com/klauspost/compress v1.17.11 // indirect
 	github.com/klauspost/cpuid/v2 v2.2.9 // indirect
 	github.com/koofr/go-httpclient v0.0.0-20240520111329-e20f8f203988 // indirect
 	github.com/koofr/go-koofrclient v0.0.0-20221207135200-cbd7fc9ad6a6 // indirect
@@ -148,9 +153,9 @@ require (
 require (
 	cloud.google.com/go/auth v0.10.1 // indirect
 	cloud.google.com/go/auth/oauth2adapt v0.2.5 // indirect
+	filippo.io/edwards25519 v1.1.0 // indirect
 	github.com/Files-com/files-sdk-go/v3 v3.2.79 // indirect
 	github.com/Microsoft/go-winio v0.6.2 // indirect
-	github.com/ProtonMail/go-crypto v1.1.2 // indirect
 	github.com/appscode/go-querystring v0.0.0-20170504095604-0126cfb3f1dc // indirect
 	github.com/aws/aws-sdk-go-v2 v1.32.4 // indirect
 	github.com/aws/aws-sdk-go-v2/aws/protocol/eventstream v1.6.6 // indirect
@@ -174,9 +179,11 @@ require (
 	github.com/bradfitz/iter v0.0.0-20191230175014-e8f45d346db8 // indirect
 	github.com/chilts/sid v0.0.0-20190607042430-660e94789ec9 // indirect
 	github.com/davecgh/go-spew v1.1.2-0.20180830191138-d8f796af33cc // indirect
+	github.com/fatih/color v1.16.0 // indirect
 	github.com/go-darwin/apfs v0.0.0-20211011131704-f84b94dbf348 // indirect
 	github.com/golang-jwt/jwt/v4 v4.5.1 // indirect
 	github.com/golang/groupcache v0.0.0-20210331224755-41bb18bfe9da // indirect
+	github.com/golang/snappy v0.0.4 // indirect
 	github.com/hashicorp/go-cleanhttp v0.5.2 // indirect
 	github.com/hashicorp/go-retryablehttp v0.7.7 // indirect
 	github.com/lpar/date v1.0.0 // indirect
@@ -189,6 +196,9 @@ require (
 	github.com/samber/lo v1.47.0 // indirect
 	github.com/stretchr/testify v1.9.0 // indirect
 	github.com/unknwon/goconfig v1.0.0 // indirect
+	github.com/xdg-go/pbkdf2 v1.0.0 // indirect
+	github.com/xdg-go/scram v1.1.2 // indirect
+	github.com/xdg-go/stringprep v1.0.4 // indirect
 	golang.org/x/term v0.26.0 // indirect
 	google.golang.org/genproto/googleapis/api v0.0.0-20241007155032-5fefd90f89a9 // indirect
 	moul.io/http2curl/v2 v2.3.0 // indirect
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// GotifyNotifier sends push notifications via a Gotify server
+type GotifyNotifier struct {
+	URL   string
+	Token string
+}
+
+// gotifyMessage sent to the server
+type gotifyMessage struct {
+	Title    string `json:"title"`
+	Message  string `json:"message"`
+	Priority int    `json:"priority"`
+}
+
+// Notify Gotify about the task result (failures with high priority)
+func (n *GotifyNotifier) Notify(notification Notification) error {
+	message := gotifyMessage{
+		Title:    notification.Title(),
+		Message:  notification.Message(),
+		Priority: 2,
+	}
+	if !notification.Success() {
+		message.Priority = 8
+	}
+
+	err := postJSON(strings.TrimSuffix(n.URL, "/")+"/message?token="+url.QueryEscape(n.Token), message)
+	if err != nil {
+		return fmt.Errorf("gotify: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// HealthchecksNotifier pings a healthchecks.io check (dead man's switch) for backups
+type HealthchecksNotifier struct {
+	URL string
+}
+
+// NotifyStart pings /start before a backup to measure its duration
+func (n *HealthchecksNotifier) NotifyStart(task string) error {
+	if task != "backup" {
+		return nil
+	}
+	return n.ping("/start", "")
+}
+
+// Notify pings the check on success and /fail with the error on failure
+func (n *HealthchecksNotifier) Notify(notification Notification) error {
+	if notification.Task != "backup" {
+		return nil
+	}
+	if !notification.Success() {
+		return n.ping("/fail", notification.Error.Error())
+	}
+	return n.ping("", notification.Message())
+}
+
+// ping the check with the given suffix and the message as body
+func (n *HealthchecksNotifier) ping(suffix, message string) error {
+	url := strings.TrimSuffix(n.URL, "/") + suffix
+	response, err := notifyClient.Post(url, "text/plain", strings.NewReader(message))
+	if err != nil {
+		return fmt.Errorf("healthchecks: %w", err)
+	}
+	defer response.Body.Close()
+	_, _ = io.Copy(io.Discard, response.Body)
+
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("healthchecks: unexpected status %s", response.Status)
+	}
+	return nil
+}
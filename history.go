@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// backupHistoryFile in the storage directory contains the metrics of the last backup runs
+const backupHistoryFile = ".backup_history.json"
+
+// backupHistoryLength is the number of runs kept in the history
+const backupHistoryLength = 30
+
+var (
+	backupSizeBytes = metrics.gauge("housekeeper_backup_size_bytes",
+		"Size of the backup file of the last successful backup")
+	backupRawSizeBytes = metrics.gauge("housekeeper_backup_raw_size_bytes",
+		"Size of the archived files and database dumps of the last successful backup")
+	backupFiles = metrics.gauge("housekeeper_backup_files",
+		"Number of archived files of the last successful backup")
+	backupDurationSeconds = metrics.gauge("housekeeper_backup_duration_seconds",
+		"Duration of the last successful backup")
+	backupUploadDurationSeconds = metrics.gauge("housekeeper_backup_upload_duration_seconds",
+		"Duration of the upload to the rclone remote of the last successful backup")
+)
+
+// backupStats collected while a backup is created
+type backupStats struct {
+	// files and rawSize of all archived files and database dumps
+	files   int
+	rawSize int64
+	// upload duration of the backup file to the rclone remote
+	upload time.Duration
+	// meta data of the backup file for the report
+	meta *BackupMeta
+	// mirrors the backup was copied to
+	mirrors []MirrorStatus
+}
+
+// countFilter counts all regular files accepted by include (all if nil)
+func (st *backupStats) countFilter(include tarFilter) tarFilter {
+	return func(name string, info os.FileInfo) bool {
+		if include != nil && !include(name, info) {
+			return false
+		}
+		if info.Mode().IsRegular() {
+			st.files++
+			st.rawSize += info.Size()
+		}
+		return true
+	}
+}
+
+// loadHistory of the last backup runs (oldest first)
+func (s *BackupService) loadHistory() ([]BackupRunStatus, error) {
+	data, err := os.ReadFile(filepath.Join(s.Config.Storage, backupHistoryFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup history: %w", err)
+	}
+
+	var history []BackupRunStatus
+	if err = json.Unmarshal(data, &history); err != nil {
+		return nil, fmt.Errorf("failed to read backup history: %w", err)
+	}
+	return history, nil
+}
+
+// addHistory of the backup run, keeps the last backupHistoryLength runs
+func (s *BackupService) addHistory(run BackupRunStatus) error {
+	history, err := s.loadHistory()
+	if err != nil {
+		return err
+	}
+	if run.Result == "success" {
+		s.checkSizeDrop(history, run)
+	}
+	history = append(history, run)
+	if len(history) > backupHistoryLength {
+		history = history[len(history)-backupHistoryLength:]
+	}
+
+	data, err := json.Marshal(history)
+	if err != nil {
+		return fmt.Errorf("failed to write backup history: %w", err)
+	}
+
+	// replace history atomically
+	tmp := filepath.Join(s.Config.Storage, backupHistoryFile+".tmp")
+	err = os.WriteFile(tmp, data, 0644)
+	if err == nil {
+		err = os.Rename(tmp, filepath.Join(s.Config.Storage, backupHistoryFile))
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write backup history: %w", err)
+	}
+
+	s.setHistoryMetrics(history)
+	return nil
+}
+
+// lastSuccessfulRun of the history (nil if there is none)
+func lastSuccessfulRun(history []BackupRunStatus) *BackupRunStatus {
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].Result == "success" {
+			return &history[i]
+		}
+	}
+	return nil
+}
+
+// checkSizeDrop logs a warning if the backup is less than half the size of the previous
+// successful backup (e.g. caused by a changed mount or a misconfiguration)
+func (s *BackupService) checkSizeDrop(history []BackupRunStatus, run BackupRunStatus) {
+	previous := lastSuccessfulRun(history)
+	if previous == nil {
+		return
+	}
+	if previous.RawSize > 0 && run.RawSize > 0 && run.RawSize < previous.RawSize/2 {
+		s.warn("> backup size dropped to less than half of the previous backup",
+			"raw_size", run.RawSize, "previous_raw_size", previous.RawSize)
+	} else if previous.Size > 0 && run.Size > 0 && run.Size < previous.Size/2 {
+		s.warn("> backup size dropped to less than half of the previous backup",
+			"size", run.Size, "previous_size", previous.Size)
+	}
+}
+
+// setHistoryMetrics of the last successful backup
+func (s *BackupService) setHistoryMetrics(history []BackupRunStatus) {
+	run := lastSuccessfulRun(history)
+	if run == nil {
+		return
+	}
+	labels := metricLabels("job", s.Name)
+	backupSizeBytes.set(labels, float64(run.Size))
+	backupRawSizeBytes.set(labels, float64(run.RawSize))
+	backupFiles.set(labels, float64(run.Files))
+	backupDurationSeconds.set(labels, run.Duration)
+	backupUploadDurationSeconds.set(labels, run.UploadDuration)
+}
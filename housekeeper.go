@@ -2,12 +2,12 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"io"
-	"log"
 	"net"
 	"net/http"
 	"os"
-	"reflect"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -16,47 +16,185 @@ import (
 
 const socket = "/tmp/housekeeper.socket"
 
+// reloadTimeout of running backups and tasks before the schedules are restarted with a new config
+const reloadTimeout = time.Hour
+
+// apiShutdownTimeout of open requests before the API server is closed on reload
+const apiShutdownTimeout = 10 * time.Second
+
 // DatabaseConnection that is used for backup the database
 type DatabaseConnection interface {
 	Init() error
 	WaitForConnection(duration time.Duration) error
+	BackupFilename() string
 	Backup(writer io.Writer) error
 }
 
-type Housekeeper struct {
-	config Config
+// GlobalsDatabaseConnection is implemented by connections that are able
+// to back up global objects (roles, tablespaces) of a server
+type GlobalsDatabaseConnection interface {
+	BackupGlobals(writer io.Writer) error
+}
 
-	db     DatabaseConnection
-	backup *BackupService
+// MultiDatabaseConnection is implemented by connections that are able
+// to back up all databases of a server including global objects
+type MultiDatabaseConnection interface {
+	GlobalsDatabaseConnection
+	Databases() ([]string, error)
+	BackupDatabase(database string, writer io.Writer) error
+}
 
-	running atomic.Bool
+// RestoreConnection is implemented by connections that are able to
+// restore a database dump (database is empty for the configured one)
+type RestoreConnection interface {
+	Restore(database, format string, reader io.Reader) error
+}
+
+// ResetDatabaseConnection is implemented by connections that are able to
+// terminate open connections and recreate a database before a restore
+type ResetDatabaseConnection interface {
+	TerminateConnections(database string) error
+	RecreateDatabase(database string) error
+}
+
+// CreateDatabaseConnection is implemented by connections that are able to
+// create an additional database (e.g. to restore a dump under a different name)
+type CreateDatabaseConnection interface {
+	CreateDatabase(database string) error
+}
+
+// EmptyDatabaseConnection is implemented by connections that are able to
+// detect a database without user tables (e.g. after creating a new volume)
+type EmptyDatabaseConnection interface {
+	IsEmpty() (bool, error)
+}
+
+// PhysicalDatabaseConnection is implemented by connections that are
+// able to create a physical backup of the database server
+type PhysicalDatabaseConnection interface {
+	BackupPhysical(writer io.Writer) error
+}
+
+// DatabaseFormatter is implemented by connections that support
+// different formats and partial content for the database dump
+type DatabaseFormatter interface {
+	DumpFormat() string
+	DumpContent() string
+}
+
+// DatabaseBackupInfo is implemented by connections that provide
+// additional details about the last backup for the backup meta data
+type DatabaseBackupInfo interface {
+	BackupInfo() map[string]string
 }
 
-// ServeHTTP handles health check
-func (h *Housekeeper) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
-	if h.running.Load() {
-		writer.WriteHeader(http.StatusOK)
-	} else {
-		writer.WriteHeader(http.StatusNoContent)
+// NewDatabaseConnection for the configured database type
+func NewDatabaseConnection(config DatabaseConfig) DatabaseConnection {
+	switch config.Type {
+	case "mysql":
+		return NewMySQLConnection(config)
+	case "mongo":
+		return NewMongoConnection(config)
+	case "sqlite":
+		return NewSQLiteConnection(config)
+	case "cockroach":
+		return NewCockroachConnection(config)
+	case "elasticsearch":
+		return NewElasticsearchConnection(config)
+	case "etcd":
+		return NewEtcdConnection(config)
+	case "cassandra":
+		return NewCassandraConnection(config)
+	case "neo4j":
+		return NewNeo4jConnection(config)
+	default:
+		return NewPostgresConnection(config)
 	}
 }
 
+type Housekeeper struct {
+	config Config
+
+	db          DatabaseConnection
+	backup      *BackupService
+	jobs        []*BackupService
+	wal         *WalArchiver
+	maintenance *MaintenanceService
+	events      *EventListener
+	docker      *DockerClient
+
+	// values of the config file and the secrets directory used by config
+	// (only active for lookups after commitConfigValues)
+	configFileValues map[string]string
+	secretValues     map[string]string
+
+	// api server on the optional TCP address (restarted on reload if the address changed)
+	api *http.Server
+
+	// mutex protects the services used by the health check server during a reload
+	mutex   sync.RWMutex
+	running atomic.Bool
+}
+
+// StartHealthcheckServer on the unix socket and the optional API address
 func (h *Housekeeper) StartHealthcheckServer() {
 	_ = os.Remove(socket)
+	handler := h.handler()
 
 	// start http server
 	go func() {
 		unixListener, err := net.Listen("unix", socket)
 		if err != nil {
-			log.Fatalf("failed to create socket: %v", err)
+			fatal("failed to create socket", err)
+		}
+		fatal("health check server stopped", http.Serve(unixListener, handler))
+	}()
+
+	if err := h.startAPIServer(); err != nil {
+		fatal("failed to start API server", err)
+	}
+}
+
+// startAPIServer on the optional TCP address
+func (h *Housekeeper) startAPIServer() error {
+	if h.config.API.Listen == "" {
+		return nil
+	}
+	if h.config.API.Token == "" {
+		newLogger("api").Warn("API_TOKEN not set -> backups can only be triggered on the unix socket")
+	}
+
+	listener, err := net.Listen("tcp", h.config.API.Listen)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", h.config.API.Listen, err)
+	}
+	server := &http.Server{Handler: h.handler()}
+	h.api = server
+	go func() {
+		err := server.Serve(listener)
+		if !errors.Is(err, http.ErrServerClosed) {
+			fatal("API server stopped", err)
 		}
-		log.Fatal(http.Serve(unixListener, h))
 	}()
+	return nil
+}
+
+// stopAPIServer and wait up to timeout for open requests
+func (h *Housekeeper) stopAPIServer(timeout time.Duration) {
+	if h.api == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := h.api.Shutdown(ctx); err != nil {
+		_ = h.api.Close()
+	}
+	h.api = nil
 }
 
 func (h *Housekeeper) Healthcheck() error {
 	client := http.Client{
-		Timeout: time.Millisecond * 100,
+		Timeout: time.Second * 5,
 		Transport: &http.Transport{
 			DialContext: func(_ context.Context, _, _ string) (net.Conn, error) {
 				return net.Dial("unix", socket)
@@ -69,6 +207,12 @@ func (h *Housekeeper) Healthcheck() error {
 		return err
 	}
 
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusServiceUnavailable {
+		status, _ := io.ReadAll(response.Body)
+		return fmt.Errorf("housekeeper not healthy:\n%s", status)
+	}
 	if response.StatusCode != http.StatusOK {
 		return errors.New("housekeeper not ready")
 	}
@@ -76,11 +220,34 @@ func (h *Housekeeper) Healthcheck() error {
 	return nil
 }
 
-// LoadConfig from environment
+// LoadConfig from config file and environment and set up logging with it
 func (h *Housekeeper) LoadConfig() error {
-	log.Print("Load config")
+	newLogger("housekeeper").Print("Load config")
+	err := h.loadConfig()
+	if err != nil {
+		return err
+	}
+	h.commitConfigValues()
+	return setupLogging(h.config.Log)
+}
+
+// loadConfig from config file and environment and create the services
+func (h *Housekeeper) loadConfig() error {
+	fileValues, err := loadConfigFile()
+	if err != nil {
+		return err
+	}
+	secrets, err := loadSecretsDir(fileValues)
+	if err != nil {
+		return err
+	}
+	h.configFileValues, h.secretValues = fileValues, secrets
+
+	// the values of the active config are restored until the new one is committed
+	defer useConfigValues(fileValues, secrets)()
 
-	err := loadStruct(reflect.ValueOf(&h.config).Elem())
+	err = h.config.load()
+	h.config.warnUnknownEnv()
 	if err != nil {
 		return err
 	}
@@ -90,25 +257,107 @@ func (h *Housekeeper) LoadConfig() error {
 		return err
 	}
 
-	h.db = NewPostgresConnection(h.config.Database)
+	h.db = NewDatabaseConnection(h.config.Database)
+	notify, err := NewNotificationService(h.config.Notify)
+	if err != nil {
+		return err
+	}
+	docker, err := NewDockerClient(h.config.Docker.Host)
+	if err != nil {
+		return err
+	}
+	h.docker = docker
+	if h.config.Database.ExecContainer != "" {
+		runner, ok := h.db.(interface {
+			SetExecContainer(docker *DockerClient, container string)
+		})
+		if !ok {
+			return errors.New("docker exec dumps not supported by database type")
+		}
+		runner.SetExecContainer(docker, h.config.Database.ExecContainer)
+	}
+
+	// global backup config is used if no jobs are defined
+	jobs := h.config.Jobs
+	if len(jobs) == 0 {
+		jobs = []BackupJob{{Config: h.config.Backup}}
+	}
+	for _, job := range jobs {
+		h.jobs = append(h.jobs, &BackupService{
+			Name:     job.Name,
+			Config:   job.Config,
+			Database: h.db,
+			Notify:   notify,
+			Docker:   docker,
+		})
+	}
+	h.events = &EventListener{
+		Docker: docker,
+		Jobs:   h.jobs,
+	}
+
+	// WAL archiving and auto restore use the first job
+	h.backup = h.jobs[0]
 
-	h.backup = &BackupService{
-		Config:   h.config.Backup,
+	h.maintenance = &MaintenanceService{
+		Config:   h.config.Maintenance,
 		Database: h.db,
+		Docker:   docker,
+		Notify:   notify,
+	}
+
+	if h.backup.Config.WalArchive {
+		streamer, ok := h.db.(WalStreamer)
+		if !ok {
+			return errors.New("WAL archiving not supported by database type")
+		}
+		h.wal = &WalArchiver{
+			Streamer: streamer,
+			Backup:   h.backup,
+		}
 	}
 	return nil
 }
 
+// commitConfigValues of the loaded config for later lookups
+func (h *Housekeeper) commitConfigValues() {
+	useConfigValues(h.configFileValues, h.secretValues)
+}
+
+// job with the given name (first job if empty)
+func (h *Housekeeper) job(name string) (*BackupService, error) {
+	if name == "" {
+		return h.backup, nil
+	}
+	for _, job := range h.jobs {
+		if job.Name == name {
+			return job, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown backup job %s", name)
+}
+
 // Prepare database and backup
 func (h *Housekeeper) Prepare() error {
 	// start health check server
 	h.StartHealthcheckServer()
 
-	// no database connection if no host given
-	if h.config.Database.Host != "" {
+	if err := h.prepareServices(); err != nil {
+		return err
+	}
+
+	h.running.Store(true)
+
+	return nil
+}
+
+// prepareServices connects to the database and prepares the backup jobs
+func (h *Housekeeper) prepareServices() error {
+	// no database connection if not configured
+	if h.config.Database.IsConfigured() {
 		// connect to database
-		log.Print("Wait for database connection")
-		err := h.db.WaitForConnection(time.Minute)
+		newLogger("housekeeper").Print("Wait for database connection")
+		err := h.db.WaitForConnection(h.config.Database.WaitTimeout)
 		if err != nil {
 			return err
 		}
@@ -118,13 +367,146 @@ func (h *Housekeeper) Prepare() error {
 		if err != nil {
 			return err
 		}
+
+		// the server keeps all WAL for the slot of a disabled WAL archiving
+		if dropper, ok := h.db.(WalSlotDropper); ok && !h.backup.Config.WalArchive {
+			if err = dropper.DropWalSlot(); err != nil {
+				newLogger("housekeeper").Warn("failed to drop unused replication slot", "error", err)
+			}
+		}
+	}
+
+	for _, job := range h.jobs {
+		if err := job.Prepare(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Start backup and maintenance schedules, event listener and WAL archiving
+func (h *Housekeeper) Start() error {
+	// start backup schedules
+	for _, job := range h.jobs {
+		err := job.StartSchedule()
+		if err != nil {
+			return err
+		}
 	}
 
-	if err := h.backup.Prepare(); err != nil {
+	// start backups triggered by docker events
+	err := h.events.Start()
+	if err != nil {
 		return err
 	}
 
-	h.running.Store(true)
+	// start maintenance schedule
+	err = h.maintenance.StartSchedule()
+	if err != nil {
+		return err
+	}
 
+	// start continuous WAL archiving
+	if h.wal != nil {
+		err = h.wal.Start()
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
+
+// Stop schedules, event listener and WAL archiving and wait up to timeout for running tasks
+func (h *Housekeeper) Stop(timeout time.Duration) {
+	h.events.Stop()
+	for _, job := range h.jobs {
+		job.StopSchedule(timeout)
+	}
+	h.maintenance.StopSchedule(timeout)
+	if h.wal != nil {
+		h.wal.Stop()
+	}
+}
+
+// Reload config from config file and environment and restart the schedules with it.
+// The current config stays active if the new config is invalid.
+func (h *Housekeeper) Reload() error {
+	logger := newLogger("housekeeper")
+	logger.Print("Reload config")
+
+	var next Housekeeper
+	err := next.loadConfig()
+	if err == nil {
+		err = next.prepareServices()
+	}
+	if err != nil {
+		if next.docker != nil {
+			next.docker.Close()
+		}
+		return err
+	}
+	next.commitConfigValues()
+
+	// running backups are finished with the previous config
+	h.Stop(reloadTimeout)
+
+	previous := h.swap(&next)
+	err = h.Start()
+	if err != nil {
+		// schedules of the new config failed -> restart the previous ones
+		h.Stop(reloadTimeout)
+		h.swap(previous)
+		h.commitConfigValues()
+		if startErr := h.Start(); startErr != nil {
+			logger.Error("failed to restart previous schedules", "error", startErr)
+		}
+		return err
+	}
+	previous.docker.Close()
+
+	err = setupLogging(h.config.Log)
+	if err != nil {
+		logger.Error("failed to set up logging -> keep previous log output", "error", err)
+	}
+
+	if h.config.API.Listen != previous.config.API.Listen {
+		h.stopAPIServer(apiShutdownTimeout)
+		if err = h.startAPIServer(); err != nil {
+			logger.Error("failed to restart API server", "error", err)
+		}
+	} else if h.config.API.Listen != "" && h.config.API.Token == "" && previous.config.API.Token != "" {
+		newLogger("api").Warn("API_TOKEN not set -> backups can only be triggered on the unix socket")
+	}
+	return nil
+}
+
+// swap config and services with the given ones and return the previous
+func (h *Housekeeper) swap(next *Housekeeper) *Housekeeper {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	previous := &Housekeeper{
+		config:      h.config,
+		db:          h.db,
+		backup:      h.backup,
+		jobs:        h.jobs,
+		wal:         h.wal,
+		maintenance: h.maintenance,
+		events:      h.events,
+		docker:      h.docker,
+
+		configFileValues: h.configFileValues,
+		secretValues:     h.secretValues,
+	}
+	h.config = next.config
+	h.db = next.db
+	h.backup = next.backup
+	h.jobs = next.jobs
+	h.wal = next.wal
+	h.maintenance = next.maintenance
+	h.events = next.events
+	h.docker = next.docker
+	h.configFileValues = next.configFileValues
+	h.secretValues = next.secretValues
+	return previous
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// incrementalStateFile in the storage directory contains the state of the data directories at the last backup
+const incrementalStateFile = ".incremental_state.json"
+
+// incrementalSuffix marks the filename of incremental backups
+const incrementalSuffix = "_incremental"
+
+// incrementalState of the data directories at the last successful backup
+type incrementalState struct {
+	// Base is the full backup of the current chain
+	Base string `json:"base"`
+	// Last backup of the chain
+	Last string `json:"last"`
+	// Count of incremental backups since the full backup
+	Count int `json:"count"`
+
+	// Directories contain the state of all files by relative path
+	Directories map[string]map[string]fileState `json:"directories"`
+}
+
+// fileState used to detect changed files
+type fileState struct {
+	ModTime time.Time `json:"mtime"`
+	Size    int64     `json:"size"`
+}
+
+// incrementalBackup tracks the files of data directories while a backup is created
+type incrementalBackup struct {
+	// previous state (nil for full backups)
+	previous *incrementalState
+	// state after the backup
+	state *incrementalState
+}
+
+// isIncrementalBackup returns true if the filename belongs to an incremental backup
+func isIncrementalBackup(filename string) bool {
+	name := trimEncryptionExtension(filepath.Base(filename))
+	return strings.HasSuffix(strings.TrimSuffix(name, "."+backupFormat(name)), incrementalSuffix)
+}
+
+// startIncremental backup based on the state of the last backup (full backup if no state exists)
+func (s *BackupService) startIncremental() *incrementalBackup {
+	backup := &incrementalBackup{
+		state: &incrementalState{
+			Directories: make(map[string]map[string]fileState),
+		},
+	}
+
+	previous, err := s.loadIncrementalState()
+	if err != nil {
+		s.warn("> failed to load incremental state -> create full backup", "error", err)
+		return backup
+	}
+	if previous == nil {
+		s.logger().Printf("> no incremental state found -> create full backup")
+		return backup
+	}
+	if previous.Count >= s.Config.IncrementalMax {
+		s.logger().Printf("> %d incremental backups since full backup -> create full backup", previous.Count)
+		return backup
+	}
+	if !s.backupExists(previous.Last) {
+		s.logger().Printf("> previous backup %s not found -> create full backup", previous.Last)
+		return backup
+	}
+
+	backup.previous = previous
+	backup.state.Base = previous.Base
+	backup.state.Count = previous.Count + 1
+	return backup
+}
+
+// loadIncrementalState of the last successful backup (nil if there is none)
+func (s *BackupService) loadIncrementalState() (*incrementalState, error) {
+	data, err := os.ReadFile(filepath.Join(s.Config.Storage, incrementalStateFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read incremental state: %w", err)
+	}
+
+	var state incrementalState
+	if err = json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to read incremental state: %w", err)
+	}
+	if state.Base == "" || state.Last == "" {
+		return nil, errors.New("invalid incremental state")
+	}
+	return &state, nil
+}
+
+// saveIncrementalState of the given backup
+func (s *BackupService) saveIncrementalState(state *incrementalState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to write incremental state: %w", err)
+	}
+
+	// replace state atomically
+	tmp := filepath.Join(s.Config.Storage, incrementalStateFile+".tmp")
+	err = os.WriteFile(tmp, data, 0644)
+	if err == nil {
+		err = os.Rename(tmp, filepath.Join(s.Config.Storage, incrementalStateFile))
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write incremental state: %w", err)
+	}
+	return nil
+}
+
+// backupExists in the local storage or on the rclone remote
+func (s *BackupService) backupExists(filename string) bool {
+	if s.RClone == nil {
+		_, err := os.Stat(filepath.Join(s.Config.Storage, filename))
+		return err == nil
+	}
+	_, err := s.RClone.NewObject(context.Background(), filename)
+	return err == nil
+}
+
+// include returns a filter for the given directory that records the state
+// of all files and accepts only changed files for incremental backups
+func (b *incrementalBackup) include(dir string) tarFilter {
+	files := make(map[string]fileState)
+	b.state.Directories[dir] = files
+
+	var previous map[string]fileState
+	if b.previous != nil {
+		previous = b.previous.Directories[dir]
+	}
+
+	return func(name string, info os.FileInfo) bool {
+		current := fileState{
+			ModTime: info.ModTime(),
+			Size:    info.Size(),
+		}
+		files[name] = current
+
+		if b.previous == nil {
+			return true
+		}
+		last, ok := previous[name]
+		return !ok || !last.ModTime.Equal(current.ModTime) || last.Size != current.Size
+	}
+}
+
+// deleted returns the files of the directory that were removed since the previous backup
+func (b *incrementalBackup) deleted(dir string) []string {
+	if b.previous == nil {
+		return nil
+	}
+
+	var deleted []string
+	for name := range b.previous.Directories[dir] {
+		if _, ok := b.state.Directories[dir][name]; !ok {
+			deleted = append(deleted, name)
+		}
+	}
+	sort.Strings(deleted)
+	return deleted
+}
+
+// openChain of backups required to restore the data directories of an incremental backup
+// (sorted from the full backup to the given archive). Only the given archive is returned for full backups.
+func (s *BackupService) openChain(filename string, archive *BackupArchive, selected []string) ([]*BackupArchive, error) {
+	chain := []*BackupArchive{archive}
+	for current := archive; current.Meta.Incremental != nil; {
+		previous := current.Meta.Incremental.Previous
+		// previous backups are located next to local backup files
+		if strings.ContainsRune(filename, os.PathSeparator) {
+			previous = filepath.Join(filepath.Dir(filename), previous)
+		}
+		s.logger().Printf("> open previous backup %s", previous)
+
+		var err error
+		current, err = s.openBackup(previous)
+		if err == nil {
+			// only the checksums of the restored directories are relevant
+			if dirs := chainDirectories(current.Meta, selected); len(dirs) > 0 {
+				err = current.verify(s.logger(), dirs)
+			}
+			if err != nil {
+				current.Close()
+			}
+		}
+		if err != nil {
+			closeChain(chain[:len(chain)-1])
+			return nil, fmt.Errorf("failed to open previous backup %s: %w", previous, err)
+		}
+		chain = append([]*BackupArchive{current}, chain...)
+	}
+	return chain, nil
+}
+
+// chainDirectories returns the selected directories (all if none given) that are part of the backup
+func chainDirectories(meta BackupMeta, selected []string) []string {
+	var dirs []string
+	for _, dir := range meta.Directories {
+		if len(selected) == 0 || containsPath(selected, dir.DirectoryPath) {
+			dirs = append(dirs, dir.DirectoryPath)
+		}
+	}
+	return dirs
+}
+
+// containsPath returns true if the path is part of paths
+func containsPath(paths []string, path string) bool {
+	for _, p := range paths {
+		if filepath.Clean(p) == filepath.Clean(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// closeChain of previous backups
+func closeChain(chain []*BackupArchive) {
+	for _, archive := range chain {
+		archive.Close()
+	}
+}
+
+// removeDeleted files of an incremental backup from the restored directory
+func removeDeleted(dir string, deleted []string) error {
+	for _, name := range deleted {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if !strings.HasPrefix(file, filepath.Clean(dir)+string(os.PathSeparator)) {
+			return fmt.Errorf("invalid deleted path: %s", name)
+		}
+		if err := os.RemoveAll(file); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", file, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,396 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"log/syslog"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/rclone/rclone/fs"
+)
+
+// LogConfig of the log output
+type LogConfig struct {
+	Format string `conf:"LOG_FORMAT,text"`
+	Level  string `conf:"LOG_LEVEL,info"`
+
+	Syslog    string `conf:"LOG_SYSLOG"`
+	SyslogTag string `conf:"LOG_SYSLOG_TAG,housekeeper"`
+}
+
+// logLevel of all log output
+var logLevel slog.LevelVar
+
+// fileLogLevel of the per-file output of backups and restores (info with --verbose)
+var fileLogLevel = slog.LevelDebug
+
+// syslogWriter of the current log setup (closed on reload)
+var syslogWriter *syslog.Writer
+
+// setupLogging with the given format and level for slog and the standard logger
+// and the optional forwarding to syslog
+func setupLogging(config LogConfig) error {
+	var level slog.Level
+	_ = level.UnmarshalText([]byte(config.Level))
+
+	var handler slog.Handler = &textHandler{writer: os.Stderr, mutex: new(sync.Mutex)}
+	if config.Format == "json" {
+		handler = slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: &logLevel})
+	}
+
+	// the previous setup stays active if syslog is not reachable
+	var writer *syslog.Writer
+	if config.Syslog != "" {
+		network, address, err := parseSyslogAddress(config.Syslog)
+		if err != nil {
+			return err
+		}
+		writer, err = syslog.Dial(network, address, syslog.LOG_INFO|syslog.LOG_DAEMON, config.SyslogTag)
+		if err != nil {
+			return fmt.Errorf("failed to connect to syslog %s: %w", config.Syslog, err)
+		}
+		handler = multiHandler{handler, &syslogHandler{writer: writer}}
+	}
+	logLevel.Set(level)
+	slog.SetDefault(slog.New(handler))
+
+	if syslogWriter != nil {
+		_ = syslogWriter.Close()
+	}
+	syslogWriter = writer
+
+	// log output of rclone (e.g. retries of uploads and transfer details in debug mode)
+	fs.LogOutput = func(level fs.LogLevel, text string) {
+		newLogger("rclone").Log(context.Background(), rcloneLogLevel(level), text)
+	}
+	fs.GetConfig(context.Background()).LogLevel = fs.LogLevelNotice
+	if level <= slog.LevelDebug {
+		fs.GetConfig(context.Background()).LogLevel = fs.LogLevelDebug
+	}
+	return nil
+}
+
+// parseSyslogAddress of the form udp://host:port, tcp://host:port or unix:///path
+// (the default port is 514)
+func parseSyslogAddress(value string) (string, string, error) {
+	address, err := url.Parse(value)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid syslog address %s: %w", value, err)
+	}
+	switch address.Scheme {
+	case "udp", "tcp":
+		if address.Host == "" {
+			return "", "", fmt.Errorf("invalid syslog address %s (missing host)", value)
+		}
+		host := address.Host
+		if address.Port() == "" {
+			host += ":514"
+		}
+		return address.Scheme, host, nil
+	case "unix", "unixgram":
+		if address.Path == "" {
+			return "", "", fmt.Errorf("invalid syslog address %s (missing path)", value)
+		}
+		return address.Scheme, address.Path, nil
+	default:
+		return "", "", fmt.Errorf("invalid syslog address %s (expected udp://, tcp:// or unix://)", value)
+	}
+}
+
+// rcloneLogLevel converts the log level of rclone to slog
+func rcloneLogLevel(level fs.LogLevel) slog.Level {
+	switch {
+	case level <= fs.LogLevelError:
+		return slog.LevelError
+	case level == fs.LogLevelWarning:
+		return slog.LevelWarn
+	case level == fs.LogLevelNotice:
+		return slog.LevelInfo
+	default:
+		return slog.LevelDebug
+	}
+}
+
+// cronLogger writes the scheduling decisions of cron with debug level
+type cronLogger struct{}
+
+// Info of cron (e.g. wake up and run of entries) with debug level
+func (cronLogger) Info(msg string, keysAndValues ...any) {
+	newLogger("cron").Debug(msg, keysAndValues...)
+}
+
+// Error of cron (e.g. panic of a job)
+func (cronLogger) Error(err error, msg string, keysAndValues ...any) {
+	newLogger("cron").Error(msg, append(keysAndValues, "error", err)...)
+}
+
+// debugDB logs the statements executed on the database with debug level
+// (passwords of the database config are redacted)
+type debugDB struct {
+	*sql.DB
+	config DatabaseConfig
+}
+
+// Exec the query after logging it
+func (db debugDB) Exec(query string, args ...any) (sql.Result, error) {
+	db.config.debugSQL(query, args...)
+	return db.DB.Exec(query, args...)
+}
+
+// QueryRow after logging the query
+func (db debugDB) QueryRow(query string, args ...any) *sql.Row {
+	db.config.debugSQL(query, args...)
+	return db.DB.QueryRow(query, args...)
+}
+
+// debugSQL logs the statement with debug level (passwords of the config are redacted)
+func (c DatabaseConfig) debugSQL(query string, args ...any) {
+	logger := c.logger()
+	if !logger.Enabled(context.Background(), slog.LevelDebug) {
+		return
+	}
+
+	secrets := []string{c.Password, c.RootPassword}
+	if additional, err := c.AdditionalDatabases(); err == nil {
+		for _, user := range additional {
+			secrets = append(secrets, user.Password)
+		}
+	}
+	values := slices.Clone(args)
+	for _, secret := range secrets {
+		if secret == "" {
+			continue
+		}
+		query = strings.ReplaceAll(query, secret, "***")
+		for i, value := range values {
+			if value == secret {
+				values[i] = "***"
+			}
+		}
+	}
+
+	if len(values) == 0 {
+		logger.Debug("execute SQL", "query", query)
+	} else {
+		logger.Debug("execute SQL", "query", query, "args", values)
+	}
+}
+
+// fatal logs the message and error with error level and exits
+func fatal(msg string, err error) {
+	switch {
+	case msg == "":
+		slog.Error(err.Error())
+	case err == nil:
+		slog.Error(msg)
+	default:
+		slog.Error(msg, "error", err)
+	}
+	os.Exit(1)
+}
+
+// Logger of a component with structured fields and printf style output
+type Logger struct {
+	*slog.Logger
+}
+
+// newLogger of the component (e.g. backup, database or rclone) with additional fields
+func newLogger(component string, args ...any) Logger {
+	return Logger{slog.Default().With(append([]any{"component", component}, args...)...)}
+}
+
+// Print the message with info level
+func (l Logger) Print(msg string) {
+	l.Info(msg)
+}
+
+// Printf the formatted message with info level
+func (l Logger) Printf(format string, args ...any) {
+	l.Info(fmt.Sprintf(format, args...))
+}
+
+// textHandler writes log records in the format of the standard logger. Only attributes of
+// the record are appended as key=value (the error as ": error"), attributes of the logger
+// (e.g. the component) are already part of the message.
+type textHandler struct {
+	writer io.Writer
+	mutex  *sync.Mutex
+	group  string
+}
+
+// Enabled if the level is not below the configured log level
+func (h *textHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= logLevel.Level()
+}
+
+// Handle writes the log record
+func (h *textHandler) Handle(_ context.Context, record slog.Record) error {
+	var line strings.Builder
+	line.WriteString(record.Time.Format("2006/01/02 15:04:05 "))
+	if record.Level != slog.LevelInfo {
+		line.WriteString(record.Level.String() + " ")
+	}
+	line.WriteString(record.Message)
+	record.Attrs(func(attr slog.Attr) bool {
+		writeTextAttr(&line, h.group, attr)
+		return true
+	})
+	line.WriteString("\n")
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	_, err := io.WriteString(h.writer, line.String())
+	return err
+}
+
+// writeTextAttr as key=value (values with spaces or quotes are quoted)
+func writeTextAttr(line *strings.Builder, group string, attr slog.Attr) {
+	attr.Value = attr.Value.Resolve()
+	if attr.Equal(slog.Attr{}) {
+		return
+	}
+	key := attr.Key
+	if group != "" {
+		key = group + "." + key
+	}
+	if attr.Value.Kind() == slog.KindGroup {
+		for _, groupAttr := range attr.Value.Group() {
+			writeTextAttr(line, key, groupAttr)
+		}
+		return
+	}
+
+	value := attr.Value.String()
+	if key == "error" {
+		// errors are appended to the message like with the standard logger
+		line.WriteString(": " + value)
+		return
+	}
+	if value == "" || strings.ContainsAny(value, " \"=\n\t") {
+		value = strconv.Quote(value)
+	}
+	line.WriteString(" " + key + "=" + value)
+}
+
+// WithAttrs returns the handler unchanged as logger attributes are not written
+func (h *textHandler) WithAttrs([]slog.Attr) slog.Handler {
+	return h
+}
+
+// WithGroup returns a handler that prefixes the keys of record attributes with the group
+func (h *textHandler) WithGroup(name string) slog.Handler {
+	if h.group != "" {
+		name = h.group + "." + name
+	}
+	return &textHandler{writer: h.writer, mutex: h.mutex, group: name}
+}
+
+// syslogHandler forwards log records to syslog with the severity of the level. The
+// message is written like with the textHandler without time and level, as both are
+// part of the syslog message, and with the component of the logger.
+type syslogHandler struct {
+	writer    *syslog.Writer
+	group     string
+	component string
+}
+
+// Enabled if the level is not below the configured log level
+func (h *syslogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= logLevel.Level()
+}
+
+// Handle writes the log record with the severity of the level
+func (h *syslogHandler) Handle(_ context.Context, record slog.Record) error {
+	var line strings.Builder
+	if h.component != "" {
+		line.WriteString("[" + h.component + "] ")
+	}
+	line.WriteString(record.Message)
+	record.Attrs(func(attr slog.Attr) bool {
+		writeTextAttr(&line, h.group, attr)
+		return true
+	})
+
+	switch {
+	case record.Level >= slog.LevelError:
+		return h.writer.Err(line.String())
+	case record.Level >= slog.LevelWarn:
+		return h.writer.Warning(line.String())
+	case record.Level >= slog.LevelInfo:
+		return h.writer.Info(line.String())
+	default:
+		return h.writer.Debug(line.String())
+	}
+}
+
+// WithAttrs keeps the component of the logger, other logger attributes are not written
+func (h *syslogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handler := *h
+	for _, attr := range attrs {
+		if attr.Key == "component" {
+			handler.component = attr.Value.String()
+		}
+	}
+	return &handler
+}
+
+// WithGroup returns a handler that prefixes the keys of record attributes with the group
+func (h *syslogHandler) WithGroup(name string) slog.Handler {
+	handler := *h
+	if h.group != "" {
+		name = h.group + "." + name
+	}
+	handler.group = name
+	return &handler
+}
+
+// multiHandler writes log records to all handlers
+type multiHandler []slog.Handler
+
+// Enabled if any of the handlers is enabled for the level
+func (m multiHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, handler := range m {
+		if handler.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+// Handle the record with all enabled handlers and return the joined errors
+func (m multiHandler) Handle(ctx context.Context, record slog.Record) error {
+	var errs []error
+	for _, handler := range m {
+		if handler.Enabled(ctx, record.Level) {
+			errs = append(errs, handler.Handle(ctx, record.Clone()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// WithAttrs of all handlers
+func (m multiHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make(multiHandler, len(m))
+	for i, handler := range m {
+		handlers[i] = handler.WithAttrs(attrs)
+	}
+	return handlers
+}
+
+// WithGroup of all handlers
+func (m multiHandler) WithGroup(name string) slog.Handler {
+	handlers := make(multiHandler, len(m))
+	for i, handler := range m {
+		handlers[i] = handler.WithGroup(name)
+	}
+	return handlers
+}
@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+func TestParseSyslogAddress(t *testing.T) {
+	tests := []struct {
+		value   string
+		network string
+		address string
+		err     bool
+	}{
+		{"udp://syslog", "udp", "syslog:514", false},
+		{"udp://syslog:1514", "udp", "syslog:1514", false},
+		{"tcp://10.0.0.1", "tcp", "10.0.0.1:514", false},
+		{"tcp://[::1]:601", "tcp", "[::1]:601", false},
+		{"unix:///dev/log", "unix", "/dev/log", false},
+		{"unixgram:///run/systemd/journal/syslog", "unixgram", "/run/systemd/journal/syslog", false},
+		{"udp://", "", "", true},
+		{"unix://", "", "", true},
+		{"syslog:514", "", "", true},
+		{"http://syslog", "", "", true},
+		{"udp://%zz", "", "", true},
+	}
+	for _, test := range tests {
+		network, address, err := parseSyslogAddress(test.value)
+		if (err != nil) != test.err {
+			t.Errorf("parseSyslogAddress(%q) error = %v, expected error %v", test.value, err, test.err)
+			continue
+		}
+		if network != test.network || address != test.address {
+			t.Errorf("parseSyslogAddress(%q) = %s, %s, expected %s, %s",
+				test.value, network, address, test.network, test.address)
+		}
+	}
+}
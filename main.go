@@ -1,18 +1,41 @@
 package main
 
 import (
-	"log"
+	"flag"
+	"fmt"
+	"log/slog"
 	"os"
 	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 )
 
+// exit codes of manual actions
+const (
+	exitFailure = 1 // action failed
+	exitUsage   = 2 // invalid arguments (e.g. unknown action or job)
+)
+
 func main() {
+	_ = setupLogging(LogConfig{Format: "text"})
+
 	// handle special actions
+	args := parseGlobalOptions(os.Args[1:])
 	var action string
-	if len(os.Args) > 1 {
-		action = strings.ToLower(os.Args[1])
+	if len(args) > 0 {
+		action = strings.ToLower(args[0])
+		args = args[1:]
+	}
+
+	// options of backup and restore are parsed before the config is loaded
+	// to apply the output mode to all log output
+	var restoreOptions RestoreOptions
+	switch action {
+	case "backup":
+		args = parseBackupOptions(args)
+	case "restore":
+		restoreOptions = parseRestoreOptions(args)
 	}
 
 	// handle health check early
@@ -20,7 +43,7 @@ func main() {
 	if action == "healthcheck" {
 		err := housekeeper.Healthcheck()
 		if err != nil {
-			log.Fatalf("check failed: %v", err)
+			fatal("check failed", err)
 		}
 		os.Exit(0)
 	}
@@ -28,39 +51,327 @@ func main() {
 	// load config
 	err := housekeeper.LoadConfig()
 	if err != nil {
-		log.Fatalf("failed to load config: %v", err)
+		fatal("failed to load config", err)
+	}
+
+	// decrypt requires no database connection
+	if action == "decrypt" {
+		options := parseDecryptOptions(args)
+		backup, err := housekeeper.job(options.Job)
+		if err == nil {
+			err = backup.Prepare()
+		}
+		if err == nil {
+			err = backup.Decrypt(options)
+		}
+		if err != nil {
+			fatal("", err)
+		}
+		return
+	}
+
+	// check config without preparing housekeeper
+	if action == "config-check" {
+		if err = housekeeper.CheckConfig(); err != nil {
+			fatal("", err)
+		}
+		return
+	}
+
+	// print config without preparing housekeeper
+	if action == "print-config" {
+		if err = housekeeper.PrintConfig(); err != nil {
+			fatal("", err)
+		}
+		return
+	}
+
+	// verify requires no database connection
+	if action == "verify" {
+		options := parseVerifyOptions(args)
+		backup, err := housekeeper.job(options.Job)
+		if err == nil {
+			err = backup.Prepare()
+		}
+		if err == nil {
+			err = backup.Verify(options)
+		}
+		if err != nil {
+			fatal("", err)
+		}
+		return
 	}
 
 	// prepare housekeeper
 	err = housekeeper.Prepare()
 	if err != nil {
-		log.Fatal(err)
+		fatal("", err)
 	}
 
 	switch action {
 	case "": // no action -> default cron mode
 		break
 
-	case "backup": // manual backup
-		err = housekeeper.backup.Backup()
+	case "backup": // manual backup of all jobs or the given job
+		jobs := housekeeper.jobs
+		if len(args) > 0 {
+			job, err := housekeeper.job(args[0])
+			if err != nil {
+				fatalUsage(err)
+			}
+			jobs = []*BackupService{job}
+		}
+
+		var failed bool
+		for _, job := range jobs {
+			if err = job.Backup(); err != nil {
+				job.logger().Error("backup failed", "error", err)
+				failed = true
+			}
+		}
+		if failed {
+			os.Exit(exitFailure)
+		}
+		return
+
+	case "vacuum": // manual vacuum
+		err = housekeeper.maintenance.Vacuum()
+		if err != nil {
+			fatal("", err)
+		}
+		return
+
+	case "reindex": // manual reindex
+		err = housekeeper.maintenance.Reindex()
+		if err != nil {
+			fatal("", err)
+		}
+		return
+
+	case "prune-volumes": // manual volume prune
+		err = housekeeper.maintenance.PruneVolumes()
+		if err != nil {
+			fatal("", err)
+		}
+		return
+
+	case "cleanup-containers": // manual container cleanup
+		err = housekeeper.maintenance.CleanupContainers()
+		if err != nil {
+			fatal("", err)
+		}
+		return
+
+	case "truncate-logs": // manual log truncation
+		err = housekeeper.maintenance.TruncateLogs()
+		if err != nil {
+			fatal("", err)
+		}
+		return
+
+	case "prune-build-cache": // manual build cache prune
+		err = housekeeper.maintenance.PruneBuildCache()
 		if err != nil {
-			log.Fatal(err)
+			fatal("", err)
+		}
+		return
+
+	case "restore": // restore backup
+		backup, err := housekeeper.job(restoreOptions.Job)
+		if err != nil {
+			fatalUsage(err)
+		}
+		err = backup.Restore(restoreOptions)
+		if err != nil {
+			fatal("", err)
 		}
 		return
 	default:
-		log.Fatal("unknown action")
+		fatalUsage(fmt.Errorf("unknown action %s", action))
 		return
 	}
 
-	// start backup schedule
-	err = housekeeper.backup.StartSchedule()
+	// restore newest backup into an empty database
+	err = housekeeper.backup.AutoRestore()
+	if err != nil {
+		fatal("", err)
+	}
+
+	// start schedules, event listener and WAL archiving
+	err = housekeeper.Start()
 	if err != nil {
-		log.Fatal(err)
+		fatal("", err)
 	}
 
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
-	<-c
+	signal.Notify(c, os.Interrupt, syscall.SIGHUP)
+	for sig := range c {
+		if sig != syscall.SIGHUP {
+			break
+		}
+		if err = housekeeper.Reload(); err != nil {
+			slog.Error("reload failed, keep previous config", "error", err)
+		}
+	}
+
+	housekeeper.Stop(housekeeper.config.ShutdownTimeout)
+}
+
+// parseGlobalOptions in front of the action that override config values and return the remaining arguments
+func parseGlobalOptions(args []string) []string {
+	flags := flag.NewFlagSet("docker-housekeeper", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: docker-housekeeper [options] [action] [arguments]")
+		fmt.Fprintln(flags.Output(), "Actions: backup, restore, verify, decrypt, vacuum, reindex, prune-volumes, cleanup-containers,")
+		fmt.Fprintln(flags.Output(), "  truncate-logs, prune-build-cache, config-check, print-config, healthcheck (default: run schedules)")
+		flags.PrintDefaults()
+	}
+	override := func(key string) func(string) error {
+		return func(value string) error {
+			configOverrides[key] = value
+			return nil
+		}
+	}
+	flags.Func("config", "path of the config file (CONFIG_FILE)", override("CONFIG_FILE"))
+	flags.Func("storage", "local backup storage (BACKUP_STORAGE)", override("BACKUP_STORAGE"))
+	flags.Func("schedule", "backup schedule (BACKUP_SCHEDULE)", override("BACKUP_SCHEDULE"))
+	flags.Func("data-dir", "data directories of the backup (BACKUP_DATA_DIR)", override("BACKUP_DATA_DIR"))
+	flags.Func("rclone-path", "rclone remote storage location (BACKUP_RCLONE_PATH)", override("BACKUP_RCLONE_PATH"))
+	flags.Func("set", "override any config value with KEY=VALUE (can be repeated)", func(value string) error {
+		key, value, ok := strings.Cut(value, "=")
+		if !ok || key == "" {
+			return fmt.Errorf("invalid override %s (expected KEY=VALUE)", key)
+		}
+		configOverrides[strings.ToUpper(key)] = value
+		return nil
+	})
+	_ = flags.Parse(args)
+
+	return flags.Args()
+}
+
+// fatalUsage logs the error of invalid arguments and exits with exitUsage
+func fatalUsage(err error) {
+	slog.Error(err.Error())
+	os.Exit(exitUsage)
+}
+
+// OutputOptions of manual actions
+type OutputOptions struct {
+	Quiet   bool
+	Verbose bool
+}
+
+// addFlags --quiet and --verbose to the flag set
+func (o *OutputOptions) addFlags(flags *flag.FlagSet) {
+	flags.BoolVar(&o.Quiet, "quiet", false, "log only errors (overrides LOG_LEVEL)")
+	flags.BoolVar(&o.Verbose, "verbose", false, "log every archived or restored file")
+}
+
+// apply the output mode to the log output
+func (o OutputOptions) apply() {
+	if o.Quiet {
+		configOverrides["LOG_LEVEL"] = "error"
+		logLevel.Set(slog.LevelError)
+	}
+	if o.Verbose {
+		fileLogLevel = slog.LevelInfo
+	}
+}
+
+// parseBackupOptions from command line arguments and return the job names
+func parseBackupOptions(args []string) []string {
+	flags := flag.NewFlagSet("backup", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: backup [options] [job]")
+		flags.PrintDefaults()
+	}
+	var output OutputOptions
+	output.addFlags(flags)
+	_ = flags.Parse(args)
+
+	output.apply()
+	return flags.Args()
+}
+
+// parseRestoreOptions from command line arguments
+func parseRestoreOptions(args []string) RestoreOptions {
+	var options RestoreOptions
+
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: restore [options] [backup file]")
+		flags.PrintDefaults()
+	}
+	var output OutputOptions
+	output.addFlags(flags)
+	flags.BoolVar(&options.Latest, "latest", false,
+		"restore the newest backup of local storage and rclone remote")
+	flags.Func("dir", "restore only the given data directory (can be repeated)", func(value string) error {
+		options.Directories = append(options.Directories, value)
+		return nil
+	})
+	flags.StringVar(&options.Project, "project", "",
+		"restore only the directories and database of the given compose project")
+	flags.BoolVar(&options.DatabaseOnly, "database-only", false,
+		"restore only the database without data directories")
+	flags.BoolVar(&options.DropDatabase, "drop", false,
+		"drop and recreate the database before restoring the dump")
+	flags.StringVar(&options.TargetDatabase, "target-db", "",
+		"restore the dump into the given database (created if missing)")
+	flags.BoolVar(&options.DryRun, "dry-run", false,
+		"list the content that would be restored without modifying anything")
+	flags.StringVar(&options.DataDirectory, "pgdata", "",
+		"data directory of the stopped postgres server for physical backups")
+	flags.Func("target-time", "point-in-time recovery target (RFC3339, physical backups only)", func(value string) error {
+		var err error
+		options.TargetTime, err = time.Parse(time.RFC3339, value)
+		return err
+	})
+	flags.BoolVar(&options.NoRestart, "no-restart", false,
+		"do not restart containers after the restore")
+	flags.StringVar(&options.Job, "job", "", "name of the backup job (default first job)")
+	_ = flags.Parse(args)
+
+	output.apply()
+	options.Filename = flags.Arg(0)
+	return options
+}
+
+// parseDecryptOptions from command line arguments
+func parseDecryptOptions(args []string) DecryptOptions {
+	var options DecryptOptions
+
+	flags := flag.NewFlagSet("decrypt", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: decrypt [options] <backup file>")
+		flags.PrintDefaults()
+	}
+	flags.StringVar(&options.Output, "output", "", "path of the decrypted zip file (default stdout)")
+	flags.StringVar(&options.IdentityFile, "identity", "", "file with age identities used for decryption")
+	flags.StringVar(&options.Job, "job", "", "name of the backup job (default first job)")
+	_ = flags.Parse(args)
+
+	options.Filename = flags.Arg(0)
+	return options
+}
+
+// parseVerifyOptions from command line arguments
+func parseVerifyOptions(args []string) VerifyOptions {
+	var options VerifyOptions
+
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: verify [options] [backup file]")
+		flags.PrintDefaults()
+	}
+	flags.BoolVar(&options.Latest, "latest", false,
+		"verify the newest backup of local storage and rclone remote")
+	flags.BoolVar(&options.Repair, "repair", false,
+		"repair corrupted local backups with the parity data")
+	flags.StringVar(&options.Job, "job", "", "name of the backup job (default first job)")
+	_ = flags.Parse(args)
 
-	housekeeper.backup.StopSchedule(time.Minute * 5)
+	options.Filename = flags.Arg(0)
+	return options
 }
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// VacuumConnection is implemented by connections that support VACUUM
+type VacuumConnection interface {
+	Vacuum(tables []string, verbose bool) error
+}
+
+// ReindexConnection is implemented by connections that support REINDEX
+type ReindexConnection interface {
+	Reindex(indexes []string) error
+}
+
+// MaintenanceService handles scheduled database and Docker maintenance tasks
+type MaintenanceService struct {
+	Config   MaintenanceConfig
+	Database DatabaseConnection
+	Docker   *DockerClient
+
+	Cron   *cron.Cron
+	Notify *NotificationService
+
+	// entries of scheduled tasks by name
+	entries map[string]cron.EntryID
+	// blackout windows of scheduled tasks
+	blackout *blackout
+}
+
+// logger of the maintenance component
+func (s *MaintenanceService) logger() Logger {
+	return newLogger("maintenance")
+}
+
+// IsMaintenanceEnabled returns true if any maintenance task is enabled
+func (s *MaintenanceService) IsMaintenanceEnabled() bool {
+	return s.Config.VacuumSchedule != "" || s.Config.ReindexSchedule != "" ||
+		s.Config.VolumePruneSchedule != "" || s.Config.ContainerCleanupSchedule != "" ||
+		s.Config.LogTruncateSchedule != "" || s.Config.BuildCachePruneSchedule != ""
+}
+
+// StartSchedule of maintenance cron
+func (s *MaintenanceService) StartSchedule() error {
+	s.Cron = cron.New(cron.WithParser(cronParser), cron.WithLogger(cronLogger{}))
+	s.Cron.Start()
+	s.entries = make(map[string]cron.EntryID)
+
+	var err error
+	s.blackout, err = newBlackout(s.Config.Blackout, s.Config.BlackoutDefer, time.Local, s.logger())
+	if err != nil {
+		return err
+	}
+
+	err = s.addTask("vacuum", s.Config.VacuumSchedule, s.Vacuum)
+	if err != nil {
+		return err
+	}
+	err = s.addTask("reindex", s.Config.ReindexSchedule, s.Reindex)
+	if err != nil {
+		return err
+	}
+	err = s.addTask("volume prune", s.Config.VolumePruneSchedule, s.PruneVolumes)
+	if err != nil {
+		return err
+	}
+	err = s.addTask("container cleanup", s.Config.ContainerCleanupSchedule, s.CleanupContainers)
+	if err != nil {
+		return err
+	}
+	err = s.addTask("log truncate", s.Config.LogTruncateSchedule, s.TruncateLogs)
+	if err != nil {
+		return err
+	}
+	return s.addTask("build cache prune", s.Config.BuildCachePruneSchedule, s.PruneBuildCache)
+}
+
+// addTask to cron if a schedule is given
+func (s *MaintenanceService) addTask(name, schedule string, task func() error) error {
+	if schedule == "" {
+		return nil
+	}
+
+	var run func()
+	run = func() {
+		if s.blackout.skip(name, run) {
+			return
+		}
+		err := task()
+		if err != nil {
+			s.logger().Error(name+" failed", "error", err)
+		}
+	}
+	entry, err := s.Cron.AddFunc(schedule, run)
+	if err != nil {
+		return fmt.Errorf("failed to create %s schedule: %w", name, err)
+	}
+	s.entries[name] = entry
+	s.logger().Printf("[Next %s: %s]", name, s.Cron.Entry(entry).Next)
+	return nil
+}
+
+// StopSchedule cron of maintenance and deferred tasks and wait up to timeout for running tasks
+func (s *MaintenanceService) StopSchedule(timeout time.Duration) {
+	deadline := time.After(timeout)
+	if s.Cron != nil {
+		ctx := s.Cron.Stop()
+		select {
+		case <-ctx.Done():
+		case <-deadline:
+			return
+		}
+	}
+	select {
+	case <-s.blackout.stop():
+	case <-deadline:
+	}
+}
+
+// run task and send a notification about the result
+func (s *MaintenanceService) run(name string, task func() error) error {
+	return s.runDetailed(name, func() (string, error) {
+		return "", task()
+	})
+}
+
+// runDetailed task that returns details of the result and send a notification about the result
+func (s *MaintenanceService) runDetailed(name string, task func() (string, error)) error {
+	start := time.Now()
+	details, err := task()
+
+	notification := Notification{
+		Task:     name,
+		Error:    err,
+		Size:     -1,
+		Duration: time.Since(start),
+		Details:  details,
+	}
+	if entry, ok := s.entries[name]; ok {
+		notification.NextRun = s.Cron.Entry(entry).Next
+	}
+	s.Notify.Send(notification)
+	return err
+}
+
+// Vacuum and analyze the configured tables or the whole database
+func (s *MaintenanceService) Vacuum() error {
+	return s.run("vacuum", s.vacuum)
+}
+
+// vacuum the configured tables or the whole database
+func (s *MaintenanceService) vacuum() error {
+	vacuum, ok := s.Database.(VacuumConnection)
+	if !ok {
+		return errors.New("vacuum not supported by database type")
+	}
+
+	tables := s.Config.VacuumTables
+	if len(tables) > 0 {
+		s.logger().Printf("vacuum tables %v ...", tables)
+	} else {
+		s.logger().Printf("vacuum database ...")
+	}
+
+	start := time.Now()
+	err := vacuum.Vacuum(tables, s.Config.VacuumVerbose)
+	if err != nil {
+		return err
+	}
+
+	s.logger().Printf("vacuum finished in %s", time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// Reindex the configured indexes or the whole database
+func (s *MaintenanceService) Reindex() error {
+	return s.run("reindex", s.reindex)
+}
+
+// reindex the configured indexes or the whole database
+func (s *MaintenanceService) reindex() error {
+	reindex, ok := s.Database.(ReindexConnection)
+	if !ok {
+		return errors.New("reindex not supported by database type")
+	}
+
+	indexes := s.Config.ReindexIndexes
+	if len(indexes) > 0 {
+		s.logger().Printf("reindex indexes %v ...", indexes)
+	} else {
+		s.logger().Printf("reindex database ...")
+	}
+
+	start := time.Now()
+	err := reindex.Reindex(indexes)
+	if err != nil {
+		return err
+	}
+
+	s.logger().Printf("reindex finished in %s", time.Since(start).Round(time.Millisecond))
+	return nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// metric with values by label set
+type metric struct {
+	name   string
+	help   string
+	kind   string
+	values map[string]float64
+}
+
+// metricsRegistry exposed in the Prometheus text format on /metrics of the health check server
+type metricsRegistry struct {
+	mutex   sync.Mutex
+	metrics []*metric
+}
+
+var metrics metricsRegistry
+
+// counter metric that is only increased
+func (r *metricsRegistry) counter(name, help string) *metric {
+	return r.register(name, help, "counter")
+}
+
+// gauge metric that is set to the current value
+func (r *metricsRegistry) gauge(name, help string) *metric {
+	return r.register(name, help, "gauge")
+}
+
+// register new metric
+func (r *metricsRegistry) register(name, help, kind string) *metric {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	m := &metric{name: name, help: help, kind: kind, values: make(map[string]float64)}
+	r.metrics = append(r.metrics, m)
+	return m
+}
+
+// add value to the metric with the given labels
+func (m *metric) add(labels string, value float64) {
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+	m.values[labels] += value
+}
+
+// set value of the metric with the given labels
+func (m *metric) set(labels string, value float64) {
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+	m.values[labels] = value
+}
+
+// metricLabels formats the key value pairs as label set
+func metricLabels(pairs ...string) string {
+	var labels []string
+	for i := 0; i+1 < len(pairs); i += 2 {
+		labels = append(labels, fmt.Sprintf("%s=%s", pairs[i], strconv.Quote(pairs[i+1])))
+	}
+	return strings.Join(labels, ",")
+}
+
+// ServeHTTP writes all metrics in the Prometheus text format
+func (r *metricsRegistry) ServeHTTP(writer http.ResponseWriter, _ *http.Request) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	writer.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	for _, m := range r.metrics {
+		fmt.Fprintf(writer, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+		for _, labels := range slices.Sorted(maps.Keys(m.values)) {
+			value := strconv.FormatFloat(m.values[labels], 'g', -1, 64)
+			if labels == "" {
+				fmt.Fprintf(writer, "%s %s\n", m.name, value)
+			} else {
+				fmt.Fprintf(writer, "%s{%s} %s\n", m.name, labels, value)
+			}
+		}
+	}
+}
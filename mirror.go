@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/object"
+)
+
+var backupMirrorUploadsTotal = metrics.counter("housekeeper_backup_mirror_uploads_total",
+	"Uploads of backups to rclone mirrors by result")
+
+// MirrorStatus of the upload of a backup to an rclone mirror
+type MirrorStatus struct {
+	Path   string `json:"path" yaml:"path"`
+	Result string `json:"result" yaml:"result"`
+	Error  string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// prepareMirrors creates the rclone FS of all mirrors
+func (s *BackupService) prepareMirrors() error {
+	s.Mirrors = nil
+	for _, path := range s.Config.RCloneMirrors {
+		mirror, err := fs.NewFs(context.Background(), path)
+		if err != nil {
+			return fmt.Errorf("failed create rclone FS %s: %w", path, err)
+		}
+		s.Mirrors = append(s.Mirrors, mirror)
+	}
+	return nil
+}
+
+// mirrorBackup copies the backup file and its parity data to all mirrors.
+// Fails depending on the mirror policy if all or any of the uploads failed.
+func (s *BackupService) mirrorBackup(filename string) error {
+	if len(s.Mirrors) == 0 {
+		return nil
+	}
+
+	files := []string{filename}
+	if s.Config.ParityShards > 0 {
+		files = append(files, filename+parityExtension)
+	}
+
+	s.logger().Printf("> copy backup to mirrors")
+	var errs []error
+	for i, mirror := range s.Mirrors {
+		path := s.Config.RCloneMirrors[i]
+		status := MirrorStatus{Path: path, Result: "success"}
+
+		var err error
+		for _, file := range files {
+			if err = s.copyToMirror(mirror, file); err != nil {
+				break
+			}
+		}
+		if err != nil {
+			status.Result = "failed"
+			status.Error = err.Error()
+			errs = append(errs, fmt.Errorf("failed to copy backup to mirror %s: %w", path, err))
+			s.warn("-> copy to "+path+" failed", "error", err)
+		} else {
+			s.logger().Printf("-> %s", path)
+		}
+		backupMirrorUploadsTotal.add(metricLabels("job", s.Name, "remote", path, "result", status.Result), 1)
+		s.runStats.mirrors = append(s.runStats.mirrors, status)
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	// with policy any a single successful copy is sufficient
+	if s.Config.RCloneMirrorPolicy == "any" && len(errs) < len(s.Mirrors) {
+		return nil
+	}
+	return errors.Join(errs...)
+}
+
+// copyToMirror the file of the local storage or the rclone remote
+func (s *BackupService) copyToMirror(mirror fs.Fs, filename string) error {
+	source, err := s.openSource(filename)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	_, err = mirror.Put(context.Background(), source,
+		object.NewStaticObjectInfo(filename, time.Now(), -1, false, nil, nil))
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %w", filename, err)
+	}
+	return nil
+}
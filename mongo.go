@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/spf13/cast"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// MongoConnection used for initialization and backup of MongoDB
+type MongoConnection struct {
+	Config DatabaseConfig
+
+	// used for initial setup and connection check
+	ConnectionString string
+}
+
+// NewMongoConnection from the given configuration
+func NewMongoConnection(config DatabaseConfig) *MongoConnection {
+	if config.Port == 0 {
+		config.Port = 27017
+	}
+	if config.RootUsername == "" {
+		config.RootUsername = "root"
+	}
+
+	conf := MongoConnection{
+		Config: config,
+	}
+
+	// if root password is missing create connection from user credentials
+	connectionURL := url.URL{
+		Scheme: "mongodb",
+		Host:   fmt.Sprintf("%s:%d", config.Host, config.Port),
+		Path:   "/",
+	}
+	if config.RootPassword != "" {
+		connectionURL.User = url.UserPassword(config.RootUsername, config.RootPassword)
+		connectionURL.RawQuery = "authSource=admin"
+	} else {
+		connectionURL.User = url.UserPassword(config.Username, config.Password)
+		connectionURL.RawQuery = "authSource=" + url.QueryEscape(config.Database)
+	}
+	conf.ConnectionString = connectionURL.String()
+	return &conf
+}
+
+// connect to the MongoDB server
+func (c *MongoConnection) connect() (*mongo.Client, error) {
+	client, err := mongo.Connect(options.Client().ApplyURI(c.ConnectionString))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create connection: %w", err)
+	}
+	return client, nil
+}
+
+// WaitForConnection for a maximum of duration
+func (c *MongoConnection) WaitForConnection(duration time.Duration) error {
+	client, err := c.connect()
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect(context.Background())
+
+	// ticker to check every second for a connection
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+
+	timeoutExceeded := time.After(duration)
+	for {
+		select {
+		case <-timeoutExceeded:
+			return errors.New("timeout while trying to connect to database")
+
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			err = client.Ping(ctx, nil)
+			cancel()
+			if err == nil {
+				return nil
+			}
+		}
+	}
+}
+
+// Init database user if root password is given
+func (c *MongoConnection) Init() error {
+	if c.Config.RootPassword == "" {
+		c.Config.logger().Print("no root password given -> skip user and database creation")
+		return nil
+	}
+	c.Config.logger().Printf("initialize database ...")
+
+	client, err := c.connect()
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect(context.Background())
+
+	ctx := context.Background()
+	db := client.Database(c.Config.Database)
+
+	// create user if not exist
+	var usersInfo struct {
+		Users []bson.M `bson:"users"`
+	}
+	err = db.RunCommand(ctx, bson.D{{Key: "usersInfo", Value: c.Config.Username}}).Decode(&usersInfo)
+	if err != nil {
+		return fmt.Errorf("failed to check if user exists: %w", err)
+	}
+
+	if len(usersInfo.Users) == 0 {
+		err = db.RunCommand(ctx, bson.D{
+			{Key: "createUser", Value: c.Config.Username},
+			{Key: "pwd", Value: c.Config.Password},
+			{Key: "roles", Value: bson.A{
+				bson.D{{Key: "role", Value: "dbOwner"}, {Key: "db", Value: c.Config.Database}},
+			}},
+		}).Err()
+		if err != nil {
+			return fmt.Errorf("failed to create user: %w", err)
+		}
+		c.Config.logger().Printf("> user %s created", c.Config.Username)
+	} else {
+		c.Config.logger().Printf("> user %s already exist", c.Config.Username)
+	}
+
+	// databases in MongoDB are created implicitly on first write
+	c.Config.logger().Printf("> database %s is owned by %s", c.Config.Database, c.Config.Username)
+
+	return nil
+}
+
+// BackupFilename of the database dump inside the backup
+func (c *MongoConnection) BackupFilename() string {
+	return "database.archive"
+}
+
+// configFile with the password for the mongo tools (keeps it out of the process list)
+func (c *MongoConnection) configFile() (string, error) {
+	configFile, err := os.CreateTemp("", "mongo_*.yml")
+	if err != nil {
+		return "", fmt.Errorf("failed to create mongo tools config: %w", err)
+	}
+
+	_, err = fmt.Fprintf(configFile, "password: %q\n", c.Config.Password)
+	configFile.Close()
+	if err != nil {
+		os.Remove(configFile.Name())
+		return "", fmt.Errorf("failed to write mongo tools config: %w", err)
+	}
+	return configFile.Name(), nil
+}
+
+// command for a mongo tool with connection arguments
+func (c *MongoConnection) command(name, configFile string, args ...string) *exec.Cmd {
+	cmdArgs := []string{
+		"--host", c.Config.Host,
+		"--port", cast.ToString(c.Config.Port),
+		"--username", c.Config.Username,
+		"--authenticationDatabase", c.Config.Database,
+		"--config", configFile,
+	}
+	cmd := exec.Command(name, append(cmdArgs, args...)...)
+	cmd.Stderr = os.Stderr
+	return cmd
+}
+
+// Backup database to the given writer
+func (c *MongoConnection) Backup(writer io.Writer) error {
+	configFile, err := c.configFile()
+	if err != nil {
+		return err
+	}
+	defer os.Remove(configFile)
+
+	cmd := c.command("mongodump", configFile,
+		"--db", c.Config.Database,
+		"--archive")
+
+	// redirect stdout to backup writer
+	cmd.Stdout = writer
+
+	return cmd.Run()
+}
+
+// IsEmpty returns true if the configured database contains no collections
+func (c *MongoConnection) IsEmpty() (bool, error) {
+	client, err := c.connect()
+	if err != nil {
+		return false, err
+	}
+	defer client.Disconnect(context.Background())
+
+	collections, err := client.Database(c.Config.Database).ListCollectionNames(context.Background(), bson.D{})
+	if err != nil {
+		return false, fmt.Errorf("failed to list collections: %w", err)
+	}
+	return len(collections) == 0, nil
+}
+
+// CreateDatabase is not required as databases are created implicitly on first write
+func (c *MongoConnection) CreateDatabase(_ string) error {
+	return nil
+}
+
+// Restore database dump from the given reader
+func (c *MongoConnection) Restore(database, _ string, reader io.Reader) error {
+	configFile, err := c.configFile()
+	if err != nil {
+		return err
+	}
+	defer os.Remove(configFile)
+
+	args := []string{"--archive", "--nsInclude", c.Config.Database + ".*"}
+	if database != "" && database != c.Config.Database {
+		// restore into a different database
+		args = append(args,
+			"--nsFrom", c.Config.Database+".*",
+			"--nsTo", database+".*")
+	}
+	cmd := c.command("mongorestore", configFile, args...)
+
+	// read dump from stdin
+	cmd.Stdin = reader
+	cmd.Stdout = os.Stderr
+
+	return cmd.Run()
+}
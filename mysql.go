@@ -0,0 +1,242 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/spf13/cast"
+)
+
+// MySQLConnection used for initialization and backup of MySQL/MariaDB
+type MySQLConnection struct {
+	Config DatabaseConfig
+
+	// used for initial setup and connection check
+	ConnectionString string
+
+	toolRunner
+}
+
+// NewMySQLConnection from the given configuration
+func NewMySQLConnection(config DatabaseConfig) *MySQLConnection {
+	if config.Port == 0 {
+		config.Port = 3306
+	}
+	if config.RootUsername == "" {
+		config.RootUsername = "root"
+	}
+
+	conf := MySQLConnection{
+		Config: config,
+	}
+
+	dsn := mysql.NewConfig()
+	dsn.Net = "tcp"
+	dsn.Addr = fmt.Sprintf("%s:%d", config.Host, config.Port)
+
+	// if root password is missing create connection from user credentials
+	if config.RootPassword != "" {
+		dsn.User = config.RootUsername
+		dsn.Passwd = config.RootPassword
+	} else {
+		dsn.User = config.Username
+		dsn.Passwd = config.Password
+	}
+	conf.ConnectionString = dsn.FormatDSN()
+	return &conf
+}
+
+// WaitForConnection for a maximum of duration
+func (c *MySQLConnection) WaitForConnection(duration time.Duration) error {
+	db, err := sql.Open("mysql", c.ConnectionString)
+	if err != nil {
+		return fmt.Errorf("failed to create connection: %w", err)
+	}
+	defer db.Close()
+
+	// ticker to check every second for a connection
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+
+	timeoutExceeded := time.After(duration)
+	for {
+		select {
+		case <-timeoutExceeded:
+			return errors.New("timeout while trying to connect to database")
+
+		case <-ticker.C:
+			err = db.Ping()
+			if err == nil {
+				return nil
+			}
+		}
+	}
+}
+
+// Init database if root password is given
+func (c *MySQLConnection) Init() error {
+	if c.Config.RootPassword == "" {
+		c.Config.logger().Print("no root password given -> skip user and database creation")
+		return nil
+	}
+	c.Config.logger().Printf("initialize database ...")
+
+	conn, err := sql.Open("mysql", c.ConnectionString)
+	if err != nil {
+		return fmt.Errorf("failed to create connection: %w", err)
+	}
+	defer conn.Close()
+	db := debugDB{conn, c.Config}
+
+	var dummy string
+	// create user if not exist
+	err = db.QueryRow("SELECT User FROM mysql.user WHERE User = ?", c.Config.Username).Scan(&dummy)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			return fmt.Errorf("failed to check if user exists: %w", err)
+		}
+		_, err = db.Exec(fmt.Sprintf("CREATE USER %s@'%%' IDENTIFIED BY %s",
+			mysqlQuoteLiteral(c.Config.Username), mysqlQuoteLiteral(c.Config.Password)))
+		if err != nil {
+			return fmt.Errorf("failed to create user: %w", err)
+		}
+		c.Config.logger().Printf("> user %s created", c.Config.Username)
+	} else {
+		c.Config.logger().Printf("> user %s already exist", c.Config.Username)
+	}
+
+	// create database if not exist
+	err = db.QueryRow("SELECT SCHEMA_NAME FROM information_schema.SCHEMATA WHERE SCHEMA_NAME = ?", c.Config.Database).Scan(&dummy)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			return fmt.Errorf("failed to check if database exists: %w", err)
+		}
+		_, err = db.Exec(fmt.Sprintf("CREATE DATABASE %s", mysqlQuoteIdentifier(c.Config.Database)))
+		if err != nil {
+			return fmt.Errorf("failed to create database: %w", err)
+		}
+		c.Config.logger().Printf("> database %s created", c.Config.Database)
+	} else {
+		c.Config.logger().Printf("> database %s already exist", c.Config.Database)
+	}
+
+	// ensure user has permissions in database
+	_, err = db.Exec(fmt.Sprintf("GRANT ALL PRIVILEGES ON %s.* TO %s@'%%'",
+		mysqlQuoteIdentifier(c.Config.Database), mysqlQuoteLiteral(c.Config.Username)))
+	if err != nil {
+		return fmt.Errorf("failed to grant database permissions: %w", err)
+	}
+
+	return nil
+}
+
+// BackupFilename of the database dump inside the backup
+func (c *MySQLConnection) BackupFilename() string {
+	return "database.sql"
+}
+
+// Backup database to the given writer
+func (c *MySQLConnection) Backup(writer io.Writer) error {
+	cmd := exec.Command("mysqldump",
+		"-h", c.Config.Host,
+		"-P", cast.ToString(c.Config.Port),
+		"-u", c.Config.Username,
+		"--single-transaction",
+		"--routines",
+		"--triggers",
+		c.Config.Database)
+
+	// set MYSQL_PWD env variable
+	env := os.Environ()
+	env = append(env, "MYSQL_PWD="+c.Config.Password)
+	cmd.Env = env
+
+	// redirect stdout to backup writer
+	cmd.Stdout = writer
+	cmd.Stderr = os.Stderr
+
+	return c.run(cmd)
+}
+
+// IsEmpty returns true if the configured database contains no tables
+func (c *MySQLConnection) IsEmpty() (bool, error) {
+	db, err := sql.Open("mysql", c.ConnectionString)
+	if err != nil {
+		return false, fmt.Errorf("failed to create connection: %w", err)
+	}
+	defer db.Close()
+
+	var tables int
+	err = db.QueryRow("SELECT count(*) FROM information_schema.TABLES WHERE TABLE_SCHEMA = ?", c.Config.Database).Scan(&tables)
+	if err != nil {
+		return false, fmt.Errorf("failed to count tables: %w", err)
+	}
+	return tables == 0, nil
+}
+
+// CreateDatabase if it does not exist and grant permissions to the configured user
+func (c *MySQLConnection) CreateDatabase(database string) error {
+	db, err := sql.Open("mysql", c.ConnectionString)
+	if err != nil {
+		return fmt.Errorf("failed to create connection: %w", err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec(fmt.Sprintf("CREATE DATABASE IF NOT EXISTS %s", mysqlQuoteIdentifier(database)))
+	if err != nil {
+		return fmt.Errorf("failed to create database %s: %w", database, err)
+	}
+
+	// permissions can only be granted with root credentials
+	if c.Config.RootPassword != "" {
+		_, err = db.Exec(fmt.Sprintf("GRANT ALL PRIVILEGES ON %s.* TO %s@'%%'",
+			mysqlQuoteIdentifier(database), mysqlQuoteLiteral(c.Config.Username)))
+		if err != nil {
+			return fmt.Errorf("failed to grant database permissions: %w", err)
+		}
+	}
+	return nil
+}
+
+// Restore database dump from the given reader
+func (c *MySQLConnection) Restore(database, _ string, reader io.Reader) error {
+	if database == "" {
+		database = c.Config.Database
+	}
+
+	cmd := exec.Command("mysql",
+		"-h", c.Config.Host,
+		"-P", cast.ToString(c.Config.Port),
+		"-u", c.Config.Username,
+		database)
+
+	// set MYSQL_PWD env variable
+	env := os.Environ()
+	env = append(env, "MYSQL_PWD="+c.Config.Password)
+	cmd.Env = env
+
+	// read dump from stdin
+	cmd.Stdin = reader
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+
+	return cmd.Run()
+}
+
+// mysqlQuoteIdentifier quotes a database or table name for use in SQL statements
+func mysqlQuoteIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// mysqlQuoteLiteral quotes a string (e.g. user name or password) for use in SQL statements
+func mysqlQuoteLiteral(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
@@ -0,0 +1,24 @@
+package main
+
+import "testing"
+
+func TestMySQLQuote(t *testing.T) {
+	tests := []struct {
+		value      string
+		literal    string
+		identifier string
+	}{
+		{"app", "'app'", "`app`"},
+		{"it's", "'it''s'", "`it's`"},
+		{`a\'b`, `'a\\''b'`, "`a\\'b`"},
+		{"a`b", "'a`b'", "`a``b`"},
+	}
+	for _, test := range tests {
+		if literal := mysqlQuoteLiteral(test.value); literal != test.literal {
+			t.Errorf("mysqlQuoteLiteral(%s) = %s, expected %s", test.value, literal, test.literal)
+		}
+		if identifier := mysqlQuoteIdentifier(test.value); identifier != test.identifier {
+			t.Errorf("mysqlQuoteIdentifier(%s) = %s, expected %s", test.value, identifier, test.identifier)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// neo4jBackupPort is the default port of the enterprise online backup
+const neo4jBackupPort = "6362"
+
+// Neo4jConnection used for initialization and backup of Neo4j
+type Neo4jConnection struct {
+	Config DatabaseConfig
+
+	// BaseURL of the Neo4j HTTP API
+	BaseURL string
+}
+
+// NewNeo4jConnection from the given configuration
+func NewNeo4jConnection(config DatabaseConfig) *Neo4jConnection {
+	if config.Port == 0 {
+		config.Port = 7474
+	}
+	if config.RootUsername == "" {
+		config.RootUsername = "neo4j"
+	}
+	if config.Database == "" {
+		config.Database = "neo4j"
+	}
+
+	return &Neo4jConnection{
+		Config:  config,
+		BaseURL: fmt.Sprintf("http://%s:%d", config.Host, config.Port),
+	}
+}
+
+// query executes the cypher statement on the given database via HTTP API
+func (c *Neo4jConnection) query(database, statement string, parameters map[string]any) error {
+	body, err := json.Marshal(map[string]any{
+		"statements": []map[string]any{{
+			"statement":  statement,
+			"parameters": parameters,
+		}},
+	})
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequest(http.MethodPost,
+		fmt.Sprintf("%s/db/%s/tx/commit", c.BaseURL, database), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.SetBasicAuth(c.Config.RootUsername, c.Config.RootPassword)
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("query failed with %s", response.Status)
+	}
+
+	var result struct {
+		Errors []struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err = json.NewDecoder(response.Body).Decode(&result); err != nil {
+		return err
+	}
+	if len(result.Errors) > 0 {
+		return fmt.Errorf("%s: %s", result.Errors[0].Code, result.Errors[0].Message)
+	}
+	return nil
+}
+
+// WaitForConnection for a maximum of duration
+func (c *Neo4jConnection) WaitForConnection(duration time.Duration) error {
+	// ticker to check every second for a connection
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+
+	timeoutExceeded := time.After(duration)
+	for {
+		select {
+		case <-timeoutExceeded:
+			return errors.New("timeout while trying to connect to neo4j")
+
+		case <-ticker.C:
+			response, err := http.Get(c.BaseURL)
+			if err == nil {
+				response.Body.Close()
+				if response.StatusCode == http.StatusOK {
+					return nil
+				}
+			}
+		}
+	}
+}
+
+// running returns true if the HTTP API of the server is reachable
+func (c *Neo4jConnection) running() bool {
+	response, err := http.Get(c.BaseURL)
+	if err != nil {
+		return false
+	}
+	response.Body.Close()
+	return true
+}
+
+// Init database and user if root password is given
+func (c *Neo4jConnection) Init() error {
+	if c.Config.RootPassword == "" {
+		c.Config.logger().Print("no root password given -> skip user and database creation")
+		return nil
+	}
+	c.Config.logger().Printf("initialize database ...")
+
+	err := c.query("system", "CREATE USER $user IF NOT EXISTS SET PASSWORD $password CHANGE NOT REQUIRED",
+		map[string]any{"user": c.Config.Username, "password": c.Config.Password})
+	if err != nil {
+		return fmt.Errorf("failed to create user: %w", err)
+	}
+	c.Config.logger().Printf("> user %s ensured", c.Config.Username)
+
+	// additional databases are only supported by the enterprise edition
+	if c.Config.Database != "neo4j" {
+		err = c.query("system", "CREATE DATABASE $database IF NOT EXISTS",
+			map[string]any{"database": c.Config.Database})
+		if err != nil {
+			return fmt.Errorf("failed to create database: %w", err)
+		}
+		c.Config.logger().Printf("> database %s ensured", c.Config.Database)
+	}
+
+	return nil
+}
+
+// BackupFilename of the database dump inside the backup
+func (c *Neo4jConnection) BackupFilename() string {
+	if c.Config.Neo4jOnlineBackup {
+		return "database.backup.tar"
+	}
+	return "database.dump"
+}
+
+// Backup database to the given writer
+func (c *Neo4jConnection) Backup(writer io.Writer) error {
+	if c.Config.Neo4jOnlineBackup {
+		return c.onlineBackup(writer)
+	}
+
+	// offline dump requires access to the database files of a stopped server
+	if c.running() {
+		return errors.New("offline dump requires a stopped neo4j server (use DB_NEO4J_ONLINE_BACKUP for a running enterprise server)")
+	}
+	cmd := exec.Command("neo4j-admin", "database", "dump",
+		"--to-stdout", c.Config.Database)
+
+	// redirect stdout to backup writer
+	cmd.Stdout = writer
+	cmd.Stderr = os.Stderr
+
+	return cmd.Run()
+}
+
+// onlineBackup of a running enterprise server
+func (c *Neo4jConnection) onlineBackup(writer io.Writer) error {
+	dir, err := os.MkdirTemp("", "neo4j_backup_")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cmd := exec.Command("neo4j-admin", "database", "backup",
+		"--from", net.JoinHostPort(c.Config.Host, neo4jBackupPort),
+		"--to-path", dir,
+		c.Config.Database)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	err = cmd.Run()
+	if err != nil {
+		return fmt.Errorf("failed to backup neo4j database: %w", err)
+	}
+
+	return writeTar(writer, dir)
+}
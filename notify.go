@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Notification about the result of a task
+type Notification struct {
+	// Task that was executed (e.g. backup)
+	Task string
+	// Job name of backup tasks (empty if no jobs are defined)
+	Job string
+	// Error of the task (nil on success)
+	Error error
+
+	// Filename of the created backup
+	Filename string
+	// Size of the created backup (-1 if unknown)
+	Size int64
+	// Duration of the task
+	Duration time.Duration
+	// NextRun of the task (zero if not scheduled)
+	NextRun time.Time
+	// Details of the task result (e.g. removed containers)
+	Details string
+}
+
+// Success returns true if the task succeeded
+func (n Notification) Success() bool {
+	return n.Error == nil
+}
+
+// Title of the notification
+func (n Notification) Title() string {
+	task := strings.ToUpper(n.Task[:1]) + n.Task[1:]
+	if n.Job != "" {
+		task += " " + n.Job
+	}
+	if n.Success() {
+		return task + " succeeded"
+	}
+	return task + " failed"
+}
+
+// Fields with the details of the notification
+func (n Notification) Fields() [][2]string {
+	var fields [][2]string
+	if n.Error != nil {
+		fields = append(fields, [2]string{"Error", n.Error.Error()})
+	}
+	if n.Filename != "" {
+		fields = append(fields, [2]string{"File", n.Filename})
+	}
+	if n.Size >= 0 && n.Success() {
+		fields = append(fields, [2]string{"Size", formatSize(n.Size)})
+	}
+	if n.Details != "" {
+		fields = append(fields, [2]string{"Details", n.Details})
+	}
+	fields = append(fields, [2]string{"Duration", n.Duration.Round(time.Millisecond).String()})
+	if !n.NextRun.IsZero() {
+		fields = append(fields, [2]string{"Next run", n.NextRun.Format(time.RFC3339)})
+	}
+	return fields
+}
+
+// Message with the details of the notification as text
+func (n Notification) Message() string {
+	var lines []string
+	for _, field := range n.Fields() {
+		lines = append(lines, field[0]+": "+field[1])
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Notifier sends notifications to an external service
+type Notifier interface {
+	Notify(notification Notification) error
+}
+
+// StartNotifier is implemented by notifiers that are informed about started tasks
+type StartNotifier interface {
+	NotifyStart(task string) error
+}
+
+// NotificationService sends notifications to all configured notifiers
+type NotificationService struct {
+	// Notifiers receive the results selected by the policy
+	Notifiers []Notifier
+	// Monitors receive all results independent of the policy (e.g. dead man's switch)
+	Monitors []Notifier
+
+	// Policy selects the results sent to the notifiers (always, failure or recovery)
+	Policy string
+
+	// failed tasks of the last run
+	failed map[string]bool
+	mutex  sync.Mutex
+}
+
+// NewNotificationService with the notifiers of the given config
+func NewNotificationService(config NotifyConfig) (*NotificationService, error) {
+	service := &NotificationService{
+		Policy: config.On,
+		failed: make(map[string]bool),
+	}
+	if len(config.URLs) > 0 {
+		notifier, err := NewShoutrrrNotifier(config.URLs)
+		if err != nil {
+			return nil, err
+		}
+		service.Notifiers = append(service.Notifiers, notifier)
+	}
+	if config.SlackWebhook != "" {
+		service.Notifiers = append(service.Notifiers, &SlackNotifier{
+			Webhook:     config.SlackWebhook,
+			FailureOnly: config.SlackFailureOnly,
+		})
+	}
+	if config.DiscordWebhook != "" {
+		service.Notifiers = append(service.Notifiers, &DiscordNotifier{
+			Webhook: config.DiscordWebhook,
+		})
+	}
+	if config.GotifyURL != "" {
+		service.Notifiers = append(service.Notifiers, &GotifyNotifier{
+			URL:   config.GotifyURL,
+			Token: config.GotifyToken,
+		})
+	}
+	if config.HealthchecksURL != "" {
+		service.Monitors = append(service.Monitors, &HealthchecksNotifier{
+			URL: config.HealthchecksURL,
+		})
+	}
+	return service, nil
+}
+
+// Start of a task is sent to all notifiers that support it (errors are only logged)
+func (s *NotificationService) Start(task string) {
+	if s == nil {
+		return
+	}
+	for _, notifier := range s.Monitors {
+		if starter, ok := notifier.(StartNotifier); ok {
+			if err := starter.NotifyStart(task); err != nil {
+				newLogger("notify").Error("> failed to send notification", "error", err)
+			}
+		}
+	}
+}
+
+// Send notification to all monitors and to the notifiers if selected by the policy (errors are only logged)
+func (s *NotificationService) Send(notification Notification) {
+	if s == nil {
+		return
+	}
+
+	for _, monitor := range s.Monitors {
+		if err := monitor.Notify(notification); err != nil {
+			newLogger("notify").Error("> failed to send notification", "error", err)
+		}
+	}
+	if !s.selected(notification) {
+		return
+	}
+	for _, notifier := range s.Notifiers {
+		if err := notifier.Notify(notification); err != nil {
+			newLogger("notify").Error("> failed to send notification", "error", err)
+		}
+	}
+}
+
+// selected returns true if the notification should be sent based on the policy
+// and the result of the previous run of the task (recovery sends only changes)
+func (s *NotificationService) selected(notification Notification) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	failed := !notification.Success()
+	key := notification.Task + "/" + notification.Job
+	previous := s.failed[key]
+	s.failed[key] = failed
+
+	switch s.Policy {
+	case "failure":
+		return failed
+	case "recovery":
+		return failed != previous
+	default:
+		return true
+	}
+}
+
+// notifyClient used for all notification requests
+var notifyClient = &http.Client{Timeout: 30 * time.Second}
+
+// postJSON payload to the given URL
+func postJSON(url string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	response, err := notifyClient.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, 512))
+		return fmt.Errorf("unexpected status %s: %s", response.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
@@ -0,0 +1,433 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+
+	"github.com/klauspost/reedsolomon"
+)
+
+const (
+	// parityExtension of parity files next to the backup file
+	parityExtension = ".par"
+	// parityDataShards per stripe of the backup file
+	parityDataShards = 10
+	// parityShardSize in bytes
+	parityShardSize = 64 * 1024
+)
+
+// parityHeader at the start of a parity file
+type parityHeader struct {
+	Version      int `json:"version"`
+	DataShards   int `json:"data_shards"`
+	ParityShards int `json:"parity_shards"`
+	ShardSize    int `json:"shard_size"`
+}
+
+// stripeSize of the data covered by one parity record
+func (h parityHeader) stripeSize() int {
+	return h.DataShards * h.ShardSize
+}
+
+// recordSize of the checksums and parity shards of one stripe
+func (h parityHeader) recordSize() int {
+	return (h.DataShards+h.ParityShards)*sha256.Size + h.ParityShards*h.ShardSize
+}
+
+// parityWriter forwards all data to the backup file and writes Reed-Solomon parity
+// shards with the checksums of all shards for every stripe to the parity file.
+// The parity file ends with the size of the backup file (8 byte big endian).
+type parityWriter struct {
+	writer  io.Writer
+	parity  io.Writer
+	header  parityHeader
+	encoder reedsolomon.Encoder
+
+	stripe []byte
+	size   int64
+}
+
+// newParityWriter with the given number of parity shards per stripe
+func newParityWriter(writer, parity io.Writer, parityShards int) (*parityWriter, error) {
+	header := parityHeader{
+		Version:      1,
+		DataShards:   parityDataShards,
+		ParityShards: parityShards,
+		ShardSize:    parityShardSize,
+	}
+	encoder, err := reedsolomon.New(header.DataShards, header.ParityShards)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create parity encoder: %w", err)
+	}
+
+	data, err := json.Marshal(header)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = parity.Write(append(data, '\n')); err != nil {
+		return nil, fmt.Errorf("failed to write parity header: %w", err)
+	}
+
+	return &parityWriter{
+		writer:  writer,
+		parity:  parity,
+		header:  header,
+		encoder: encoder,
+		stripe:  make([]byte, 0, header.stripeSize()),
+	}, nil
+}
+
+// Write data to backup file and create parity for completed stripes
+func (w *parityWriter) Write(p []byte) (int, error) {
+	n, err := w.writer.Write(p)
+	w.size += int64(n)
+
+	for data := p[:n]; len(data) > 0; {
+		count := min(len(data), cap(w.stripe)-len(w.stripe))
+		w.stripe = append(w.stripe, data[:count]...)
+		data = data[count:]
+
+		if len(w.stripe) == cap(w.stripe) {
+			if parityErr := w.writeStripe(); parityErr != nil {
+				return n, parityErr
+			}
+		}
+	}
+	return n, err
+}
+
+// writeStripe parity record of the current stripe
+func (w *parityWriter) writeStripe() error {
+	shards, err := encodeStripe(w.encoder, w.header, w.stripe)
+	if err != nil {
+		return err
+	}
+	w.stripe = w.stripe[:0]
+
+	record := make([]byte, 0, w.header.recordSize())
+	for _, shard := range shards {
+		checksum := sha256.Sum256(shard)
+		record = append(record, checksum[:]...)
+	}
+	for _, shard := range shards[w.header.DataShards:] {
+		record = append(record, shard...)
+	}
+	if _, err = w.parity.Write(record); err != nil {
+		return fmt.Errorf("failed to write parity: %w", err)
+	}
+	return nil
+}
+
+// Close writes the parity of the last stripe and the size of the backup file
+func (w *parityWriter) Close() error {
+	if len(w.stripe) > 0 {
+		if err := w.writeStripe(); err != nil {
+			return err
+		}
+	}
+	return binary.Write(w.parity, binary.BigEndian, w.size)
+}
+
+// encodeStripe into data and parity shards (data is padded with zeros)
+func encodeStripe(encoder reedsolomon.Encoder, header parityHeader, stripe []byte) ([][]byte, error) {
+	shards := make([][]byte, header.DataShards+header.ParityShards)
+	for i := range shards {
+		shards[i] = make([]byte, header.ShardSize)
+		if i < header.DataShards && i*header.ShardSize < len(stripe) {
+			copy(shards[i], stripe[i*header.ShardSize:])
+		}
+	}
+	if err := encoder.Encode(shards); err != nil {
+		return nil, fmt.Errorf("failed to create parity: %w", err)
+	}
+	return shards, nil
+}
+
+// parityDamage of a backup file found by the parity check
+type parityDamage struct {
+	// Stripes with corrupted shards by stripe index
+	Stripes map[int64][]int
+	// Size of the backup file recorded in the parity file
+	Size int64
+	// Unrepairable is set if a stripe contains more corrupted shards than parity shards
+	Unrepairable bool
+	// ParityCorrupted is set if only shards of the parity file are corrupted
+	ParityCorrupted bool
+
+	header parityHeader
+}
+
+// checkParity of the backup data and return the corrupted shards
+func checkParity(data, parity io.Reader) (*parityDamage, error) {
+	parityReader := bufio.NewReader(parity)
+	line, err := parityReader.ReadBytes('\n')
+	if err != nil {
+		return nil, fmt.Errorf("failed to read parity header: %w", err)
+	}
+	var header parityHeader
+	if err = json.Unmarshal(line, &header); err != nil || header.Version != 1 {
+		return nil, errors.New("invalid parity header")
+	}
+
+	damage := &parityDamage{
+		Stripes: make(map[int64][]int),
+		header:  header,
+	}
+	stripe := make([]byte, header.stripeSize())
+	record := make([]byte, header.recordSize())
+	var dataSize int64
+	for index := int64(0); ; index++ {
+		n, err := io.ReadFull(parityReader, record)
+		if err == io.ErrUnexpectedEOF && n == 8 {
+			// size of backup file at the end of the parity file
+			damage.Size = int64(binary.BigEndian.Uint64(record[:8]))
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read parity: %w", err)
+		}
+
+		read, err := io.ReadFull(data, stripe)
+		if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+			return nil, fmt.Errorf("failed to read backup: %w", err)
+		}
+		dataSize += int64(read)
+		clear(stripe[read:])
+
+		var corrupted []int
+		for i := 0; i < header.DataShards+header.ParityShards; i++ {
+			var shard []byte
+			if i < header.DataShards {
+				shard = stripe[i*header.ShardSize : (i+1)*header.ShardSize]
+			} else {
+				offset := (header.DataShards+header.ParityShards)*sha256.Size + (i-header.DataShards)*header.ShardSize
+				shard = record[offset : offset+header.ShardSize]
+			}
+			checksum := sha256.Sum256(shard)
+			if !bytes.Equal(checksum[:], record[i*sha256.Size:(i+1)*sha256.Size]) {
+				corrupted = append(corrupted, i)
+			}
+		}
+		if len(corrupted) > 0 {
+			damage.Stripes[index] = corrupted
+			if len(corrupted) > header.ParityShards {
+				damage.Unrepairable = true
+			}
+		}
+	}
+
+	// trailing data is not covered by parity
+	if extra, _ := io.Copy(io.Discard, data); extra > 0 || dataSize != damage.Size {
+		return nil, fmt.Errorf("backup size %d does not match parity data (%d)", dataSize+extra, damage.Size)
+	}
+
+	damage.ParityCorrupted = len(damage.Stripes) > 0
+	for _, shards := range damage.Stripes {
+		if shards[0] < header.DataShards {
+			damage.ParityCorrupted = false
+		}
+	}
+	return damage, nil
+}
+
+// repairParity restores the corrupted data shards of the local backup file
+func repairParity(filename string, damage *parityDamage) error {
+	parity, err := os.Open(filename + parityExtension)
+	if err != nil {
+		return fmt.Errorf("failed to open parity file: %w", err)
+	}
+	defer parity.Close()
+
+	parityReader := bufio.NewReader(parity)
+	line, err := parityReader.ReadBytes('\n')
+	if err != nil {
+		return fmt.Errorf("failed to read parity header: %w", err)
+	}
+	var header parityHeader
+	if err = json.Unmarshal(line, &header); err != nil {
+		return errors.New("invalid parity header")
+	}
+	encoder, err := reedsolomon.New(header.DataShards, header.ParityShards)
+	if err != nil {
+		return fmt.Errorf("failed to create parity decoder: %w", err)
+	}
+
+	file, err := os.OpenFile(filename, os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer file.Close()
+
+	record := make([]byte, header.recordSize())
+	headerSize := int64(len(line))
+	for index, corrupted := range damage.Stripes {
+		_, err = parity.ReadAt(record, headerSize+index*int64(header.recordSize()))
+		if err != nil {
+			return fmt.Errorf("failed to read parity: %w", err)
+		}
+
+		stripe := make([]byte, header.stripeSize())
+		offset := index * int64(header.stripeSize())
+		n, err := file.ReadAt(stripe, offset)
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("failed to read backup: %w", err)
+		}
+
+		// corrupted shards are reconstructed from the remaining shards
+		shards := make([][]byte, header.DataShards+header.ParityShards)
+		for i := range shards {
+			if i < header.DataShards {
+				shards[i] = stripe[i*header.ShardSize : (i+1)*header.ShardSize]
+			} else {
+				start := (header.DataShards+header.ParityShards)*sha256.Size + (i-header.DataShards)*header.ShardSize
+				shards[i] = record[start : start+header.ShardSize]
+			}
+		}
+		for _, i := range corrupted {
+			shards[i] = nil
+		}
+		if err = encoder.ReconstructData(shards); err != nil {
+			return fmt.Errorf("failed to repair stripe %d: %w", index, err)
+		}
+
+		for _, i := range corrupted {
+			if i >= header.DataShards {
+				continue
+			}
+			// skip padding of the last stripe
+			length := min(header.ShardSize, n-i*header.ShardSize)
+			if length <= 0 {
+				continue
+			}
+			_, err = file.WriteAt(shards[i][:length], offset+int64(i*header.ShardSize))
+			if err != nil {
+				return fmt.Errorf("failed to write repaired data: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// writeParityFile for an existing local backup file
+func writeParityFile(filename string, parityShards int) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	parity, err := os.Create(filename + parityExtension)
+	if err != nil {
+		return fmt.Errorf("failed to create parity file: %w", err)
+	}
+	defer parity.Close()
+
+	writer, err := newParityWriter(io.Discard, parity, parityShards)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(writer, file); err != nil {
+		return err
+	}
+	return writer.Close()
+}
+
+// VerifyOptions for a verify run
+type VerifyOptions struct {
+	// Job of the backup (first job if empty)
+	Job string
+	// Filename of backup to verify
+	Filename string
+	// Latest backup of local storage and rclone remote is verified
+	Latest bool
+	// Repair corrupted data with the parity file (local backups only)
+	Repair bool
+}
+
+// Verify backup with the parity data and the checksums of the entries
+func (s *BackupService) Verify(options VerifyOptions) error {
+	filename := options.Filename
+	if options.Latest {
+		var err error
+		filename, err = s.latestBackup()
+		if err != nil {
+			return err
+		}
+	} else if filename == "" {
+		return errors.New("no backup file given (use --latest to verify the newest backup)")
+	}
+	s.logger().Printf("verify backup %s ...", filename)
+
+	if err := s.verifyParity(filename, options.Repair); err != nil {
+		return err
+	}
+
+	archive, err := s.openBackup(filename)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	if err = archive.verify(s.logger(), nil); err != nil {
+		return err
+	}
+	s.logger().Printf("verify finished")
+	return nil
+}
+
+// verifyParity of the backup file if a parity file exists
+func (s *BackupService) verifyParity(filename string, repair bool) error {
+	parity, err := s.openSource(filename + parityExtension)
+	if err != nil {
+		s.logger().Printf("> no parity data found -> skip parity check")
+		return nil
+	}
+	defer parity.Close()
+
+	data, err := s.openSource(filename)
+	if err != nil {
+		return err
+	}
+	defer data.Close()
+
+	s.logger().Printf("> check parity")
+	damage, err := checkParity(data, parity)
+	if err != nil {
+		return err
+	}
+	if len(damage.Stripes) == 0 {
+		return nil
+	}
+
+	for _, index := range slices.Sorted(maps.Keys(damage.Stripes)) {
+		s.logger().Warn(fmt.Sprintf("-> stripe %d: %d corrupted shards", index, len(damage.Stripes[index])))
+	}
+	switch {
+	case damage.Unrepairable:
+		return errors.New("backup is corrupted and can not be repaired with the parity data")
+	case !repair:
+		return errors.New("backup is corrupted (use --repair to restore it from the parity data)")
+	case !s.isLocalBackup(filename):
+		return errors.New("repair is only supported for local backups")
+	}
+
+	// corrupted parity data is replaced by new parity data of the intact backup
+	path := s.localBackupPath(filename)
+	if !damage.ParityCorrupted {
+		s.logger().Printf("> repair backup")
+		if err = repairParity(path, damage); err != nil {
+			return err
+		}
+	}
+	s.logger().Printf("> recreate parity data")
+	return writeParityFile(path, damage.header.ParityShards)
+}
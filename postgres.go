@@ -1,16 +1,20 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 	"io"
-	"log"
+	"net/url"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 	"github.com/spf13/cast"
 )
 
@@ -20,27 +24,88 @@ type PostgresConnection struct {
 
 	// used for initial setup and connection check
 	ConnectionString string
+	// used for maintenance tasks inside the configured database
+	DatabaseConnectionString string
+
+	// major version of the database server (detected on first use)
+	serverVersion int
+
+	toolRunner
 }
 
 // NewPostgresConnection from the given configuration
 func NewPostgresConnection(config DatabaseConfig) *PostgresConnection {
+	if config.Port == 0 {
+		config.Port = 5432
+	}
+	if config.DumpFormat == "" {
+		config.DumpFormat = "plain"
+	}
+	if config.RootUsername == "" {
+		config.RootUsername = "postgres"
+	}
+
 	conf := PostgresConnection{
 		Config: config,
 	}
 
 	// if root password is missing create connection from user credentials
+	username, password := config.Username, config.Password
 	if config.RootPassword != "" {
-		conf.ConnectionString = fmt.Sprintf("postgres://%s:%s@%s:%d?sslmode=disable",
-			config.RootUsername, config.RootPassword,
-			config.Host, config.Port)
-	} else {
-		conf.ConnectionString = fmt.Sprintf("postgres://%s:%s@%s:%d?sslmode=disable",
-			config.Username, config.Password,
-			config.Host, config.Port)
+		username, password = config.RootUsername, config.RootPassword
 	}
+	address, query := postgresAddress(config)
+	conf.ConnectionString = fmt.Sprintf("postgres://%s:%s@%s?%s",
+		username, password, address, query.Encode())
+	conf.DatabaseConnectionString = fmt.Sprintf("postgres://%s:%s@%s/%s?%s",
+		username, password, address, config.Database, query.Encode())
 	return &conf
 }
 
+// postgresAddress returns host address and query parameters for a connection string
+func postgresAddress(config DatabaseConfig) (string, url.Values) {
+	query := postgresSSLQuery(config)
+
+	// host is a unix socket directory
+	if strings.HasPrefix(config.Host, "/") {
+		query.Set("host", config.Host)
+		query.Set("port", cast.ToString(config.Port))
+		return "", query
+	}
+	return fmt.Sprintf("%s:%d", config.Host, config.Port), query
+}
+
+// postgresSSLQuery returns the SSL parameters for a connection string
+func postgresSSLQuery(config DatabaseConfig) url.Values {
+	query := url.Values{}
+	query.Set("sslmode", config.SSLMode)
+	if config.SSLRootCert != "" {
+		query.Set("sslrootcert", config.SSLRootCert)
+	}
+	if config.SSLCert != "" {
+		query.Set("sslcert", config.SSLCert)
+	}
+	if config.SSLKey != "" {
+		query.Set("sslkey", config.SSLKey)
+	}
+	return query
+}
+
+// postgresSSLEnv returns the SSL settings as environment variables for postgres client tools
+func postgresSSLEnv(config DatabaseConfig) []string {
+	env := []string{"PGSSLMODE=" + config.SSLMode}
+	if config.SSLRootCert != "" {
+		env = append(env, "PGSSLROOTCERT="+config.SSLRootCert)
+	}
+	if config.SSLCert != "" {
+		env = append(env, "PGSSLCERT="+config.SSLCert)
+	}
+	if config.SSLKey != "" {
+		env = append(env, "PGSSLKEY="+config.SSLKey)
+	}
+	return env
+}
+
 // WaitForConnection for a maximum of duration
 func (c *PostgresConnection) WaitForConnection(duration time.Duration) error {
 	db, err := sql.Open("postgres", c.ConnectionString)
@@ -71,81 +136,579 @@ func (c *PostgresConnection) WaitForConnection(duration time.Duration) error {
 // Init database if root password is given
 func (c *PostgresConnection) Init() error {
 	if c.Config.RootPassword == "" {
-		log.Print("no root password given -> skip user and database creation")
-		return nil
+		c.Config.logger().Print("no root password given -> skip user and database creation")
+		return c.runInitScripts()
 	}
-	log.Printf("initialize database ...")
+	c.Config.logger().Printf("initialize database ...")
 
-	db, err := sql.Open("postgres", c.ConnectionString)
+	conn, err := sql.Open("postgres", c.ConnectionString)
 	if err != nil {
 		return fmt.Errorf("failed to create connection: %w", err)
 	}
-	defer db.Close()
+	defer conn.Close()
+	db := debugDB{conn, c.Config}
+
+	err = c.initDatabase(db, DatabaseUser{
+		Database: c.Config.Database,
+		Username: c.Config.Username,
+		Password: c.Config.Password,
+	})
+	if err != nil {
+		return err
+	}
+
+	// add PG extensions
+	if c.Config.PgExtensions != "" {
+		_, err = db.Exec(fmt.Sprintf("CREATE EXTENSION %s", c.Config.PgExtensions))
+		if err != nil {
+			return fmt.Errorf("failed add extensions: %w", err)
+		}
+	}
 
+	// additional databases and users
+	additional, err := c.Config.AdditionalDatabases()
+	if err != nil {
+		return err
+	}
+	for _, user := range additional {
+		err = c.initDatabase(db, user)
+		if err != nil {
+			return err
+		}
+	}
+
+	return c.runInitScripts()
+}
+
+// initDatabase creates user and database if they not exist
+func (c *PostgresConnection) initDatabase(db debugDB, user DatabaseUser) error {
 	var dummy string
+	var userExists bool
 	// create user if not exist
-	err = db.QueryRow("SELECT usename FROM pg_catalog.pg_user WHERE usename = $1", c.Config.Username).Scan(&dummy)
+	err := db.QueryRow("SELECT usename FROM pg_catalog.pg_user WHERE usename = $1", user.Username).Scan(&dummy)
 	if err != nil {
 		if err != sql.ErrNoRows {
 			return fmt.Errorf("failed to check if user exists: %w", err)
 		}
-		_, err = db.Exec(fmt.Sprintf("CREATE ROLE %s with LOGIN CREATEDB PASSWORD '%s'", c.Config.Username, c.Config.Password))
+		_, err = db.Exec(fmt.Sprintf("CREATE ROLE %s with LOGIN CREATEDB PASSWORD '%s'", user.Username, user.Password))
 		if err != nil {
 			return fmt.Errorf("failed to create user: %w", err)
 		}
-		log.Printf("> user %s created", c.Config.Username)
+		c.Config.logger().Printf("> user %s created", user.Username)
 	} else {
-		log.Printf("> user %s already exist", c.Config.Username)
+		c.Config.logger().Printf("> user %s already exist", user.Username)
+		userExists = true
 	}
 
 	// create database if not exist
-	err = db.QueryRow("SELECT datname FROM pg_catalog.pg_database WHERE datname like $1", c.Config.Database).Scan(&dummy)
+	err = db.QueryRow("SELECT datname FROM pg_catalog.pg_database WHERE datname like $1", user.Database).Scan(&dummy)
 	if err != nil {
 		if err != sql.ErrNoRows {
 			return fmt.Errorf("failed to check if database exists: %w", err)
 		}
-		_, err = db.Exec(fmt.Sprintf("create database %s OWNER %s", c.Config.Database, c.Config.Username))
+		_, err = db.Exec(fmt.Sprintf("create database %s OWNER %s", user.Database, user.Username))
 		if err != nil {
 			return fmt.Errorf("failed to create user: %w", err)
 		}
-		log.Printf("> database %s created", c.Config.Database)
+		c.Config.logger().Printf("> database %s created", user.Database)
 	} else {
-		log.Printf("> database %s already exist", c.Config.Database)
+		c.Config.logger().Printf("> database %s already exist", user.Database)
+	}
+
+	// password is checked by a login to the database (after it was created)
+	if userExists && c.Config.UpdatePassword {
+		err = c.updatePassword(db, user)
+		if err != nil {
+			return err
+		}
 	}
 
 	// ensure user has permissions in database
-	_, err = db.Exec(fmt.Sprintf("GRANT ALL PRIVILEGES ON DATABASE %s to %s", c.Config.Database, c.Config.Username))
+	_, err = db.Exec(fmt.Sprintf("GRANT ALL PRIVILEGES ON DATABASE %s to %s", user.Database, user.Username))
 	if err != nil {
 		return fmt.Errorf("failed to grant database permissions: %w", err)
 	}
 
-	// add PG extensions
-	if c.Config.PgExtensions != "" {
-		_, err = db.Exec(fmt.Sprintf("CREATE EXTENSION %s", c.Config.PgExtensions))
+	return nil
+}
+
+// updatePassword of user if the login with the configured password fails
+func (c *PostgresConnection) updatePassword(db debugDB, user DatabaseUser) error {
+	address, query := postgresAddress(c.Config)
+	userDB, err := sql.Open("postgres", fmt.Sprintf("postgres://%s:%s@%s/%s?%s",
+		url.PathEscape(user.Username), url.PathEscape(user.Password), address, user.Database, query.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to create connection: %w", err)
+	}
+	defer userDB.Close()
+
+	err = userDB.Ping()
+	if err == nil {
+		return nil
+	}
+
+	// only update password on authentication failures
+	// (a missing database is only reported after a successful authentication)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "3D000" {
+		return nil
+	}
+	if !errors.As(err, &pqErr) || pqErr.Code != "28P01" {
+		return fmt.Errorf("failed to check password of user %s: %w", user.Username, err)
+	}
+
+	_, err = db.Exec(fmt.Sprintf("ALTER ROLE %s WITH PASSWORD %s",
+		pq.QuoteIdentifier(user.Username), pq.QuoteLiteral(user.Password)))
+	if err != nil {
+		return fmt.Errorf("failed to update password of user %s: %w", user.Username, err)
+	}
+	c.Config.logger().Printf("> password of user %s updated", user.Username)
+	return nil
+}
+
+// runInitScripts executes all not yet executed SQL scripts of the init directory
+func (c *PostgresConnection) runInitScripts() error {
+	if c.Config.InitSQLDir == "" {
+		return nil
+	}
+
+	scripts, err := filepath.Glob(filepath.Join(c.Config.InitSQLDir, "*.sql"))
+	if err != nil {
+		return fmt.Errorf("failed to list init scripts: %w", err)
+	}
+	sort.Strings(scripts)
+
+	conn, err := sql.Open("postgres", c.DatabaseConnectionString)
+	if err != nil {
+		return fmt.Errorf("failed to create connection: %w", err)
+	}
+	defer conn.Close()
+	db := debugDB{conn, c.Config}
+
+	// marker table to track already executed scripts
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS housekeeper_init_scripts (
+		name text PRIMARY KEY,
+		executed_at timestamptz NOT NULL DEFAULT now())`)
+	if err != nil {
+		return fmt.Errorf("failed to create init script marker table: %w", err)
+	}
+
+	for _, script := range scripts {
+		name := filepath.Base(script)
+
+		var dummy string
+		err = db.QueryRow("SELECT name FROM housekeeper_init_scripts WHERE name = $1", name).Scan(&dummy)
+		if err == nil {
+			continue
+		}
+		if err != sql.ErrNoRows {
+			return fmt.Errorf("failed to check init script %s: %w", name, err)
+		}
+
+		content, err := os.ReadFile(script)
 		if err != nil {
-			return fmt.Errorf("failed add extensions: %w", err)
+			return fmt.Errorf("failed to read init script %s: %w", name, err)
 		}
-	}
 
+		// execute script and mark it in a single transaction
+		tx, err := db.Begin()
+		if err != nil {
+			return fmt.Errorf("failed to start transaction: %w", err)
+		}
+		c.Config.debugSQL(string(content))
+		_, err = tx.Exec(string(content))
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to execute init script %s: %w", name, err)
+		}
+		_, err = tx.Exec("INSERT INTO housekeeper_init_scripts (name) VALUES ($1)", name)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to mark init script %s: %w", name, err)
+		}
+		if err = tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit init script %s: %w", name, err)
+		}
+		c.Config.logger().Printf("> init script %s executed", name)
+	}
 	return nil
 }
 
-// Backup database to the given writer
-func (c *PostgresConnection) Backup(writer io.Writer) error {
-	cmd := exec.Command("pg_dump",
+// BackupFilename of the database dump inside the backup
+func (c *PostgresConnection) BackupFilename() string {
+	if c.Config.DumpFormat == "custom" {
+		return "database.dump"
+	}
+	return "database.sql"
+}
+
+// DumpFormat used for database dumps
+func (c *PostgresConnection) DumpFormat() string {
+	return c.Config.DumpFormat
+}
+
+// DumpContent returns schema-only or data-only for partial dumps
+func (c *PostgresConnection) DumpContent() string {
+	switch {
+	case c.Config.DumpSchemaOnly:
+		return "schema-only"
+	case c.Config.DumpDataOnly:
+		return "data-only"
+	default:
+		return ""
+	}
+}
+
+// dumpArgs for pg_dump of the given database
+func (c *PostgresConnection) dumpArgs(database string) []string {
+	var args []string
+	if c.Config.DumpFormat == "custom" {
+		// dump is compressed with gzip inside the backup
+		args = append(args, "--format=custom", "--compress=0")
+	}
+
+	// partial dumps
+	if c.Config.DumpSchemaOnly {
+		args = append(args, "--schema-only")
+	}
+	if c.Config.DumpDataOnly {
+		args = append(args, "--data-only")
+	}
+
+	// table filters only apply to the configured database,
+	// other databases of a backup of all databases are dumped completely
+	if database == c.Config.Database {
+		for _, table := range c.Config.DumpIncludeTables {
+			args = append(args, "--table="+table)
+		}
+		for _, table := range c.Config.DumpExcludeTables {
+			args = append(args, "--exclude-table="+table)
+		}
+	}
+	return append(args, database)
+}
+
+// command for a postgres client tool with connection arguments.
+// If superuser is set the root credentials are used if available.
+func (c *PostgresConnection) command(name string, superuser bool, args ...string) (*exec.Cmd, error) {
+	return c.commandContext(context.Background(), name, superuser, args...)
+}
+
+// commandContext for a postgres client tool that is killed if ctx is done
+func (c *PostgresConnection) commandContext(ctx context.Context, name string, superuser bool, args ...string) (*exec.Cmd, error) {
+	// select client tool matching the server version
+	binary, err := c.binary(name)
+	if err != nil {
+		return nil, err
+	}
+	return c.toolCommand(ctx, binary, superuser, args...), nil
+}
+
+// toolCommand for the given client tool binary with connection arguments
+func (c *PostgresConnection) toolCommand(ctx context.Context, binary string, superuser bool, args ...string) *exec.Cmd {
+	username, password := c.Config.Username, c.Config.Password
+	if superuser && c.Config.RootPassword != "" {
+		username, password = c.Config.RootUsername, c.Config.RootPassword
+	}
+
+	cmdArgs := []string{
 		"-h", c.Config.Host,
 		"-p", cast.ToString(c.Config.Port),
-		"-U", c.Config.Username,
-		c.Config.Database)
+		"-U", username,
+	}
+	cmd := exec.CommandContext(ctx, binary, append(cmdArgs, args...)...)
 
-	// set PGPASSWORD env variable
+	// set PGPASSWORD and SSL env variables
 	env := os.Environ()
-	env = append(env, "PGPASSWORD="+c.Config.Password)
+	env = append(env, "PGPASSWORD="+password)
+	env = append(env, postgresSSLEnv(c.Config)...)
 	cmd.Env = env
 
+	cmd.Stderr = os.Stderr
+	return cmd
+}
+
+// runDump of the given client tool with output redirected to writer
+// (the tool of the database container is used if run with docker exec)
+func (c *PostgresConnection) runDump(writer io.Writer, name string, superuser bool, args ...string) error {
+	var cmd *exec.Cmd
+	if c.remote() {
+		cmd = c.toolCommand(context.Background(), name, superuser, args...)
+	} else {
+		var err error
+		cmd, err = c.command(name, superuser, args...)
+		if err != nil {
+			return err
+		}
+	}
+
 	// redirect stdout to backup writer
 	cmd.Stdout = writer
-	cmd.Stderr = os.Stderr
+
+	return c.run(cmd)
+}
+
+// Backup database to the given writer
+func (c *PostgresConnection) Backup(writer io.Writer) error {
+	return c.runDump(writer, "pg_dump", false, c.dumpArgs(c.Config.Database)...)
+}
+
+// Restore database dump from the given reader
+func (c *PostgresConnection) Restore(database, format string, reader io.Reader) error {
+	if database == "" {
+		database = c.Config.Database
+	}
+
+	var cmd *exec.Cmd
+	var err error
+	if format == "custom" {
+		cmd, err = c.command("pg_restore", true, "--dbname="+database)
+	} else {
+		cmd, err = c.command("psql", true, "--quiet", "--set=ON_ERROR_STOP=1", "--dbname="+database)
+	}
+	if err != nil {
+		return err
+	}
+
+	// read dump from stdin
+	cmd.Stdin = reader
+	cmd.Stdout = os.Stderr
 
 	return cmd.Run()
 }
+
+// IsEmpty returns true if the configured database contains no user tables
+func (c *PostgresConnection) IsEmpty() (bool, error) {
+	db, err := sql.Open("postgres", c.DatabaseConnectionString)
+	if err != nil {
+		return false, fmt.Errorf("failed to create connection: %w", err)
+	}
+	defer db.Close()
+
+	var tables int
+	err = db.QueryRow("SELECT count(*) FROM information_schema.tables WHERE table_schema NOT IN ('pg_catalog', 'information_schema')").Scan(&tables)
+	if err != nil {
+		return false, fmt.Errorf("failed to count tables: %w", err)
+	}
+	return tables == 0, nil
+}
+
+// CreateDatabase owned by the configured user if it does not exist
+func (c *PostgresConnection) CreateDatabase(database string) error {
+	db, err := sql.Open("postgres", c.ConnectionString)
+	if err != nil {
+		return fmt.Errorf("failed to create connection: %w", err)
+	}
+	defer db.Close()
+
+	var dummy string
+	err = db.QueryRow("SELECT datname FROM pg_catalog.pg_database WHERE datname = $1", database).Scan(&dummy)
+	if err == nil {
+		return nil
+	}
+	if err != sql.ErrNoRows {
+		return fmt.Errorf("failed to check if database exists: %w", err)
+	}
+
+	_, err = db.Exec(fmt.Sprintf("CREATE DATABASE %s OWNER %s",
+		pq.QuoteIdentifier(database), pq.QuoteIdentifier(c.Config.Username)))
+	if err != nil {
+		return fmt.Errorf("failed to create database %s: %w", database, err)
+	}
+	c.Config.logger().Printf("-> database %s created", database)
+	return nil
+}
+
+// TerminateConnections to the given database (configured one if empty)
+func (c *PostgresConnection) TerminateConnections(database string) error {
+	if database == "" {
+		database = c.Config.Database
+	}
+
+	db, err := sql.Open("postgres", c.ConnectionString)
+	if err != nil {
+		return fmt.Errorf("failed to create connection: %w", err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec("SELECT pg_terminate_backend(pid) FROM pg_catalog.pg_stat_activity WHERE datname = $1 AND pid <> pg_backend_pid()", database)
+	if err != nil {
+		return fmt.Errorf("failed to terminate connections to %s: %w", database, err)
+	}
+	return nil
+}
+
+// RecreateDatabase drops and creates the given database (configured one if empty) with the same owner
+func (c *PostgresConnection) RecreateDatabase(database string) error {
+	if database == "" {
+		database = c.Config.Database
+	}
+
+	db, err := sql.Open("postgres", c.ConnectionString)
+	if err != nil {
+		return fmt.Errorf("failed to create connection: %w", err)
+	}
+	defer db.Close()
+
+	// keep owner of existing database
+	owner := c.Config.Username
+	err = db.QueryRow("SELECT pg_catalog.pg_get_userbyid(datdba) FROM pg_catalog.pg_database WHERE datname = $1", database).Scan(&owner)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("failed to get owner of database %s: %w", database, err)
+	}
+
+	_, err = db.Exec(fmt.Sprintf("DROP DATABASE IF EXISTS %s", pq.QuoteIdentifier(database)))
+	if err != nil {
+		return fmt.Errorf("failed to drop database %s: %w", database, err)
+	}
+
+	_, err = db.Exec(fmt.Sprintf("CREATE DATABASE %s OWNER %s", pq.QuoteIdentifier(database), pq.QuoteIdentifier(owner)))
+	if err != nil {
+		return fmt.Errorf("failed to create database %s: %w", database, err)
+	}
+	return nil
+}
+
+// Databases returns all databases of the server
+func (c *PostgresConnection) Databases() ([]string, error) {
+	db, err := sql.Open("postgres", c.ConnectionString)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create connection: %w", err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query("SELECT datname FROM pg_catalog.pg_database WHERE NOT datistemplate AND datallowconn ORDER BY datname")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list databases: %w", err)
+	}
+	defer rows.Close()
+
+	var databases []string
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to list databases: %w", err)
+		}
+		databases = append(databases, name)
+	}
+	return databases, rows.Err()
+}
+
+// BackupGlobals (roles and tablespaces) to the given writer
+func (c *PostgresConnection) BackupGlobals(writer io.Writer) error {
+	return c.runDump(writer, "pg_dumpall", true, "--globals-only")
+}
+
+// BackupDatabase with the given name to the given writer
+func (c *PostgresConnection) BackupDatabase(database string, writer io.Writer) error {
+	return c.runDump(writer, "pg_dump", true, c.dumpArgs(database)...)
+}
+
+// BackupPhysical of the database server as tar to the given writer
+func (c *PostgresConnection) BackupPhysical(writer io.Writer) error {
+	// WAL files are fetched at the end to get a self-contained backup
+	return c.runDump(writer, "pg_basebackup", true,
+		"--pgdata=-", "--format=tar", "--wal-method=fetch", "--checkpoint=fast")
+}
+
+// ReceiveWal streams WAL segments into dir until ctx is canceled
+func (c *PostgresConnection) ReceiveWal(ctx context.Context, dir string) error {
+	// replication slot ensures no segments are lost between restarts
+	cmd, err := c.commandContext(ctx, "pg_receivewal", true,
+		"--slot="+walSlot, "--create-slot", "--if-not-exists")
+	if err != nil {
+		return err
+	}
+	err = cmd.Run()
+	if err != nil {
+		return fmt.Errorf("failed to create replication slot: %w", err)
+	}
+
+	cmd, err = c.commandContext(ctx, "pg_receivewal", true,
+		"--directory="+dir, "--slot="+walSlot, "--no-loop")
+	if err != nil {
+		return err
+	}
+	return cmd.Run()
+}
+
+// DropWalSlot of WAL archiving if it exists and is not in use
+// (the server keeps all WAL segments not received for the slot)
+func (c *PostgresConnection) DropWalSlot() error {
+	db, err := sql.Open("postgres", c.ConnectionString)
+	if err != nil {
+		return fmt.Errorf("failed to create connection: %w", err)
+	}
+	defer db.Close()
+
+	result, err := db.Exec("SELECT pg_drop_replication_slot(slot_name) FROM pg_catalog.pg_replication_slots WHERE slot_name = $1 AND NOT active", walSlot)
+	if err != nil {
+		return fmt.Errorf("failed to drop replication slot %s: %w", walSlot, err)
+	}
+	if dropped, _ := result.RowsAffected(); dropped > 0 {
+		c.Config.logger().Printf("> unused replication slot %s dropped", walSlot)
+	}
+	return nil
+}
+
+// Vacuum (and analyze) the given tables or the whole database if no tables are given
+func (c *PostgresConnection) Vacuum(tables []string, verbose bool) error {
+	connector, err := pq.NewConnector(c.DatabaseConnectionString)
+	if err != nil {
+		return fmt.Errorf("failed to create connection: %w", err)
+	}
+
+	// output of VERBOSE is sent as notices
+	db := sql.OpenDB(pq.ConnectorWithNoticeHandler(connector, func(notice *pq.Error) {
+		c.Config.logger().Printf("-> %s", notice.Message)
+	}))
+	defer db.Close()
+
+	options := "ANALYZE"
+	if verbose {
+		options += ", VERBOSE"
+	}
+
+	if len(tables) == 0 {
+		_, err = db.Exec(fmt.Sprintf("VACUUM (%s)", options))
+		if err != nil {
+			return fmt.Errorf("failed to vacuum database: %w", err)
+		}
+		return nil
+	}
+
+	for _, table := range tables {
+		_, err = db.Exec(fmt.Sprintf("VACUUM (%s) %s", options, table))
+		if err != nil {
+			return fmt.Errorf("failed to vacuum table %s: %w", table, err)
+		}
+	}
+	return nil
+}
+
+// Reindex the given indexes or the whole database if no indexes are given
+func (c *PostgresConnection) Reindex(indexes []string) error {
+	db, err := sql.Open("postgres", c.DatabaseConnectionString)
+	if err != nil {
+		return fmt.Errorf("failed to create connection: %w", err)
+	}
+	defer db.Close()
+
+	if len(indexes) == 0 {
+		_, err = db.Exec(fmt.Sprintf("REINDEX DATABASE CONCURRENTLY %s", pq.QuoteIdentifier(c.Config.Database)))
+		if err != nil {
+			return fmt.Errorf("failed to reindex database: %w", err)
+		}
+		return nil
+	}
+
+	for _, index := range indexes {
+		start := time.Now()
+		_, err = db.Exec(fmt.Sprintf("REINDEX INDEX CONCURRENTLY %s", index))
+		if err != nil {
+			return fmt.Errorf("failed to reindex %s: %w", index, err)
+		}
+		c.Config.logger().Printf("-> %s (%s)", index, time.Since(start).Round(time.Millisecond))
+	}
+	return nil
+}
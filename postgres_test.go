@@ -0,0 +1,26 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPostgresDumpArgs(t *testing.T) {
+	connection := NewPostgresConnection(DatabaseConfig{
+		Database:          "app",
+		DumpIncludeTables: []string{"public.*"},
+		DumpExcludeTables: []string{"public.log"},
+	})
+	tests := []struct {
+		database string
+		expected []string
+	}{
+		{"app", []string{"--table=public.*", "--exclude-table=public.log", "app"}},
+		{"other", []string{"other"}},
+	}
+	for _, test := range tests {
+		if args := connection.dumpArgs(test.database); !reflect.DeepEqual(args, test.expected) {
+			t.Errorf("dumpArgs(%s) = %q, expected %q", test.database, args, test.expected)
+		}
+	}
+}
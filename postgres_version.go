@@ -0,0 +1,96 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// postgresClientDirs contains the version specific client tools (alpine layout)
+const postgresClientDirs = "/usr/libexec/postgresql*"
+
+var (
+	postgresClientDirRegex     = regexp.MustCompile(`postgresql(\d+)$`)
+	postgresClientVersionRegex = regexp.MustCompile(`\(PostgreSQL\) (\d+)`)
+)
+
+// ServerVersion returns the major version of the database server
+func (c *PostgresConnection) ServerVersion() (int, error) {
+	if c.serverVersion > 0 {
+		return c.serverVersion, nil
+	}
+
+	db, err := sql.Open("postgres", c.ConnectionString)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create connection: %w", err)
+	}
+	defer db.Close()
+
+	var versionNum int
+	err = db.QueryRow("SHOW server_version_num").Scan(&versionNum)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get server version: %w", err)
+	}
+
+	// e.g. 160002 -> 16
+	c.serverVersion = versionNum / 10000
+	return c.serverVersion, nil
+}
+
+// binary returns the path of the client tool matching the server version.
+// Client tools are compatible with servers of the same or an older version,
+// so the exact version is preferred, followed by the closest newer one.
+func (c *PostgresConnection) binary(name string) (string, error) {
+	serverVersion, err := c.ServerVersion()
+	if err != nil {
+		return "", err
+	}
+
+	// version specific client tools
+	dirs, _ := filepath.Glob(postgresClientDirs)
+	versions := make(map[int]string)
+	for _, dir := range dirs {
+		match := postgresClientDirRegex.FindStringSubmatch(dir)
+		if match == nil {
+			continue
+		}
+		binary := filepath.Join(dir, name)
+		if _, err := exec.LookPath(binary); err != nil {
+			continue
+		}
+		version, _ := strconv.Atoi(match[1])
+		versions[version] = binary
+	}
+
+	// default client tool in PATH
+	if binary, err := exec.LookPath(name); err == nil {
+		output, err := exec.Command(binary, "--version").Output()
+		if err == nil {
+			match := postgresClientVersionRegex.FindSubmatch(output)
+			if match != nil {
+				version, _ := strconv.Atoi(string(match[1]))
+				if _, ok := versions[version]; !ok {
+					versions[version] = binary
+				}
+			}
+		}
+	}
+
+	available := make([]int, 0, len(versions))
+	for version := range versions {
+		available = append(available, version)
+	}
+	sort.Ints(available)
+
+	for _, version := range available {
+		if version >= serverVersion {
+			return versions[version], nil
+		}
+	}
+	return "", fmt.Errorf("no %s found for postgres server version %d (available: %v)",
+		name, serverVersion, available)
+}
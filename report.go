@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// reportExtension of the report files written next to the backup files
+const reportExtension = ".report.yml"
+
+// BackupReport of a backup run written with BACKUP_REPORT
+type BackupReport struct {
+	Job      string `yaml:"job,omitempty"`
+	Filename string `yaml:"filename,omitempty"`
+	Result   string `yaml:"result"`
+	Error    string `yaml:"error,omitempty"`
+
+	Start          time.Time `yaml:"start"`
+	End            time.Time `yaml:"end"`
+	Duration       string    `yaml:"duration"`
+	UploadDuration string    `yaml:"upload_duration,omitempty"`
+
+	// Size of the backup file, RawSize and Files of the archived files and database dumps
+	Size    int64 `yaml:"size,omitempty"`
+	RawSize int64 `yaml:"raw_size,omitempty"`
+	Files   int   `yaml:"files,omitempty"`
+
+	// Mirrors the backup was copied to
+	Mirrors []MirrorStatus `yaml:"mirrors,omitempty"`
+
+	// Warnings logged while the backup was created
+	Warnings []string `yaml:"warnings,omitempty"`
+
+	// Meta data of the backup file including the checksums of all entries
+	Meta *BackupMeta `yaml:"meta,omitempty"`
+}
+
+// reportFilename of the backup file (of the start time if no backup file was created)
+func reportFilename(filename string, start time.Time) string {
+	if filename == "" {
+		return "backup_" + start.Format(time.RFC3339) + reportExtension
+	}
+	name := trimEncryptionExtension(filename)
+	return strings.TrimSuffix(name, "."+backupFormat(name)) + reportExtension
+}
+
+// warn logs the warning and adds it to the report of the running backup
+func (s *BackupService) warn(msg string, args ...any) {
+	s.logger().Warn(msg, args...)
+	if !s.running.Load() {
+		return
+	}
+
+	warning := strings.TrimLeft(msg, "-> ")
+	for i := 0; i+1 < len(args); i += 2 {
+		if args[i] == "error" {
+			warning += fmt.Sprintf(": %v", args[i+1])
+		} else {
+			warning += fmt.Sprintf(" %v=%v", args[i], args[i+1])
+		}
+	}
+
+	s.lastRunMutex.Lock()
+	defer s.lastRunMutex.Unlock()
+	s.warnings = append(s.warnings, warning)
+}
+
+// writeReport of the backup run next to the backup file
+func (s *BackupService) writeReport(run *BackupRunStatus) error {
+	duration := time.Duration(run.Duration * float64(time.Second))
+	report := BackupReport{
+		Job:      s.Name,
+		Filename: run.Filename,
+		Result:   run.Result,
+		Error:    run.Error,
+		Start:    run.Time,
+		End:      run.Time.Add(duration),
+		Duration: duration.Round(time.Millisecond).String(),
+		Size:     run.Size,
+		RawSize:  run.RawSize,
+		Files:    run.Files,
+		Mirrors:  run.Mirrors,
+	}
+	if run.UploadDuration > 0 {
+		report.UploadDuration = time.Duration(run.UploadDuration * float64(time.Second)).Round(time.Millisecond).String()
+	}
+	if s.runStats != nil {
+		report.Meta = s.runStats.meta
+	}
+	s.lastRunMutex.Lock()
+	report.Warnings = s.warnings
+	s.lastRunMutex.Unlock()
+
+	data, err := yaml.Marshal(&report)
+	if err != nil {
+		return fmt.Errorf("failed to create backup report: %w", err)
+	}
+
+	filename := reportFilename(run.Filename, run.Time)
+	file, closeFile, err := s.createFile(filename)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(data); err != nil {
+		err = fmt.Errorf("failed to write backup report %s: %w", filename, err)
+	}
+	return closeFile(err)
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReportFilename(t *testing.T) {
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		filename string
+		expected string
+	}{
+		{"", "backup_2024-01-02T03:04:05Z" + reportExtension},
+		{"backup_2024-01-01T03:00:00Z.zip", "backup_2024-01-01T03:00:00Z" + reportExtension},
+		{"backup_2024-01-01T03:00:00Z.tar.zst", "backup_2024-01-01T03:00:00Z" + reportExtension},
+		{"backup_2024-01-01T03:00:00Z.tar.gz.age", "backup_2024-01-01T03:00:00Z" + reportExtension},
+		{"backup_2024-01-01T03:00:00Z.zip.gpg", "backup_2024-01-01T03:00:00Z" + reportExtension},
+		{"backup_2024-01-01T03:00:00Z" + incrementalSuffix + ".zip",
+			"backup_2024-01-01T03:00:00Z" + incrementalSuffix + reportExtension},
+	}
+	for _, test := range tests {
+		if name := reportFilename(test.filename, start); name != test.expected {
+			t.Errorf("reportFilename(%q) = %q, expected %q", test.filename, name, test.expected)
+		}
+	}
+}
@@ -0,0 +1,426 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+
+	"github.com/spf13/cast"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// resticTag is added to all snapshots created by housekeeper
+	resticTag = "housekeeper"
+	// resticMetaTag marks the snapshot containing the backup.yml of a backup run
+	resticMetaTag = "housekeeper-meta"
+	// resticHost is used for all snapshots instead of the container hostname
+	resticHost = "housekeeper"
+)
+
+// resticSnapshot as listed by restic snapshots --json
+type resticSnapshot struct {
+	ID   string   `json:"id"`
+	Tags []string `json:"tags"`
+}
+
+// restic command for the configured repository
+func (s *BackupService) restic(args ...string) *exec.Cmd {
+	cmd := exec.Command("restic", append([]string{"--repo", s.Config.ResticRepository}, args...)...)
+	cmd.Stderr = os.Stderr
+	return cmd
+}
+
+// initRestic repository if it does not exist yet
+func (s *BackupService) initRestic() error {
+	cmd := s.restic("cat", "config")
+	cmd.Stdout, cmd.Stderr = io.Discard, io.Discard
+	if cmd.Run() == nil {
+		return nil
+	}
+
+	s.logger().Printf("> initialize restic repository")
+	if err := s.restic("init").Run(); err != nil {
+		return fmt.Errorf("failed to initialize restic repository: %w", err)
+	}
+	return nil
+}
+
+// resticBackupWriter stores every entry of a backup run as restic snapshot
+type resticBackupWriter struct {
+	service *BackupService
+	run     string
+
+	// snapshots of all written entries
+	snapshots map[string]string
+
+	// entry that is currently written
+	pending     *exec.Cmd
+	pendingName string
+	writer      *io.PipeWriter
+	output      *strings.Builder
+}
+
+// newResticBackupWriter for the given backup run
+func (s *BackupService) newResticBackupWriter(run string) (*resticBackupWriter, error) {
+	if err := s.initRestic(); err != nil {
+		return nil, err
+	}
+	return &resticBackupWriter{
+		service:   s,
+		run:       run,
+		snapshots: make(map[string]string),
+	}, nil
+}
+
+// tags of a snapshot of the backup run
+func (w *resticBackupWriter) tags(extra ...string) string {
+	return strings.Join(append([]string{resticTag, w.run}, extra...), ",")
+}
+
+// Create a snapshot with the entry content read from stdin
+func (w *resticBackupWriter) Create(name string) (io.Writer, error) {
+	if err := w.flush(); err != nil {
+		return nil, err
+	}
+
+	tags := w.tags()
+	if name == "backup.yml" {
+		tags = w.tags(resticMetaTag)
+	}
+	cmd := w.service.restic("backup", "--json", "--host", resticHost, "--tag", tags, "--stdin", "--stdin-filename", name)
+
+	reader, writer := io.Pipe()
+	cmd.Stdin = reader
+	w.output = new(strings.Builder)
+	cmd.Stdout = w.output
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start restic: %w", err)
+	}
+
+	w.pending = cmd
+	w.pendingName = name
+	w.writer = writer
+	return writer, nil
+}
+
+// AddDirectory as snapshot (filtering of files is not supported).
+// The integrity of snapshots is checked by restic itself.
+func (w *resticBackupWriter) AddDirectory(prefix, dir string, include tarFilter) (*tarDigest, error) {
+	if err := w.flush(); err != nil {
+		return nil, err
+	}
+	if include != nil {
+		return nil, errors.New("filtered directories are not supported by restic")
+	}
+
+	output := new(strings.Builder)
+	cmd := w.service.restic("backup", "--json", "--host", resticHost, "--tag", w.tags(), dir)
+	cmd.Stdout = output
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("restic backup of %s failed: %w", dir, err)
+	}
+	return nil, w.addSnapshot(prefix, output.String())
+}
+
+// flush the pending entry and wait for the snapshot
+func (w *resticBackupWriter) flush() error {
+	if w.pending == nil {
+		return nil
+	}
+	cmd, name := w.pending, w.pendingName
+	w.pending = nil
+
+	w.writer.Close()
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("restic backup of %s failed: %w", name, err)
+	}
+	return w.addSnapshot(name, w.output.String())
+}
+
+// addSnapshot of the given entry from the summary of restic backup --json
+func (w *resticBackupWriter) addSnapshot(name, output string) error {
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		var message struct {
+			MessageType string `json:"message_type"`
+			SnapshotID  string `json:"snapshot_id"`
+		}
+		if json.Unmarshal(scanner.Bytes(), &message) == nil && message.MessageType == "summary" {
+			w.snapshots[name] = message.SnapshotID
+			return nil
+		}
+	}
+	return fmt.Errorf("no snapshot created for %s", name)
+}
+
+// Snapshots of all entries written so far
+func (w *resticBackupWriter) Snapshots() (map[string]string, error) {
+	if err := w.flush(); err != nil {
+		return nil, err
+	}
+	return w.snapshots, nil
+}
+
+// Close the backup run
+func (w *resticBackupWriter) Close() error {
+	return w.flush()
+}
+
+// resticSnapshots with the given tag
+func (s *BackupService) resticSnapshots(tag string) ([]resticSnapshot, error) {
+	output, err := s.restic("snapshots", "--json", "--tag", tag).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list restic snapshots: %w", err)
+	}
+
+	var snapshots []resticSnapshot
+	if err = json.Unmarshal(output, &snapshots); err != nil {
+		return nil, fmt.Errorf("failed to list restic snapshots: %w", err)
+	}
+	return snapshots, nil
+}
+
+// resticRun returns the backup run of a snapshot
+func (snapshot resticSnapshot) resticRun() string {
+	for _, tag := range snapshot.Tags {
+		if isBackupRun(tag) {
+			return tag
+		}
+	}
+	return ""
+}
+
+// isBackupRun returns true if the tag is the name of a backup run
+func isBackupRun(tag string) bool {
+	return strings.HasPrefix(tag, "backup_") && !backupTime(tag).IsZero()
+}
+
+// latestResticBackup returns the newest backup run in the restic repository
+func (s *BackupService) latestResticBackup() (string, error) {
+	snapshots, err := s.resticSnapshots(resticMetaTag)
+	if err != nil {
+		return "", err
+	}
+
+	var runs []string
+	for _, snapshot := range snapshots {
+		if run := snapshot.resticRun(); run != "" {
+			runs = append(runs, run)
+		}
+	}
+	if len(runs) == 0 {
+		return "", errors.New("no backup found")
+	}
+	sortBackups(runs)
+	return runs[len(runs)-1], nil
+}
+
+// openResticBackup run from the restic repository
+func (s *BackupService) openResticBackup(run string) (*BackupArchive, error) {
+	snapshots, err := s.resticSnapshots(resticMetaTag + "," + run)
+	if err != nil {
+		return nil, err
+	}
+	if len(snapshots) == 0 {
+		return nil, fmt.Errorf("backup %s not found in restic repository", run)
+	}
+
+	entries := &resticBackupEntries{
+		service:   s,
+		snapshots: map[string]string{"backup.yml": snapshots[len(snapshots)-1].ID},
+	}
+	archive := &BackupArchive{
+		backupEntries: entries,
+		closer:        io.NopCloser(nil),
+	}
+
+	reader, err := archive.openFile("backup.yml")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open backup.yml: %w", err)
+	}
+	defer reader.Close()
+
+	if err = yaml.NewDecoder(reader).Decode(&archive.Meta); err != nil {
+		return nil, fmt.Errorf("failed to read backup.yml: %w", err)
+	}
+	if err = archive.Meta.migrate(); err != nil {
+		return nil, fmt.Errorf("failed to read backup.yml: %w", err)
+	}
+
+	for name, id := range archive.Meta.Snapshots {
+		entries.snapshots[name] = id
+	}
+	entries.directories = make(map[string]string)
+	for _, dir := range archive.Meta.Directories {
+		entries.directories[dir.Filename] = dir.DirectoryPath
+	}
+	return archive, nil
+}
+
+// resticBackupEntries of a backup run stored in a restic repository
+type resticBackupEntries struct {
+	service *BackupService
+
+	// snapshots by entry name
+	snapshots map[string]string
+	// directories by entry name
+	directories map[string]string
+}
+
+// Open entry from its snapshot. Directories are returned as tar stream.
+func (e *resticBackupEntries) Open(name string) (io.ReadCloser, error) {
+	id, ok := e.snapshots[name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+
+	dir, isDir := e.directories[name]
+	file := "/" + name
+	if isDir {
+		file = dir
+	}
+
+	cmd := e.service.restic("dump", "--archive", "tar", id, file)
+	reader, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start restic: %w", err)
+	}
+
+	content := io.ReadCloser(&resticDumpReader{ReadCloser: reader, cmd: cmd})
+	if isDir {
+		// dumped files contain the absolute path
+		content = stripTarPrefix(content, strings.TrimPrefix(path.Clean(dir), "/"))
+	}
+	return content, nil
+}
+
+// Size of the entry as listed by restic
+func (e *resticBackupEntries) Size(name string) int64 {
+	id, ok := e.snapshots[name]
+	if !ok {
+		return 0
+	}
+	file := "/" + name
+	if dir, isDir := e.directories[name]; isDir {
+		file = dir
+	}
+
+	output, err := e.service.restic("ls", "--json", id, file).Output()
+	if err != nil {
+		return 0
+	}
+
+	var size int64
+	scanner := bufio.NewScanner(strings.NewReader(string(output)))
+	for scanner.Scan() {
+		var node struct {
+			Type string      `json:"type"`
+			Size interface{} `json:"size"`
+		}
+		if json.Unmarshal(scanner.Bytes(), &node) == nil && node.Type == "file" {
+			size += cast.ToInt64(node.Size)
+		}
+	}
+	return size
+}
+
+// resticDumpReader waits for restic after the dump was read
+type resticDumpReader struct {
+	io.ReadCloser
+	cmd *exec.Cmd
+}
+
+// Close output and wait for restic
+func (r *resticDumpReader) Close() error {
+	r.ReadCloser.Close()
+	return r.cmd.Wait()
+}
+
+// stripTarPrefix removes the given prefix from all names of a tar stream
+func stripTarPrefix(source io.ReadCloser, prefix string) io.ReadCloser {
+	reader, writer := io.Pipe()
+	go func() {
+		defer source.Close()
+
+		tarReader := tar.NewReader(source)
+		tarWriter := tar.NewWriter(writer)
+		for {
+			header, err := tarReader.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				writer.CloseWithError(err)
+				return
+			}
+
+			name := strings.TrimPrefix(header.Name, "/")
+			switch {
+			case strings.TrimSuffix(name, "/") == prefix:
+				name = "."
+			case strings.HasPrefix(name, prefix+"/"):
+				name = strings.TrimPrefix(name, prefix+"/")
+			}
+			header.Name = name
+
+			err = tarWriter.WriteHeader(header)
+			if err == nil {
+				_, err = io.Copy(tarWriter, tarReader)
+			}
+			if err != nil {
+				writer.CloseWithError(err)
+				return
+			}
+		}
+		writer.CloseWithError(tarWriter.Close())
+	}()
+	return reader
+}
+
+// resticForget removes snapshots not covered by the retention policy
+func (s *BackupService) resticForget() error {
+	if s.Config.keepAll() {
+		return nil
+	}
+
+	// group by paths only so snapshots of recreated containers (other
+	// hostname) are not kept forever
+	args := []string{"forget", "--prune", "--tag", resticTag, "--group-by", "paths"}
+	policies := []struct {
+		flag  string
+		value int
+	}{
+		{"--keep-last", s.Config.KeepLast},
+		{"--keep-daily", s.Config.KeepDaily},
+		{"--keep-weekly", s.Config.KeepWeekly},
+		{"--keep-monthly", s.Config.KeepMonthly},
+		{"--keep-yearly", s.Config.KeepYearly},
+	}
+	for _, policy := range policies {
+		if policy.value > 0 {
+			args = append(args, policy.flag, cast.ToString(policy.value))
+		}
+	}
+	if s.Config.RetentionDays > 0 {
+		args = append(args, "--keep-within", fmt.Sprintf("%dd", s.Config.RetentionDays))
+	}
+
+	s.logger().Printf("> prune old restic snapshots")
+	cmd := s.restic(args...)
+	cmd.Stdout = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to prune restic snapshots: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,904 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"cmp"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+	"github.com/rclone/rclone/fs"
+	"gopkg.in/yaml.v3"
+)
+
+// RestoreOptions for a restore run
+type RestoreOptions struct {
+	// Job of the backup (first job if empty)
+	Job string
+	// Filename of backup to restore
+	Filename string
+	// Latest backup of local storage and rclone remote is restored
+	Latest bool
+	// Directories to restore (only these directories and no database if set)
+	Directories []string
+	// Project to restore (directories and database dump of the compose project)
+	Project string
+	// DatabaseOnly restores the database without data directories
+	DatabaseOnly bool
+	// DropDatabase before restoring the dump
+	DropDatabase bool
+	// TargetDatabase the dump is restored into (configured database if empty)
+	TargetDatabase string
+	// DryRun only lists the content that would be restored
+	DryRun bool
+	// DataDirectory of the database server for physical backups
+	DataDirectory string
+	// TargetTime of point-in-time recovery (end of archived WAL if zero)
+	TargetTime time.Time
+	// NoRestart skips the restart of containers after the restore
+	NoRestart bool
+
+	// database is restored (set by Restore)
+	database bool
+}
+
+// BackupArchive opened for restore
+type BackupArchive struct {
+	backupEntries
+	Meta BackupMeta
+
+	// decryption of individually encrypted entries
+	decryption Encryption
+
+	closer io.Closer
+	tmp    string
+}
+
+// Close archive and remove temporary files
+func (a *BackupArchive) Close() error {
+	err := a.closer.Close()
+	if a.tmp != "" {
+		os.Remove(a.tmp)
+	}
+	return err
+}
+
+// openFile of archive and decrypt individually encrypted entries
+func (a *BackupArchive) openFile(name string) (io.ReadCloser, error) {
+	if a.decryption == nil {
+		return a.Open(name)
+	}
+
+	reader, err := a.Open(name + a.decryption.Extension())
+	if err != nil {
+		return nil, err
+	}
+	decrypted, err := a.decryption.Decrypt(reader)
+	if err != nil {
+		reader.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{decrypted, reader}, nil
+}
+
+// openEntry of archive and decompress gzip entries
+func (a *BackupArchive) openEntry(name string) (io.ReadCloser, error) {
+	reader, err := a.openFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", name, err)
+	}
+
+	if !strings.HasSuffix(name, ".gz") {
+		return reader, nil
+	}
+
+	gzipReader, err := gzip.NewReader(reader)
+	if err != nil {
+		reader.Close()
+		return nil, fmt.Errorf("failed to open %s: %w", name, err)
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{gzipReader, reader}, nil
+}
+
+// trimEncryptionExtension removes the extension of encrypted backup files
+func trimEncryptionExtension(filename string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(filename, ".age"), ".gpg")
+}
+
+// backupFormat of the given backup file (empty if the format is unknown)
+func backupFormat(filename string) string {
+	name := trimEncryptionExtension(filename)
+	for _, format := range backupFormats {
+		if strings.HasSuffix(name, "."+format) {
+			return format
+		}
+	}
+	return ""
+}
+
+// isBackupFile returns true if the filename matches a backup file
+func isBackupFile(filename string) bool {
+	return strings.HasPrefix(filename, "backup_") && backupFormat(filename) != ""
+}
+
+// backupTime returns the creation time contained in the backup filename
+func backupTime(filename string) time.Time {
+	name := strings.TrimPrefix(filepath.Base(filename), "backup_")
+	name = strings.TrimSuffix(trimEncryptionExtension(name), "."+backupFormat(name))
+	name = strings.TrimSuffix(name, incrementalSuffix)
+	date, _ := time.Parse(time.RFC3339, name)
+	return date
+}
+
+// sortBackups by creation time from old to new
+func sortBackups(backups []string) {
+	sort.SliceStable(backups, func(i, j int) bool {
+		return backupTime(backups[i]).Before(backupTime(backups[j]))
+	})
+}
+
+// listLocalBackups returns all backups in local storage sorted from old to new
+func (s *BackupService) listLocalBackups() ([]string, error) {
+	entries, err := os.ReadDir(s.Config.Storage)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backups: %w", err)
+	}
+
+	var backups []string
+	for _, entry := range entries {
+		if !entry.IsDir() && isBackupFile(entry.Name()) {
+			backups = append(backups, entry.Name())
+		}
+	}
+
+	sortBackups(backups)
+	return backups, nil
+}
+
+// listRemoteBackups returns all backups on the rclone remote sorted from old to new
+func (s *BackupService) listRemoteBackups() ([]string, error) {
+	entries, err := s.RClone.List(context.Background(), "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list remote backups: %w", err)
+	}
+
+	var backups []string
+	for _, entry := range entries {
+		if _, ok := entry.(fs.Object); ok && isBackupFile(entry.Remote()) {
+			backups = append(backups, entry.Remote())
+		}
+	}
+
+	sortBackups(backups)
+	return backups, nil
+}
+
+// latestBackup of local storage and rclone remote
+func (s *BackupService) latestBackup() (string, error) {
+	if s.Config.ResticRepository != "" {
+		return s.latestResticBackup()
+	}
+
+	var backups []string
+	if _, err := os.Stat(s.Config.Storage); err == nil {
+		local, err := s.listLocalBackups()
+		if err != nil {
+			return "", err
+		}
+		// use full path to mark backups as local if a remote exists
+		for _, backup := range local {
+			backups = append(backups, s.localBackupPath(backup))
+		}
+	}
+
+	if s.RClone != nil {
+		remote, err := s.listRemoteBackups()
+		if err != nil {
+			return "", err
+		}
+		backups = append(backups, remote...)
+	}
+
+	if len(backups) == 0 {
+		return "", errors.New("no backup found")
+	}
+	sortBackups(backups)
+	return backups[len(backups)-1], nil
+}
+
+// isLocalBackup returns true if the backup is read from local file system
+func (s *BackupService) isLocalBackup(filename string) bool {
+	return s.RClone == nil || strings.ContainsRune(filename, os.PathSeparator)
+}
+
+// localBackupPath of the given backup file
+func (s *BackupService) localBackupPath(filename string) string {
+	if strings.ContainsRune(filename, os.PathSeparator) {
+		return filename
+	}
+	return filepath.Join(s.Config.Storage, filename)
+}
+
+// openSource of backup from local file system or rclone remote
+func (s *BackupService) openSource(filename string) (io.ReadCloser, error) {
+	if s.isLocalBackup(filename) {
+		file, err := os.Open(s.localBackupPath(filename))
+		if err != nil {
+			return nil, fmt.Errorf("failed to open backup %s: %w", filename, err)
+		}
+		return file, nil
+	}
+
+	ctx := context.Background()
+	object, err := s.RClone.NewObject(ctx, filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find remote backup %s: %w", filename, err)
+	}
+	reader, err := object.Open(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open remote backup %s: %w", filename, err)
+	}
+	return reader, nil
+}
+
+// openBackup archive from local storage or rclone remote and decrypt it if required
+func (s *BackupService) openBackup(filename string) (*BackupArchive, error) {
+	if s.Config.ResticRepository != "" {
+		return s.openResticBackup(filename)
+	}
+
+	archive := new(BackupArchive)
+
+	// local unencrypted backups can be opened directly, all others are
+	// streamed into a temporary file (tar backups are decompressed on access)
+	path := s.localBackupPath(filename)
+	if trimEncryptionExtension(filename) != filename || !s.isLocalBackup(filename) {
+		tmp, err := s.downloadToTemp(filename)
+		if err != nil {
+			return nil, err
+		}
+		path = tmp
+		archive.tmp = tmp
+	}
+
+	if backupFormat(filename) == "zip" {
+		zipReader, err := zip.OpenReader(path)
+		if err != nil {
+			if archive.tmp != "" {
+				os.Remove(archive.tmp)
+			}
+			return nil, fmt.Errorf("failed to open backup %s: %w", filename, err)
+		}
+		archive.backupEntries = zipBackupEntries{&zipReader.Reader}
+		archive.closer = zipReader
+	} else {
+		tarEntries, err := openTarBackupEntries(path, backupFormat(filename))
+		if err != nil {
+			os.Remove(archive.tmp)
+			return nil, fmt.Errorf("failed to open backup %s: %w", filename, err)
+		}
+		archive.backupEntries = tarEntries
+		archive.closer = tarEntries
+	}
+	// entries are encrypted individually if the meta data is encrypted
+	if reader, err := archive.Open("backup.yml"); err == nil {
+		reader.Close()
+	} else {
+		for _, extension := range []string{".age", ".gpg"} {
+			if reader, err := archive.Open("backup.yml" + extension); err == nil {
+				reader.Close()
+				archive.decryption, err = s.Config.decryption(extension, nil)
+				if err != nil {
+					archive.Close()
+					return nil, err
+				}
+				break
+			}
+		}
+	}
+
+	// read meta data
+	reader, err := archive.openFile("backup.yml")
+	if err != nil {
+		archive.Close()
+		return nil, fmt.Errorf("failed to open backup.yml: %w", err)
+	}
+	defer reader.Close()
+
+	if err = yaml.NewDecoder(reader).Decode(&archive.Meta); err != nil {
+		archive.Close()
+		return nil, fmt.Errorf("failed to read backup.yml: %w", err)
+	}
+	if err = archive.Meta.migrate(); err != nil {
+		archive.Close()
+		return nil, fmt.Errorf("failed to read backup.yml: %w", err)
+	}
+	return archive, nil
+}
+
+// openDecrypted backup from local file system or rclone remote
+// (decrypted with the configured and the given age identities if required)
+func (s *BackupService) openDecrypted(filename string, ageIdentities []age.Identity) (io.ReadCloser, error) {
+	decryption, err := s.Config.decryption(filename, ageIdentities)
+	if err != nil {
+		return nil, err
+	}
+
+	source, err := s.openSource(filename)
+	if err != nil {
+		return nil, err
+	}
+	if decryption == nil {
+		return source, nil
+	}
+
+	reader, err := decryption.Decrypt(source)
+	if err != nil {
+		source.Close()
+		return nil, fmt.Errorf("failed to decrypt backup %s: %w", filename, err)
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{reader, source}, nil
+}
+
+// downloadToTemp streams the given backup (decrypted if required) into a temporary file
+func (s *BackupService) downloadToTemp(filename string) (string, error) {
+	reader, err := s.openDecrypted(filename, nil)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	tmp, err := os.CreateTemp("", "housekeeper_restore_*."+backupFormat(filename))
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	_, err = io.Copy(tmp, reader)
+	tmp.Close()
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("failed to read backup %s: %w", filename, err)
+	}
+	return tmp.Name(), nil
+}
+
+// Restore database and data directories from a backup
+func (s *BackupService) Restore(options RestoreOptions) error {
+	filename := options.Filename
+	if options.Latest {
+		var err error
+		filename, err = s.latestBackup()
+		if err != nil {
+			return err
+		}
+	} else if filename == "" {
+		return errors.New("no backup file given (use --latest to restore the newest backup)")
+	}
+	if options.DatabaseOnly && (len(options.Directories) > 0 || options.Project != "") {
+		return errors.New("database only restore can not be combined with directories or projects")
+	}
+	s.logger().Printf("restore backup %s ...", filename)
+
+	archive, err := s.openBackup(filename)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	// directories of the project are restored with the database if it belongs to the project
+	options.database = len(options.Directories) == 0
+	if options.Project != "" {
+		dirs := archive.Meta.projectDirectories(options.Project)
+		options.database = options.database && archive.Meta.DatabaseProject == options.Project
+		if len(dirs) == 0 && !options.database {
+			return fmt.Errorf("project %s is not part of the backup", options.Project)
+		}
+		options.Directories = append(options.Directories, dirs...)
+		// project without directories contains only the database dump
+		options.DatabaseOnly = len(options.Directories) == 0
+	}
+
+	// ensure the archive is intact before anything is modified
+	if err = archive.verify(s.logger(), options.Directories); err != nil {
+		return err
+	}
+
+	// incremental backups require all previous backups of the chain
+	chain := []*BackupArchive{archive}
+	if !options.DatabaseOnly {
+		chain, err = s.openChain(filename, archive, options.Directories)
+		if err != nil {
+			return err
+		}
+		defer closeChain(chain[:len(chain)-1])
+	}
+
+	if options.DryRun {
+		return s.dryRun(archive, options)
+	}
+
+	if options.database {
+		if err = s.restoreDatabase(archive, options); err != nil {
+			return err
+		}
+	}
+
+	if !options.DatabaseOnly {
+		if err = s.restoreDirectories(chain, options.Directories); err != nil {
+			return err
+		}
+	}
+
+	if !options.NoRestart {
+		if err = s.restartContainers(options.Project); err != nil {
+			return err
+		}
+	}
+
+	s.logger().Printf("restore finished")
+	return nil
+}
+
+// labelRestoreRestart of containers set to true restarts the container after a restore
+const labelRestoreRestart = "housekeeper.restore.restart"
+
+// restartContainers configured or labeled (limited to the project if set) to be restarted after a restore
+func (s *BackupService) restartContainers(project string) error {
+	names := slices.Clone(s.Config.RestoreRestart)
+	if s.Config.DockerDiscovery {
+		containers, err := s.Docker.Containers(false, map[string][]string{"label": {labelRestoreRestart + "=true"}})
+		if err != nil {
+			return fmt.Errorf("failed to discover containers to restart: %w", err)
+		}
+		for _, container := range containers {
+			if container.Labels[labelBackupJob] != s.Name ||
+				(project != "" && container.Labels[labelComposeProject] != project) {
+				continue
+			}
+			if !slices.Contains(names, container.Name()) {
+				names = append(names, container.Name())
+			}
+		}
+	}
+
+	for _, name := range names {
+		s.logger().Printf("> restart container %s", name)
+		if err := s.Docker.RestartContainer(name); err != nil {
+			return fmt.Errorf("failed to restart container %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// AutoRestore the newest backup if enabled and the database is empty
+func (s *BackupService) AutoRestore() error {
+	if !s.Config.AutoRestore {
+		return nil
+	}
+
+	empty, ok := s.Database.(EmptyDatabaseConnection)
+	if !ok {
+		return errors.New("auto restore not supported by database type")
+	}
+	isEmpty, err := empty.IsEmpty()
+	if err != nil {
+		return err
+	}
+	if !isEmpty {
+		return nil
+	}
+
+	if _, err = s.latestBackup(); err != nil {
+		s.logger().Warn("database is empty but no backup found -> skip auto restore")
+		return nil
+	}
+
+	s.logger().Printf("database is empty -> restore newest backup")
+	return s.Restore(RestoreOptions{Latest: true})
+}
+
+func (s *BackupService) restoreDatabase(archive *BackupArchive, options RestoreOptions) error {
+	meta := archive.Meta
+	if meta.DatabaseBackup == "" && len(meta.Databases) == 0 && meta.GlobalsBackup == "" {
+		return nil
+	}
+
+	if meta.DatabaseMode == "physical" {
+		return s.restorePhysical(archive, options)
+	}
+
+	restore, ok := s.Database.(RestoreConnection)
+	if s.Database == nil || !ok {
+		return errors.New("restore not supported by database type")
+	}
+
+	if options.TargetDatabase != "" {
+		if len(meta.Databases) > 0 {
+			return errors.New("target database not supported for backups of all databases")
+		}
+		create, ok := s.Database.(CreateDatabaseConnection)
+		if !ok {
+			return errors.New("target database not supported by database type")
+		}
+		if err := create.CreateDatabase(options.TargetDatabase); err != nil {
+			return err
+		}
+	}
+
+	// globals first to ensure roles exist
+	if meta.GlobalsBackup != "" {
+		s.logger().Printf("> restore globals")
+		if err := s.restoreEntry(archive, meta.GlobalsBackup, restore, "postgres", "plain"); err != nil {
+			return err
+		}
+	}
+
+	if meta.DatabaseBackup != "" {
+		s.logger().Printf("> restore database")
+		err := s.resetDatabase(options.TargetDatabase, options.DropDatabase)
+		if err != nil {
+			return err
+		}
+		err = s.restoreEntry(archive, meta.DatabaseBackup, restore, options.TargetDatabase, meta.DatabaseFormat)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, database := range meta.Databases {
+		s.logger().Printf("> restore database %s", database.Name)
+		err := s.resetDatabase(database.Name, options.DropDatabase)
+		if err != nil {
+			return err
+		}
+		err = s.restoreEntry(archive, database.Filename, restore, database.Name, meta.DatabaseFormat)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resetDatabase terminates open connections and recreates the database if requested
+func (s *BackupService) resetDatabase(database string, drop bool) error {
+	reset, ok := s.Database.(ResetDatabaseConnection)
+	if !ok {
+		if drop {
+			return errors.New("drop of database not supported by database type")
+		}
+		return nil
+	}
+
+	err := reset.TerminateConnections(database)
+	if err != nil {
+		return err
+	}
+
+	if drop {
+		s.logger().Printf("-> recreate database")
+		return reset.RecreateDatabase(database)
+	}
+	return nil
+}
+
+// restoreEntry of archive into the given database
+func (s *BackupService) restoreEntry(archive *BackupArchive, name string, restore RestoreConnection, database, format string) error {
+	reader, err := archive.openEntry(name)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	err = restore.Restore(database, format, reader)
+	if err != nil {
+		return fmt.Errorf("failed to restore %s: %w", name, err)
+	}
+	return nil
+}
+
+// projectDirectories of the compose project in the backup
+func (m BackupMeta) projectDirectories(project string) []string {
+	var dirs []string
+	for _, dir := range m.Directories {
+		if dir.Project == project {
+			dirs = append(dirs, dir.DirectoryPath)
+		}
+	}
+	return dirs
+}
+
+// selectDirectories of the backup that should be restored (all if none given)
+func selectDirectories(meta BackupMeta, selected []string) ([]BackupMetaDirectory, error) {
+	if len(selected) == 0 {
+		return meta.Directories, nil
+	}
+
+	var dirs []BackupMetaDirectory
+	for _, path := range selected {
+		found := false
+		for _, dir := range meta.Directories {
+			if filepath.Clean(dir.DirectoryPath) == filepath.Clean(path) {
+				dirs = append(dirs, dir)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("directory %s is not part of the backup", path)
+		}
+	}
+	return dirs, nil
+}
+
+// restoreDirectories of the last backup in the chain by restoring all backups of the chain in order
+func (s *BackupService) restoreDirectories(chain []*BackupArchive, selected []string) error {
+	dirs, err := selectDirectories(chain[len(chain)-1].Meta, selected)
+	if err != nil {
+		return err
+	}
+	if len(dirs) == 0 {
+		return nil
+	}
+
+	s.logger().Printf("> restore data directories")
+	for _, dir := range dirs {
+		s.logger().Printf("-> %s", dir.DirectoryPath)
+		err = os.MkdirAll(dir.DirectoryPath, os.ModePerm)
+		if err != nil {
+			return fmt.Errorf("failed to restore %s: %w", dir.DirectoryPath, err)
+		}
+
+		for _, archive := range chain {
+			for _, archiveDir := range archive.Meta.Directories {
+				if filepath.Clean(archiveDir.DirectoryPath) != filepath.Clean(dir.DirectoryPath) {
+					continue
+				}
+				if err = restoreDirectory(archive, archiveDir); err != nil {
+					return fmt.Errorf("failed to restore %s: %w", dir.DirectoryPath, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// restoreDirectory from the given archive (removes deleted files of incremental backups)
+func restoreDirectory(archive *BackupArchive, dir BackupMetaDirectory) error {
+	if err := removeDeleted(dir.DirectoryPath, dir.Deleted); err != nil {
+		return err
+	}
+
+	reader, err := archive.openEntry(dir.Filename)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	return readTar(reader, dir.DirectoryPath)
+}
+
+// dryRun lists the content that would be restored and checks the restore targets
+func (s *BackupService) dryRun(archive *BackupArchive, options RestoreOptions) error {
+	meta := archive.Meta
+	s.logger().Printf("> backup created at %s", meta.Date.Format(time.RFC3339))
+	if meta.Host != "" {
+		s.logger().Printf("> created on host %s", meta.Host)
+	}
+	for _, key := range slices.Sorted(maps.Keys(meta.Labels)) {
+		s.logger().Printf("> label %s=%s", key, meta.Labels[key])
+	}
+	if meta.Format != "" {
+		s.logger().Printf("> format %s", meta.Format)
+	}
+	if meta.Compression != "" {
+		s.logger().Printf("> compression %s", meta.Compression)
+	}
+	if meta.Encryption != nil {
+		s.logger().Printf("> encrypted with %s (%s mode)", meta.Encryption.Type, meta.Encryption.Mode)
+	}
+	if meta.Incremental != nil {
+		s.logger().Printf("> incremental backup based on %s (full backup %s)",
+			meta.Incremental.Previous, meta.Incremental.Base)
+	}
+
+	restoreDatabase := options.database &&
+		(meta.DatabaseBackup != "" || len(meta.Databases) > 0 || meta.GlobalsBackup != "")
+	if restoreDatabase {
+		if meta.GlobalsBackup != "" {
+			s.logger().Printf("> globals %s (%s)", meta.GlobalsBackup, formatSize(archive.entrySize(meta.GlobalsBackup)))
+		}
+		if meta.DatabaseBackup != "" {
+			s.logger().Printf("> database %s (%s)", meta.DatabaseBackup, formatSize(archive.entrySize(meta.DatabaseBackup)))
+		}
+		if meta.DatabaseProject != "" {
+			s.logger().Printf("-> compose project %s service %s", meta.DatabaseProject, cmp.Or(meta.DatabaseService, "-"))
+		}
+		for _, database := range meta.Databases {
+			s.logger().Printf("> database %s from %s (%s)", database.Name, database.Filename,
+				formatSize(archive.entrySize(database.Filename)))
+		}
+
+		if meta.DatabaseMode == "physical" {
+			if options.DataDirectory == "" {
+				return errors.New("physical database backups require a target data directory (--pgdata)")
+			}
+			s.logger().Printf("-> base backup is restored to %s", options.DataDirectory)
+			return nil
+		}
+		if _, ok := s.Database.(RestoreConnection); !ok {
+			return errors.New("restore not supported by database type")
+		}
+		if err := s.Database.WaitForConnection(10 * time.Second); err != nil {
+			return fmt.Errorf("database not reachable: %w", err)
+		}
+		s.logger().Printf("-> database is reachable")
+	}
+
+	if !options.DatabaseOnly {
+		dirs, err := selectDirectories(meta, options.Directories)
+		if err != nil {
+			return err
+		}
+		for _, dir := range dirs {
+			files, size, err := archive.countTar(dir.Filename)
+			if err != nil {
+				return err
+			}
+			s.logger().Printf("> directory %s (%d files, %s)", dir.DirectoryPath, files, formatSize(size))
+			if dir.Project != "" {
+				s.logger().Printf("-> compose project %s service %s", dir.Project, cmp.Or(dir.Service, "-"))
+			}
+
+			if _, err = os.Stat(dir.DirectoryPath); err != nil {
+				s.logger().Printf("-> target does not exist and will be created")
+			}
+		}
+	}
+
+	s.logger().Printf("dry run finished")
+	return nil
+}
+
+// verify size and checksum of all entries recorded in the backup meta
+// or only of the selected directories if any are given
+func (a *BackupArchive) verify(logger Logger, selected []string) error {
+	entries := a.Meta.Entries
+	if len(entries) == 0 {
+		logger.Printf("> no checksums in backup -> skip verification")
+		return nil
+	}
+
+	var names []string
+	if len(selected) > 0 {
+		dirs, err := selectDirectories(a.Meta, selected)
+		if err != nil {
+			return err
+		}
+		for _, dir := range dirs {
+			if _, ok := entries[dir.Filename]; ok {
+				names = append(names, dir.Filename)
+			}
+		}
+	} else {
+		for name := range entries {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	// read sequential archives in archive order to decompress them only once
+	if ordered, ok := a.backupEntries.(orderedEntries); ok {
+		sort.SliceStable(names, func(i, j int) bool {
+			return ordered.Position(a.entryName(names[i])) < ordered.Position(a.entryName(names[j]))
+		})
+	}
+
+	logger.Printf("> verify checksums")
+	var corrupted []string
+	for _, name := range names {
+		expected := entries[name]
+		checksum, size, err := a.checksum(name)
+		switch {
+		case err != nil:
+			corrupted = append(corrupted, fmt.Sprintf("%s: %v", name, err))
+		case expected.Size >= 0 && size != expected.Size:
+			corrupted = append(corrupted, fmt.Sprintf("%s: size mismatch (expected %d, got %d)",
+				name, expected.Size, size))
+		case checksum != expected.SHA256:
+			corrupted = append(corrupted, fmt.Sprintf("%s: checksum mismatch (expected %s, got %s)",
+				name, expected.SHA256, checksum))
+		}
+	}
+
+	if len(corrupted) > 0 {
+		for _, entry := range corrupted {
+			logger.Error("-> " + entry)
+		}
+		return fmt.Errorf("backup is corrupted (%d of %d entries)", len(corrupted), len(names))
+	}
+	return nil
+}
+
+// checksum returns the SHA-256 and the size of the given entry
+// (digest of the member names and files for directory members)
+func (a *BackupArchive) checksum(name string) (string, int64, error) {
+	reader, err := a.openFile(name)
+	if err != nil {
+		return "", 0, err
+	}
+	defer reader.Close()
+
+	if strings.HasSuffix(name, "/") {
+		digest, err := readTarDigest(reader)
+		if err != nil {
+			return "", 0, err
+		}
+		return hex.EncodeToString(digest.hash.Sum(nil)), digest.size, nil
+	}
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, reader)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), size, nil
+}
+
+// entryName of the given entry inside the archive
+func (a *BackupArchive) entryName(name string) string {
+	if a.decryption != nil {
+		name += a.decryption.Extension()
+	}
+	return name
+}
+
+// entrySize returns the size of the given entry inside the archive
+func (a *BackupArchive) entrySize(name string) int64 {
+	return a.Size(a.entryName(name))
+}
+
+// countTar returns the number and total size of files in a tar entry
+func (a *BackupArchive) countTar(name string) (int, int64, error) {
+	reader, err := a.openEntry(name)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer reader.Close()
+
+	var files int
+	var size int64
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return files, size, nil
+		}
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		if header.Typeflag == tar.TypeReg {
+			files++
+			size += header.Size
+		}
+	}
+}
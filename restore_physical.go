@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+)
+
+// restoreWalDir inside the data directory that contains the WAL segments for recovery
+const restoreWalDir = "housekeeper_wal"
+
+// restorePhysical lays down the base backup into the data directory and
+// prepares the recovery configuration to replay the archived WAL segments
+func (s *BackupService) restorePhysical(archive *BackupArchive, options RestoreOptions) error {
+	pgdata := options.DataDirectory
+	if pgdata == "" {
+		return errors.New("physical database backups require a target data directory (--pgdata)")
+	}
+
+	// never overwrite an existing database cluster
+	entries, err := os.ReadDir(pgdata)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read data directory %s: %w", pgdata, err)
+	}
+	if len(entries) > 0 {
+		return fmt.Errorf("data directory %s is not empty", pgdata)
+	}
+
+	s.logger().Printf("> restore base backup to %s", pgdata)
+	reader, err := archive.openEntry(archive.Meta.DatabaseBackup)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(pgdata, 0700)
+	if err == nil {
+		err = readTar(reader, pgdata)
+	}
+	reader.Close()
+	if err != nil {
+		return fmt.Errorf("failed to restore base backup: %w", err)
+	}
+
+	// postgres refuses to start with a group or world accessible data directory
+	err = os.Chmod(pgdata, 0700)
+	if err != nil {
+		return fmt.Errorf("failed to set permissions of %s: %w", pgdata, err)
+	}
+
+	s.logger().Printf("> copy archived WAL segments")
+	walDir := filepath.Join(pgdata, restoreWalDir)
+	err = os.MkdirAll(walDir, 0700)
+	if err != nil {
+		return fmt.Errorf("failed to create WAL dir %s: %w", walDir, err)
+	}
+	if err = s.copyLocalWal(walDir); err != nil {
+		return err
+	}
+	if err = s.downloadRemoteWal(walDir); err != nil {
+		return err
+	}
+
+	s.logger().Printf("> write recovery configuration")
+	err = writeRecoveryConfig(pgdata, options.TargetTime)
+	if err != nil {
+		return err
+	}
+	return chownDataDirectory(pgdata)
+}
+
+// chownDataDirectory to the owner of the restored cluster (files created here are owned by root)
+func chownDataDirectory(pgdata string) error {
+	info, err := os.Stat(filepath.Join(pgdata, "PG_VERSION"))
+	if err != nil {
+		return fmt.Errorf("failed to read PG_VERSION: %w", err)
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+
+	return filepath.Walk(pgdata, func(file string, _ os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		// best effort as the restore may not run as root
+		_ = os.Lchown(file, int(stat.Uid), int(stat.Gid))
+		return nil
+	})
+}
+
+// walDirectory of archived WAL segments in the local storage
+func (s *BackupService) walDirectory() string {
+	return filepath.Join(s.Config.Storage, "wal")
+}
+
+// copyLocalWal segments of the local storage into dir
+func (s *BackupService) copyLocalWal(dir string) error {
+	entries, err := os.ReadDir(s.walDirectory())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to list WAL segments: %w", err)
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		file, err := os.Open(filepath.Join(s.walDirectory(), entry.Name()))
+		if err != nil {
+			return fmt.Errorf("failed to open WAL segment %s: %w", entry.Name(), err)
+		}
+		err = writeWalSegment(dir, entry.Name(), file)
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// downloadRemoteWal segments of the rclone remote into dir
+func (s *BackupService) downloadRemoteWal(dir string) error {
+	if s.RClone == nil {
+		return nil
+	}
+
+	ctx := context.Background()
+	entries, err := s.RClone.List(ctx, "wal")
+	if err == fs.ErrorDirNotFound {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to list remote WAL segments: %w", err)
+	}
+
+	for _, entry := range entries {
+		object, ok := entry.(fs.Object)
+		if !ok {
+			continue
+		}
+		name := path.Base(object.Remote())
+		if _, err = os.Stat(filepath.Join(dir, name)); err == nil {
+			continue
+		}
+
+		reader, err := object.Open(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to open remote WAL segment %s: %w", name, err)
+		}
+		err = writeWalSegment(dir, name, reader)
+		reader.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeWalSegment into dir. Partial segments are stored with their final
+// name if no completed segment exists to also replay the newest changes.
+func writeWalSegment(dir, name string, reader io.Reader) error {
+	if strings.HasSuffix(name, ".partial") {
+		name = strings.TrimSuffix(name, ".partial")
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			return nil
+		}
+	}
+
+	file, err := os.OpenFile(filepath.Join(dir, name), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create WAL segment %s: %w", name, err)
+	}
+	_, err = io.Copy(file, reader)
+	file.Close()
+	if err != nil {
+		return fmt.Errorf("failed to write WAL segment %s: %w", name, err)
+	}
+	return nil
+}
+
+// writeRecoveryConfig to replay the WAL segments up to the target time (end of WAL if zero)
+func writeRecoveryConfig(pgdata string, target time.Time) error {
+	settings := []string{
+		fmt.Sprintf("restore_command = 'cp %s/%%f \"%%p\"'", restoreWalDir),
+	}
+	if !target.IsZero() {
+		settings = append(settings,
+			fmt.Sprintf("recovery_target_time = '%s'", target.Format("2006-01-02 15:04:05.999999-07:00")),
+			"recovery_target_action = 'promote'")
+	}
+	content := "\n# point-in-time recovery (housekeeper)\n" + strings.Join(settings, "\n") + "\n"
+
+	versionData, err := os.ReadFile(filepath.Join(pgdata, "PG_VERSION"))
+	if err != nil {
+		return fmt.Errorf("failed to read PG_VERSION: %w", err)
+	}
+	version, _ := strconv.ParseFloat(strings.TrimSpace(string(versionData)), 64)
+
+	// postgres < 12 uses a separate recovery.conf
+	if version < 12 {
+		return os.WriteFile(filepath.Join(pgdata, "recovery.conf"), []byte(content), 0600)
+	}
+
+	file, err := os.OpenFile(filepath.Join(pgdata, "postgresql.auto.conf"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open postgresql.auto.conf: %w", err)
+	}
+	_, err = file.WriteString(content)
+	file.Close()
+	if err != nil {
+		return fmt.Errorf("failed to write postgresql.auto.conf: %w", err)
+	}
+
+	return os.WriteFile(filepath.Join(pgdata, "recovery.signal"), nil, 0600)
+}
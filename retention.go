@@ -0,0 +1,430 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+)
+
+// lastSuccessfulFile in the storage directory contains the name of the last successful backup
+const lastSuccessfulFile = ".last_successful_backup"
+
+// LocalBackup in the storage directory
+type LocalBackup struct {
+	// Filename of the backup
+	Filename string
+	// Date of backup creation (from the filename)
+	Date time.Time
+	// Size of the backup file
+	Size int64
+}
+
+// IsRetentionEnabled returns true if any retention policy is configured
+func (s *BackupService) IsRetentionEnabled() bool {
+	return !s.Config.keepAll() || s.Config.StorageMaxSize != ""
+}
+
+// Prune local backups that are not covered by the retention policy
+// and archived WAL segments older than the oldest backup
+func (s *BackupService) Prune() error {
+	if !s.IsRetentionEnabled() && !s.Config.WalArchive {
+		return nil
+	}
+	if s.lastBackupFailed() {
+		s.logger().Warn("> last backup failed -> skip pruning")
+		return nil
+	}
+
+	if s.IsRetentionEnabled() {
+		var err error
+		if s.Config.ResticRepository != "" {
+			err = s.resticForget()
+		} else {
+			err = s.pruneBackups()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return s.pruneWal()
+}
+
+// pruneBackups of the local storage that are not covered by the retention policy
+func (s *BackupService) pruneBackups() error {
+	backups, err := s.localBackupsWithDate()
+	if err != nil {
+		return err
+	}
+
+	remove, err := s.selectPrune(backups)
+	if err != nil {
+		return err
+	}
+	if len(remove) == 0 {
+		return nil
+	}
+
+	s.logger().Printf("> prune old backups")
+	for _, backup := range remove {
+		err = os.Remove(filepath.Join(s.Config.Storage, backup.Filename))
+		if err != nil {
+			return fmt.Errorf("failed to remove backup %s: %w", backup.Filename, err)
+		}
+		// parity data and report are removed together with the backup
+		err = os.Remove(filepath.Join(s.Config.Storage, backup.Filename+parityExtension))
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove parity of backup %s: %w", backup.Filename, err)
+		}
+		err = os.Remove(filepath.Join(s.Config.Storage, reportFilename(backup.Filename, time.Time{})))
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove report of backup %s: %w", backup.Filename, err)
+		}
+		s.logger().Printf("-> removed %s", backup.Filename)
+	}
+	return nil
+}
+
+// pruneWal segments that were completed before the oldest backup was started
+// (they are not required to replay the WAL of any base backup)
+func (s *BackupService) pruneWal() error {
+	if !s.Config.WalArchive || s.Config.ResticRepository != "" {
+		return nil
+	}
+
+	list := s.listLocalBackups
+	if s.RClone != nil {
+		list = s.listRemoteBackups
+	}
+	backups, err := list()
+	if err != nil {
+		return err
+	}
+	var oldest time.Time
+	for _, backup := range backups {
+		if date := backupTime(backup); !date.IsZero() && (oldest.IsZero() || date.Before(oldest)) {
+			oldest = date
+		}
+	}
+	if oldest.IsZero() {
+		return nil
+	}
+
+	removed, err := pruneLocalWal(s.walDirectory(), oldest)
+	if err != nil {
+		return err
+	}
+	if s.RClone != nil {
+		remoteRemoved, err := s.pruneRemoteWal(oldest)
+		if err != nil {
+			return err
+		}
+		removed += remoteRemoved
+	}
+	if removed > 0 {
+		s.logger().Printf("> pruned %d WAL segments older than %s", removed, oldest.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// pruneLocalWal segments in dir completed before the given time
+func pruneLocalWal(dir string, before time.Time) (int, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to list WAL segments: %w", err)
+	}
+
+	var removed int
+	for _, entry := range entries {
+		// segments that are still written have a .partial suffix
+		if entry.IsDir() || strings.HasSuffix(entry.Name(), ".partial") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || !info.ModTime().Before(before) {
+			continue
+		}
+		if err = os.Remove(filepath.Join(dir, entry.Name())); err != nil {
+			return removed, fmt.Errorf("failed to remove WAL segment %s: %w", entry.Name(), err)
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// pruneRemoteWal segments on the rclone remote completed before the given time
+func (s *BackupService) pruneRemoteWal(before time.Time) (int, error) {
+	ctx := context.Background()
+	entries, err := s.RClone.List(ctx, "wal")
+	if err == fs.ErrorDirNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to list remote WAL segments: %w", err)
+	}
+
+	var removed int
+	for _, entry := range entries {
+		object, ok := entry.(fs.Object)
+		if !ok || strings.HasSuffix(object.Remote(), ".partial") || !object.ModTime(ctx).Before(before) {
+			continue
+		}
+		if err = object.Remove(ctx); err != nil {
+			return removed, fmt.Errorf("failed to remove remote WAL segment %s: %w", object.Remote(), err)
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// lastBackupFailed returns true if the last backup run in the history failed
+// and no successful backup was created since
+func (s *BackupService) lastBackupFailed() bool {
+	history, err := s.loadHistory()
+	if err != nil {
+		// prune nothing if the state is unknown
+		s.warn("> failed to load backup history", "error", err)
+		return true
+	}
+	if len(history) == 0 {
+		return false
+	}
+	last := history[len(history)-1]
+	return last.Result == "failed" && !s.loadLastRun().After(last.Time)
+}
+
+// markSuccessful verifies a new local backup and stores it as last successful backup
+func (s *BackupService) markSuccessful(filename string) error {
+	// backups are not written to local storage if rclone or restic is used
+	if s.RClone != nil || s.Config.ResticRepository != "" {
+		return nil
+	}
+
+	if s.Config.canDecrypt() {
+		// check size and checksum of all entries
+		archive, err := s.openBackup(filename)
+		if err != nil {
+			return fmt.Errorf("failed to verify backup %s: %w", filename, err)
+		}
+		err = archive.verify(s.logger(), nil)
+		archive.Close()
+		if err != nil {
+			return fmt.Errorf("failed to verify backup %s: %w", filename, err)
+		}
+	} else if err := s.checkBackupStructure(filename); err != nil {
+		return err
+	}
+
+	err := os.WriteFile(filepath.Join(s.Config.Storage, lastSuccessfulFile), []byte(filename), 0644)
+	if err != nil {
+		return fmt.Errorf("failed to store last successful backup: %w", err)
+	}
+	return nil
+}
+
+// checkBackupStructure of encrypted backups that can not be decrypted without user interaction
+func (s *BackupService) checkBackupStructure(filename string) error {
+	s.logger().Debug("> backup can not be decrypted -> only check structure")
+
+	path := filepath.Join(s.Config.Storage, filename)
+	if !strings.HasSuffix(filename, ".zip") {
+		info, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("failed to verify backup %s: %w", filename, err)
+		}
+		if info.Size() == 0 {
+			return fmt.Errorf("backup %s is empty", filename)
+		}
+		return nil
+	}
+
+	reader, err := zip.OpenReader(path)
+	if err != nil {
+		return fmt.Errorf("failed to verify backup %s: %w", filename, err)
+	}
+	defer reader.Close()
+	// meta data of individually encrypted entries
+	_, err = reader.Open("backup.yml.age")
+	if err != nil {
+		_, err = reader.Open("backup.yml.gpg")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to verify backup %s: %w", filename, err)
+	}
+	return nil
+}
+
+// lastSuccessfulIndex returns the index of the last successful backup (newest backup if unknown)
+func (s *BackupService) lastSuccessfulIndex(backups []LocalBackup) int {
+	data, err := os.ReadFile(filepath.Join(s.Config.Storage, lastSuccessfulFile))
+	if err == nil {
+		name := strings.TrimSpace(string(data))
+		for i, backup := range backups {
+			if backup.Filename == name {
+				return i
+			}
+		}
+	}
+	return len(backups) - 1
+}
+
+// localBackupsWithDate returns all local backups with a valid date sorted from old to new
+func (s *BackupService) localBackupsWithDate() ([]LocalBackup, error) {
+	filenames, err := s.listLocalBackups()
+	if err != nil {
+		return nil, err
+	}
+
+	backups := make([]LocalBackup, 0, len(filenames))
+	for _, filename := range filenames {
+		date := backupTime(filename)
+		// never touch files with an unknown date
+		if date.IsZero() {
+			s.logger().Printf("> skip pruning of %s (invalid date)", filename)
+			continue
+		}
+		info, err := os.Stat(filepath.Join(s.Config.Storage, filename))
+		if err != nil {
+			return nil, fmt.Errorf("failed to get size of backup %s: %w", filename, err)
+		}
+		size := info.Size()
+		if parity, err := os.Stat(filepath.Join(s.Config.Storage, filename+parityExtension)); err == nil {
+			size += parity.Size()
+		}
+		backups = append(backups, LocalBackup{
+			Filename: filename,
+			Date:     date,
+			Size:     size,
+		})
+	}
+	return backups, nil
+}
+
+// selectPrune returns the backups (sorted from old to new) that should be removed.
+// A backup is kept if any of the configured policies keeps it.
+func (s *BackupService) selectPrune(backups []LocalBackup) ([]LocalBackup, error) {
+	keep := make([]bool, len(backups))
+	if !s.Config.keepAll() {
+		s.keepByPolicies(backups, keep)
+	} else {
+		for i := range keep {
+			keep[i] = true
+		}
+	}
+
+	// the last successful backup is never removed
+	protected := s.lastSuccessfulIndex(backups)
+	if protected >= 0 {
+		keep[protected] = true
+	}
+
+	if err := s.limitSize(backups, keep, protected); err != nil {
+		return nil, err
+	}
+	keepChains(backups, keep)
+
+	var remove []LocalBackup
+	for i, backup := range backups {
+		if !keep[i] {
+			remove = append(remove, backup)
+		}
+	}
+	return remove, nil
+}
+
+// keepByPolicies marks the backups that are kept by the count and time based policies
+func (s *BackupService) keepByPolicies(backups []LocalBackup, keep []bool) {
+	// newest backups
+	for i := len(backups) - 1; i >= 0 && i >= len(backups)-s.Config.KeepLast; i-- {
+		keep[i] = true
+	}
+
+	// backups younger than the retention
+	if s.Config.RetentionDays > 0 {
+		limit := time.Now().AddDate(0, 0, -s.Config.RetentionDays)
+		for i, backup := range backups {
+			if backup.Date.After(limit) {
+				keep[i] = true
+			}
+		}
+	}
+
+	// grandfather-father-son
+	keepPeriods(backups, keep, s.Config.KeepDaily, func(date time.Time) string {
+		return date.Format("2006-01-02")
+	})
+	keepPeriods(backups, keep, s.Config.KeepWeekly, func(date time.Time) string {
+		year, week := date.ISOWeek()
+		return fmt.Sprintf("%d-%d", year, week)
+	})
+	keepPeriods(backups, keep, s.Config.KeepMonthly, func(date time.Time) string {
+		return date.Format("2006-01")
+	})
+	keepPeriods(backups, keep, s.Config.KeepYearly, func(date time.Time) string {
+		return date.Format("2006")
+	})
+}
+
+// limitSize removes the oldest kept backups until the total size is below
+// the configured maximum. The newest and the protected backup are never removed.
+func (s *BackupService) limitSize(backups []LocalBackup, keep []bool, protected int) error {
+	if s.Config.StorageMaxSize == "" {
+		return nil
+	}
+	maxSize, err := parseSize(s.Config.StorageMaxSize)
+	if err != nil {
+		return err
+	}
+
+	var total int64
+	for i, backup := range backups {
+		if keep[i] {
+			total += backup.Size
+		}
+	}
+
+	for i := 0; i < len(backups)-1 && total > maxSize; i++ {
+		if keep[i] && i != protected {
+			keep[i] = false
+			total -= backups[i].Size
+		}
+	}
+	return nil
+}
+
+// keepPeriods marks the newest backup of each of the last count periods to keep
+func keepPeriods(backups []LocalBackup, keep []bool, count int, period func(date time.Time) string) {
+	var last string
+	for i := len(backups) - 1; i >= 0 && count > 0; i-- {
+		current := period(backups[i].Date.Local())
+		if current != last {
+			keep[i] = true
+			last = current
+			count--
+		}
+	}
+}
+
+// keepChains marks all backups required by kept incremental backups
+// (previous backups back to the full backup)
+func keepChains(backups []LocalBackup, keep []bool) {
+	for i := len(backups) - 1; i >= 0; i-- {
+		if !keep[i] || !isIncrementalBackup(backups[i].Filename) {
+			continue
+		}
+		for j := i - 1; j >= 0; j-- {
+			keep[j] = true
+			if !isIncrementalBackup(backups[j].Filename) {
+				break
+			}
+		}
+	}
+}
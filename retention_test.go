@@ -0,0 +1,230 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLastBackupFailed(t *testing.T) {
+	start := time.Date(2024, 1, 1, 3, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		history  []BackupRunStatus
+		lastRun  time.Time
+		expected bool
+	}{
+		{"no history", nil, time.Time{}, false},
+		{"success", []BackupRunStatus{{Time: start, Result: "success"}}, start, false},
+		{"failed", []BackupRunStatus{{Time: start, Result: "success"}, {Time: start.Add(time.Hour), Result: "failed"}},
+			start, true},
+		{"failed without successful backup", []BackupRunStatus{{Time: start, Result: "failed"}}, time.Time{}, true},
+		{"successful backup after failure", []BackupRunStatus{{Time: start, Result: "failed"}},
+			start.Add(time.Hour), false},
+	}
+	for _, test := range tests {
+		s := &BackupService{Config: BackupConfig{Storage: t.TempDir()}}
+		if test.history != nil {
+			data, err := json.Marshal(test.history)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = os.WriteFile(filepath.Join(s.Config.Storage, backupHistoryFile), data, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if !test.lastRun.IsZero() {
+			if err := s.saveLastRun(test.lastRun); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if failed := s.lastBackupFailed(); failed != test.expected {
+			t.Errorf("%s: lastBackupFailed() = %v, expected %v", test.name, failed, test.expected)
+		}
+	}
+}
+
+func TestSelectPrune(t *testing.T) {
+	// daily backups with 100 bytes each, incremental if the name contains "i"
+	backups := func(names ...string) []LocalBackup {
+		list := make([]LocalBackup, len(names))
+		for i, name := range names {
+			filename := "backup_" + name + ".zip"
+			if name[0] == 'i' {
+				filename = "backup_" + name[1:] + incrementalSuffix + ".zip"
+			}
+			list[i] = LocalBackup{
+				Filename: filename,
+				Date:     time.Date(2024, 1, i+1, 3, 0, 0, 0, time.Local),
+				Size:     100,
+			}
+		}
+		return list
+	}
+	tests := []struct {
+		name           string
+		config         BackupConfig
+		backups        []LocalBackup
+		lastSuccessful string
+		expected       []string
+	}{
+		{"keep all", BackupConfig{}, backups("1", "2", "3"), "", nil},
+		{"keep last", BackupConfig{KeepLast: 2}, backups("1", "2", "3", "4"), "",
+			[]string{"backup_1.zip", "backup_2.zip"}},
+		{"keep last successful", BackupConfig{KeepLast: 1}, backups("1", "2", "3"), "backup_2.zip",
+			[]string{"backup_1.zip"}},
+		{"max size", BackupConfig{StorageMaxSize: "250"}, backups("1", "2", "3", "4"), "",
+			[]string{"backup_1.zip", "backup_2.zip"}},
+		{"max size keeps last successful", BackupConfig{StorageMaxSize: "150"}, backups("1", "2", "3"), "backup_1.zip",
+			[]string{"backup_2.zip"}},
+		{"max size keeps newest", BackupConfig{StorageMaxSize: "50"}, backups("1", "2"), "",
+			[]string{"backup_1.zip"}},
+		{"incremental chain", BackupConfig{KeepLast: 1}, backups("1", "2", "i3", "i4"), "",
+			[]string{"backup_1.zip"}},
+		{"complete chain", BackupConfig{KeepLast: 2}, backups("1", "i2", "3", "i4"), "",
+			[]string{"backup_1.zip", "backup_2" + incrementalSuffix + ".zip"}},
+	}
+	for _, test := range tests {
+		s := &BackupService{Config: test.config}
+		s.Config.Storage = t.TempDir()
+		if test.lastSuccessful != "" {
+			err := os.WriteFile(filepath.Join(s.Config.Storage, lastSuccessfulFile), []byte(test.lastSuccessful), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		remove, err := s.selectPrune(test.backups)
+		if err != nil {
+			t.Fatalf("%s: selectPrune failed: %v", test.name, err)
+		}
+		var removed []string
+		for _, backup := range remove {
+			removed = append(removed, backup.Filename)
+		}
+		if !reflect.DeepEqual(removed, test.expected) {
+			t.Errorf("%s: selectPrune() removed %q, expected %q", test.name, removed, test.expected)
+		}
+	}
+}
+
+func TestKeepPeriods(t *testing.T) {
+	daily := func(date time.Time) string {
+		return date.Format("2006-01-02")
+	}
+	monthly := func(date time.Time) string {
+		return date.Format("2006-01")
+	}
+	date := func(month, day, hour int) time.Time {
+		return time.Date(2024, time.Month(month), day, hour, 0, 0, 0, time.Local)
+	}
+	tests := []struct {
+		name     string
+		dates    []time.Time
+		count    int
+		period   func(date time.Time) string
+		expected []bool
+	}{
+		{"none", []time.Time{date(1, 1, 3), date(1, 2, 3)}, 0, daily, []bool{false, false}},
+		{"newest of each day", []time.Time{date(1, 1, 3), date(1, 1, 15), date(1, 2, 3), date(1, 2, 15)}, 2, daily,
+			[]bool{false, true, false, true}},
+		{"last days", []time.Time{date(1, 1, 3), date(1, 2, 3), date(1, 3, 3)}, 2, daily,
+			[]bool{false, true, true}},
+		{"missing days", []time.Time{date(1, 1, 3), date(1, 5, 3), date(1, 9, 3)}, 2, daily,
+			[]bool{false, true, true}},
+		{"more periods than backups", []time.Time{date(1, 1, 3), date(1, 2, 3)}, 7, daily, []bool{true, true}},
+		{"newest of each month", []time.Time{date(1, 1, 3), date(1, 31, 3), date(2, 1, 3), date(3, 1, 3)}, 12, monthly,
+			[]bool{false, true, true, true}},
+	}
+	for _, test := range tests {
+		backups := make([]LocalBackup, len(test.dates))
+		for i, date := range test.dates {
+			backups[i] = LocalBackup{Date: date}
+		}
+		keep := make([]bool, len(backups))
+		keepPeriods(backups, keep, test.count, test.period)
+		if !reflect.DeepEqual(keep, test.expected) {
+			t.Errorf("%s: keepPeriods() = %v, expected %v", test.name, keep, test.expected)
+		}
+	}
+}
+
+func TestLimitSize(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxSize   string
+		sizes     []int64
+		keep      []bool
+		protected int
+		expected  []bool
+	}{
+		{"disabled", "", []int64{100, 100}, []bool{true, true}, 1, []bool{true, true}},
+		{"below limit", "300", []int64{100, 100, 100}, []bool{true, true, true}, 2, []bool{true, true, true}},
+		{"oldest removed", "250", []int64{100, 100, 100, 100}, []bool{true, true, true, true}, 3,
+			[]bool{false, false, true, true}},
+		{"removed backups not counted", "200", []int64{100, 100, 100}, []bool{false, true, true}, 2,
+			[]bool{false, true, true}},
+		{"protected kept", "200", []int64{100, 100, 100}, []bool{true, true, true}, 0,
+			[]bool{true, false, true}},
+		{"newest kept", "1K", []int64{1000, 2000}, []bool{true, true}, 1, []bool{false, true}},
+	}
+	for _, test := range tests {
+		s := &BackupService{Config: BackupConfig{StorageMaxSize: test.maxSize}}
+		backups := make([]LocalBackup, len(test.sizes))
+		for i, size := range test.sizes {
+			backups[i] = LocalBackup{Size: size}
+		}
+		keep := append([]bool{}, test.keep...)
+		if err := s.limitSize(backups, keep, test.protected); err != nil {
+			t.Fatalf("%s: limitSize failed: %v", test.name, err)
+		}
+		if !reflect.DeepEqual(keep, test.expected) {
+			t.Errorf("%s: limitSize() = %v, expected %v", test.name, keep, test.expected)
+		}
+	}
+
+	s := &BackupService{Config: BackupConfig{StorageMaxSize: "10X"}}
+	if err := s.limitSize([]LocalBackup{{Size: 1}}, []bool{true}, 0); err == nil {
+		t.Error("limitSize with invalid max size succeeded")
+	}
+}
+
+func TestPruneLocalWal(t *testing.T) {
+	dir := t.TempDir()
+	before := time.Date(2024, 1, 2, 3, 0, 0, 0, time.UTC)
+	segments := map[string]time.Time{
+		"000000010000000000000001":         before.Add(-time.Hour),
+		"000000010000000000000002":         before.Add(time.Minute),
+		"000000010000000000000003.partial": before.Add(-time.Hour),
+	}
+	for name, modTime := range segments {
+		file := filepath.Join(dir, name)
+		if err := os.WriteFile(file, nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(file, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	removed, err := pruneLocalWal(dir, before)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 1 {
+		t.Errorf("pruneLocalWal() removed %d segments, expected 1", removed)
+	}
+	for name := range segments {
+		_, err := os.Stat(filepath.Join(dir, name))
+		if exists := err == nil; exists != (name != "000000010000000000000001") {
+			t.Errorf("segment %s exists = %v", name, exists)
+		}
+	}
+
+	if removed, err = pruneLocalWal(filepath.Join(dir, "missing"), before); err != nil || removed != 0 {
+		t.Errorf("pruneLocalWal() of missing directory = %d, %v", removed, err)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// cronParser of schedules with an optional seconds field in front of the standard 5 fields
+var cronParser = cron.NewParser(cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// parseSchedule with the cron parser (nil if no schedule is given)
+func parseSchedule(schedule string) (cron.Schedule, error) {
+	if schedule == "" {
+		return nil, nil
+	}
+	return cronParser.Parse(schedule)
+}
+
+// lastRunFile in the storage directory contains the time of the last successful scheduled or manual backup
+const lastRunFile = ".last_run"
+
+// scheduledBackup runs a backup from the schedule
+func (s *BackupService) scheduledBackup() {
+	s.logger().Debug("scheduled backup triggered")
+	if s.blackout.skip(strings.ToLower(s.title()), s.scheduledBackup) {
+		return
+	}
+
+	err := s.backup(s.Config.Retries)
+	if errors.Is(err, errBackupRunning) {
+		return
+	}
+	if err != nil {
+		s.logger().Error("backup failed", "error", err)
+	}
+	s.logger().Printf("[Next %s: %s]", s.title(), s.nextRun())
+}
+
+// nextRun of the backup over all schedules (zero if not scheduled)
+func (s *BackupService) nextRun() time.Time {
+	if s.Cron == nil {
+		return time.Time{}
+	}
+	s.labelSchedulesMutex.Lock()
+	entries := slices.Collect(maps.Values(s.labelSchedules))
+	s.labelSchedulesMutex.Unlock()
+	if s.CronEntry != 0 {
+		entries = append(entries, s.CronEntry)
+	}
+
+	var next time.Time
+	for _, entry := range entries {
+		if run := s.Cron.Entry(entry).Next; next.IsZero() || (!run.IsZero() && run.Before(next)) {
+			next = run
+		}
+	}
+	return next
+}
+
+// loadLastRun time of the last successful backup (zero if unknown)
+func (s *BackupService) loadLastRun() time.Time {
+	data, err := os.ReadFile(filepath.Join(s.Config.Storage, lastRunFile))
+	if err != nil {
+		return time.Time{}
+	}
+	lastRun, _ := time.Parse(time.RFC3339, strings.TrimSpace(string(data)))
+	return lastRun
+}
+
+// saveLastRun time of a successful backup
+func (s *BackupService) saveLastRun(lastRun time.Time) error {
+	err := os.WriteFile(filepath.Join(s.Config.Storage, lastRunFile), []byte(lastRun.Format(time.RFC3339)), 0644)
+	if err != nil {
+		return fmt.Errorf("failed to store last backup run: %w", err)
+	}
+	return nil
+}
+
+// catchUp starts a backup if a scheduled run was missed since the last successful backup
+// (e.g. the host was powered off at the scheduled time)
+func (s *BackupService) catchUp() {
+	lastRun := s.loadLastRun()
+	if lastRun.IsZero() {
+		s.logger().Debug("no previous backup -> skip catch-up")
+		return
+	}
+
+	missed := s.Cron.Entry(s.CronEntry).Schedule.Next(lastRun)
+	if missed.After(time.Now()) {
+		s.logger().Debug("no scheduled backup missed", "last_run", lastRun, "next", missed)
+		return
+	}
+
+	s.logger().Printf("> scheduled backup at %s was missed (last backup %s) -> start catch-up backup",
+		missed.Format(time.RFC3339), lastRun.Format(time.RFC3339))
+	go s.scheduledBackup()
+}
+
+// labelScheduleRefresh interval of the discovery of schedules from container labels
+const labelScheduleRefresh = "@every 5m"
+
+// refreshLabelSchedules adds schedules of container labels to the cron and removes schedules of removed labels
+func (s *BackupService) refreshLabelSchedules() {
+	containers, err := s.Docker.Containers(true, map[string][]string{"label": {labelBackupSchedule}})
+	if err != nil {
+		s.logger().Error("failed to discover backup schedules", "error", err)
+		return
+	}
+
+	// schedule with the name of the first container
+	schedules := make(map[string]string)
+	for _, container := range containers {
+		schedule := container.Labels[labelBackupSchedule]
+		if container.Labels[labelBackupJob] != s.Name || schedules[schedule] != "" {
+			continue
+		}
+		schedules[schedule] = container.Name()
+	}
+
+	s.labelSchedulesMutex.Lock()
+	defer s.labelSchedulesMutex.Unlock()
+	for _, schedule := range slices.Sorted(maps.Keys(s.labelSchedules)) {
+		if _, ok := schedules[schedule]; !ok {
+			s.Cron.Remove(s.labelSchedules[schedule])
+			delete(s.labelSchedules, schedule)
+			s.logger().Printf("[Removed %s schedule %s]", s.title(), schedule)
+		}
+	}
+	for _, schedule := range slices.Sorted(maps.Keys(schedules)) {
+		if _, ok := s.labelSchedules[schedule]; ok {
+			continue
+		}
+		entry, err := s.Cron.AddFunc(schedule, s.scheduledBackup)
+		if err != nil {
+			s.logger().Error("invalid backup schedule", "schedule", schedule, "container", schedules[schedule], "error", err)
+			continue
+		}
+		s.labelSchedules[schedule] = entry
+		s.logger().Printf("[Next %s (%s): %s]", s.title(), schedules[schedule], s.Cron.Entry(entry).Next)
+	}
+}
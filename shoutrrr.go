@@ -0,0 +1,35 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/containrrr/shoutrrr"
+	"github.com/containrrr/shoutrrr/pkg/router"
+	"github.com/containrrr/shoutrrr/pkg/types"
+)
+
+// ShoutrrrNotifier sends notifications to all services of a list of shoutrrr URLs
+// (e.g. slack://, teams://, pushover://, matrix://)
+type ShoutrrrNotifier struct {
+	sender *router.ServiceRouter
+}
+
+// NewShoutrrrNotifier for the given service URLs
+func NewShoutrrrNotifier(urls []string) (*ShoutrrrNotifier, error) {
+	sender, err := shoutrrr.CreateSender(urls...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid notification URL: %w", err)
+	}
+	return &ShoutrrrNotifier{sender: sender}, nil
+}
+
+// Notify all services about the task result
+func (n *ShoutrrrNotifier) Notify(notification Notification) error {
+	params := types.Params{"title": notification.Title()}
+	err := errors.Join(n.sender.Send(notification.Message(), &params)...)
+	if err != nil {
+		return fmt.Errorf("shoutrrr: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import "fmt"
+
+// SlackNotifier sends notifications to a Slack incoming webhook
+type SlackNotifier struct {
+	Webhook string
+	// FailureOnly sends only notifications about failed tasks
+	FailureOnly bool
+}
+
+// slackField of a message attachment
+type slackField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+// slackAttachment of a message
+type slackAttachment struct {
+	Color  string       `json:"color"`
+	Title  string       `json:"title"`
+	Fields []slackField `json:"fields"`
+}
+
+// slackMessage sent to the webhook
+type slackMessage struct {
+	Text        string            `json:"text"`
+	Attachments []slackAttachment `json:"attachments"`
+}
+
+// Notify Slack about the task result
+func (n *SlackNotifier) Notify(notification Notification) error {
+	if n.FailureOnly && notification.Success() {
+		return nil
+	}
+
+	attachment := slackAttachment{
+		Color: "good",
+		Title: notification.Title(),
+	}
+	if !notification.Success() {
+		attachment.Color = "danger"
+	}
+	for _, field := range notification.Fields() {
+		attachment.Fields = append(attachment.Fields, slackField{
+			Title: field[0],
+			Value: field[1],
+			Short: field[0] != "Error" && field[0] != "File",
+		})
+	}
+
+	err := postJSON(n.Webhook, slackMessage{
+		Text:        notification.Title(),
+		Attachments: []slackAttachment{attachment},
+	})
+	if err != nil {
+		return fmt.Errorf("slack: %w", err)
+	}
+	return nil
+}
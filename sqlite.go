@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// SQLiteConnection used for backup of SQLite database files
+type SQLiteConnection struct {
+	Config DatabaseConfig
+}
+
+// NewSQLiteConnection from the given configuration
+func NewSQLiteConnection(config DatabaseConfig) *SQLiteConnection {
+	return &SQLiteConnection{
+		Config: config,
+	}
+}
+
+// WaitForConnection waits until the database file exists for a maximum of duration
+func (c *SQLiteConnection) WaitForConnection(duration time.Duration) error {
+	// ticker to check every second for the database file
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+
+	timeoutExceeded := time.After(duration)
+	for {
+		select {
+		case <-timeoutExceeded:
+			return errors.New("timeout while waiting for database file")
+
+		case <-ticker.C:
+			_, err := os.Stat(c.Config.Database)
+			if err == nil {
+				return nil
+			}
+		}
+	}
+}
+
+// Init is not required for SQLite
+func (c *SQLiteConnection) Init() error {
+	c.Config.logger().Print("sqlite database -> skip user and database creation")
+	return nil
+}
+
+// BackupFilename of the database dump inside the backup
+func (c *SQLiteConnection) BackupFilename() string {
+	return "database.sqlite"
+}
+
+// Backup database to the given writer
+func (c *SQLiteConnection) Backup(writer io.Writer) error {
+	dir, err := os.MkdirTemp("", "sqlite_backup_")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// use online backup API of sqlite to get a consistent copy of the live database
+	backupFile := filepath.Join(dir, "database.sqlite")
+	cmd := exec.Command("sqlite3", c.Config.Database,
+		fmt.Sprintf(".backup '%s'", strings.ReplaceAll(backupFile, "'", "''")))
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	err = cmd.Run()
+	if err != nil {
+		return fmt.Errorf("failed to backup sqlite database: %w", err)
+	}
+
+	file, err := os.Open(backupFile)
+	if err != nil {
+		return fmt.Errorf("failed to open sqlite backup: %w", err)
+	}
+	defer file.Close()
+
+	_, err = io.Copy(writer, file)
+	return err
+}
+
+// Restore database file from the given reader
+func (c *SQLiteConnection) Restore(_, _ string, reader io.Reader) error {
+	// write to temporary file first to not destroy the database on errors
+	tmpFile := c.Config.Database + ".restore"
+	file, err := os.Create(tmpFile)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", tmpFile, err)
+	}
+
+	_, err = io.Copy(file, reader)
+	file.Close()
+	if err != nil {
+		os.Remove(tmpFile)
+		return fmt.Errorf("failed to write %s: %w", tmpFile, err)
+	}
+
+	// journal and WAL of the old database would be applied to the restored file
+	for _, suffix := range []string{"-wal", "-shm", "-journal"} {
+		err = os.Remove(c.Config.Database + suffix)
+		if err != nil && !os.IsNotExist(err) {
+			os.Remove(tmpFile)
+			return fmt.Errorf("failed to remove %s: %w", c.Config.Database+suffix, err)
+		}
+	}
+	return os.Rename(tmpFile, c.Config.Database)
+}
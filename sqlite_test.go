@@ -0,0 +1,30 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSQLiteRestoreRemovesJournal(t *testing.T) {
+	database := filepath.Join(t.TempDir(), "app.db")
+	for _, name := range []string{database, database + "-wal", database + "-shm", database + "-journal"} {
+		if err := os.WriteFile(name, []byte("old"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	connection := &SQLiteConnection{Config: DatabaseConfig{Database: database}}
+	if err := connection.Restore("", "", strings.NewReader("restored")); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(database); string(data) != "restored" {
+		t.Errorf("database content = %q, expected restored", data)
+	}
+	for _, suffix := range []string{"-wal", "-shm", "-journal", ".restore"} {
+		if _, err := os.Stat(database + suffix); !os.IsNotExist(err) {
+			t.Errorf("%s not removed after restore", database+suffix)
+		}
+	}
+}
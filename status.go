@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Status of housekeeper returned by the status endpoint
+type Status struct {
+	Ready bool        `json:"ready"`
+	Jobs  []JobStatus `json:"jobs"`
+}
+
+// JobStatus of a backup job
+type JobStatus struct {
+	Name       string           `json:"name,omitempty"`
+	Running    bool             `json:"running"`
+	LastBackup *BackupRunStatus `json:"last_backup"`
+	NextRun    *time.Time       `json:"next_run"`
+	Storage    *StorageStatus   `json:"storage,omitempty"`
+	Remote     *RemoteStatus    `json:"remote,omitempty"`
+	// History of the last backup runs (oldest first)
+	History []BackupRunStatus `json:"history,omitempty"`
+}
+
+// BackupRunStatus of a backup run
+type BackupRunStatus struct {
+	Time     time.Time `json:"time"`
+	Result   string    `json:"result"`
+	Error    string    `json:"error,omitempty"`
+	Filename string    `json:"filename,omitempty"`
+	// Size of the backup file (omitted if unknown)
+	Size int64 `json:"size,omitempty"`
+	// RawSize and Files of the archived files and database dumps (omitted if unknown)
+	RawSize int64 `json:"raw_size,omitempty"`
+	Files   int   `json:"files,omitempty"`
+	// Duration of the run and UploadDuration to the rclone remote in seconds (omitted if unknown)
+	Duration       float64 `json:"duration,omitempty"`
+	UploadDuration float64 `json:"upload_duration,omitempty"`
+	// Mirrors the backup was copied to (omitted if none are configured)
+	Mirrors []MirrorStatus `json:"mirrors,omitempty"`
+}
+
+// StorageStatus of the local backup storage
+type StorageStatus struct {
+	Path    string `json:"path"`
+	Backups int    `json:"backups"`
+	Size    int64  `json:"size"`
+	Free    int64  `json:"free"`
+}
+
+// RemoteStatus of the upload to the rclone remote
+type RemoteStatus struct {
+	Path   string `json:"path"`
+	Result string `json:"result,omitempty"`
+}
+
+// setLastRun of the backup from the sent notification and add it to the history
+func (s *BackupService) setLastRun(start time.Time, notification Notification) *BackupRunStatus {
+	status := &BackupRunStatus{
+		Time:     start,
+		Result:   "success",
+		Filename: notification.Filename,
+		Size:     max(notification.Size, 0),
+		Duration: notification.Duration.Seconds(),
+	}
+	if s.runStats != nil {
+		status.Mirrors = s.runStats.mirrors
+	}
+	if notification.Error != nil {
+		status.Result = "failed"
+		status.Error = notification.Error.Error()
+	} else if s.runStats != nil {
+		status.RawSize = s.runStats.rawSize
+		status.Files = s.runStats.files
+		status.UploadDuration = s.runStats.upload.Seconds()
+	}
+
+	s.lastRunMutex.Lock()
+	s.lastRun = status
+	s.lastRunMutex.Unlock()
+
+	if err := s.addHistory(*status); err != nil {
+		s.logger().Warn("> failed to store backup history", "error", err)
+	}
+	return status
+}
+
+// status of the backup job (the history or the last successful backup is used after a restart)
+func (s *BackupService) status() JobStatus {
+	s.lastRunMutex.Lock()
+	lastRun := s.lastRun
+	s.lastRunMutex.Unlock()
+
+	history, err := s.loadHistory()
+	if err != nil {
+		s.logger().Warn("> failed to load backup history", "error", err)
+	}
+	if lastRun == nil && len(history) > 0 {
+		lastRun = &history[len(history)-1]
+	}
+	if lastRun == nil {
+		if lastSuccess := s.loadLastRun(); !lastSuccess.IsZero() {
+			lastRun = &BackupRunStatus{Time: lastSuccess, Result: "success"}
+		}
+	}
+
+	status := JobStatus{
+		Name:       s.Name,
+		Running:    s.running.Load(),
+		LastBackup: lastRun,
+		History:    history,
+	}
+	if next := s.nextRun(); !next.IsZero() {
+		status.NextRun = &next
+	}
+
+	if s.RClone != nil {
+		status.Remote = &RemoteStatus{Path: s.Config.RClonePath}
+		if lastRun != nil {
+			status.Remote.Result = lastRun.Result
+		}
+	} else if s.Config.ResticRepository == "" {
+		status.Storage = s.storageStatus()
+	}
+	return status
+}
+
+// storageStatus with the number and size of local backups and the free space (nil if not accessible)
+func (s *BackupService) storageStatus() *StorageStatus {
+	backups, err := s.listLocalBackups()
+	if err != nil {
+		return nil
+	}
+	free, err := freeSpace(s.Config.Storage)
+	if err != nil {
+		return nil
+	}
+
+	status := &StorageStatus{
+		Path:    s.Config.Storage,
+		Backups: len(backups),
+		Free:    free,
+	}
+	for _, backup := range backups {
+		if info, err := os.Stat(filepath.Join(s.Config.Storage, backup)); err == nil {
+			status.Size += info.Size()
+		}
+	}
+	return status
+}
+
+// serveStatus returns the status of all backup jobs as JSON
+func (h *Housekeeper) serveStatus(writer http.ResponseWriter, _ *http.Request) {
+	h.mutex.RLock()
+	status := Status{Ready: h.running.Load(), Jobs: []JobStatus{}}
+	if status.Ready {
+		for _, job := range h.jobs {
+			status.Jobs = append(status.Jobs, job.status())
+		}
+	}
+	h.mutex.RUnlock()
+
+	writer.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(writer).Encode(status)
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/object"
+)
+
+// walSlot is the replication slot used for WAL streaming
+const walSlot = "housekeeper"
+
+// WalStreamer is implemented by connections that are able to
+// continuously stream write ahead log segments into a directory
+type WalStreamer interface {
+	ReceiveWal(ctx context.Context, dir string) error
+}
+
+// WalSlotDropper is implemented by streamers that use a replication slot which
+// has to be dropped if WAL archiving is disabled
+type WalSlotDropper interface {
+	DropWalSlot() error
+}
+
+// WalArchiver continuously archives WAL segments for point-in-time recovery
+type WalArchiver struct {
+	Streamer WalStreamer
+	Backup   *BackupService
+
+	uploaded map[string]bool
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+// Directory of archived WAL segments in the local storage
+func (w *WalArchiver) Directory() string {
+	return w.Backup.walDirectory()
+}
+
+// Start streaming and uploading of WAL segments
+func (w *WalArchiver) Start() error {
+	err := os.MkdirAll(w.Directory(), os.ModePerm)
+	if err != nil {
+		return fmt.Errorf("failed to create WAL dir %s: %w", w.Directory(), err)
+	}
+
+	w.uploaded = make(map[string]bool)
+
+	var ctx context.Context
+	ctx, w.cancel = context.WithCancel(context.Background())
+
+	w.wg.Add(2)
+	go w.receive(ctx)
+	go w.upload(ctx)
+
+	w.Backup.logger().Printf("WAL archiving started")
+	return nil
+}
+
+// Stop WAL archiving and upload pending segments
+func (w *WalArchiver) Stop() {
+	if w.cancel == nil {
+		return
+	}
+	w.cancel()
+	w.wg.Wait()
+}
+
+// receive WAL segments and restart streaming on errors
+func (w *WalArchiver) receive(ctx context.Context) {
+	defer w.wg.Done()
+
+	for {
+		err := w.Streamer.ReceiveWal(ctx, w.Directory())
+		if ctx.Err() != nil {
+			return
+		}
+		w.Backup.logger().Error("WAL streaming stopped", "error", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(10 * time.Second):
+		}
+	}
+}
+
+// upload completed WAL segments to the rclone remote
+func (w *WalArchiver) upload(ctx context.Context) {
+	defer w.wg.Done()
+
+	// local storage only -> nothing to upload
+	if w.Backup.RClone == nil {
+		return
+	}
+
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			// final upload of already completed segments
+			w.uploadSegments()
+			return
+		case <-ticker.C:
+			w.uploadSegments()
+		}
+	}
+}
+
+// uploadSegments that are completed and not uploaded yet
+func (w *WalArchiver) uploadSegments() {
+	entries, err := os.ReadDir(w.Directory())
+	if err != nil {
+		w.Backup.logger().Error("failed to list WAL segments", "error", err)
+		return
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		// segments that are still written have a .partial suffix
+		if entry.IsDir() || strings.HasSuffix(name, ".partial") || w.uploaded[name] {
+			continue
+		}
+
+		err = w.uploadSegment(name)
+		if err != nil {
+			w.Backup.logger().Error("failed to upload WAL segment", "segment", name, "error", err)
+			return
+		}
+		w.uploaded[name] = true
+	}
+}
+
+// uploadSegment to the rclone remote if it does not exist already
+func (w *WalArchiver) uploadSegment(name string) error {
+	ctx := context.Background()
+	remote := path.Join("wal", name)
+
+	// skip segments uploaded by a previous run
+	_, err := w.Backup.RClone.NewObject(ctx, remote)
+	if err == nil {
+		return nil
+	}
+	if err != fs.ErrorObjectNotFound {
+		return err
+	}
+
+	file, err := os.Open(filepath.Join(w.Directory(), name))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Backup.RClone.Put(ctx, file,
+		object.NewStaticObjectInfo(remote, info.ModTime(), info.Size(), true, nil, nil))
+	return err
+}